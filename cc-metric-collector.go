@@ -8,10 +8,18 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"hash/fnv"
 	"os"
 	"os/signal"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 
 	"github.com/ClusterCockpit/cc-lib/receivers"
@@ -22,16 +30,59 @@ import (
 	"sync"
 	"time"
 
-	ccconf "github.com/ClusterCockpit/cc-lib/ccConfig"
 	cclog "github.com/ClusterCockpit/cc-lib/ccLogger"
 	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+	cs "github.com/ClusterCockpit/cc-metric-collector/internal/controlServer"
+	mpr "github.com/ClusterCockpit/cc-metric-collector/internal/metricPrinter"
 	mr "github.com/ClusterCockpit/cc-metric-collector/internal/metricRouter"
+	spool "github.com/ClusterCockpit/cc-metric-collector/internal/sinkSpool"
+	bp "github.com/ClusterCockpit/cc-metric-collector/pkg/backPressure"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/ccTopology"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/clock"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/hostfs"
 	mct "github.com/ClusterCockpit/cc-metric-collector/pkg/multiChanTicker"
 )
 
 type CentralConfigFile struct {
-	Interval string `json:"interval"`
-	Duration string `json:"duration"`
+	Interval   string `json:"interval"`
+	Duration   string `json:"duration"`
+	AlignTicks bool   `json:"align_ticks,omitempty"` // align the ticks to multiples of the interval
+	Splay      string `json:"splay,omitempty"`       // maximal per-host delay of the aligned ticks
+	ProcfsRoot string `json:"procfs_root,omitempty"` // directory of procfs used by all collectors
+	SysfsRoot  string `json:"sysfs_root,omitempty"`  // directory of sysfs used by all collectors and the topology
+
+	Channels map[string]bp.ChannelConfig `json:"channels,omitempty"` // size and back-pressure policy of the channels between the components
+}
+
+// Names of the channels between the components
+const (
+	CHANNEL_COLLECTORS_TO_ROUTER = "collectors_to_router"
+	CHANNEL_RECEIVERS_TO_ROUTER  = "receivers_to_router"
+	CHANNEL_ROUTER_TO_SINKS      = "router_to_sinks"
+)
+
+// validateChannels checks the configuration of the channels between the components.
+// The receivers always block if their channel is full.
+func validateChannels(channels map[string]bp.ChannelConfig) []error {
+	errs := make([]error, 0)
+	for name, c := range channels {
+		switch name {
+		case CHANNEL_COLLECTORS_TO_ROUTER, CHANNEL_ROUTER_TO_SINKS:
+		case CHANNEL_RECEIVERS_TO_ROUTER:
+			if len(c.Policy) > 0 && c.Policy != bp.POLICY_BLOCK {
+				errs = append(errs, fmt.Errorf("channels: %s: only policy '%s' is supported", name, bp.POLICY_BLOCK))
+				continue
+			}
+		default:
+			errs = append(errs, fmt.Errorf("channels: unknown channel '%s', use '%s', '%s' or '%s'",
+				name, CHANNEL_COLLECTORS_TO_ROUTER, CHANNEL_RECEIVERS_TO_ROUTER, CHANNEL_ROUTER_TO_SINKS))
+			continue
+		}
+		if err := c.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("channels: %s: %v", name, err))
+		}
+	}
+	return errs
 }
 
 type RuntimeConfig struct {
@@ -42,11 +93,19 @@ type RuntimeConfig struct {
 
 	MetricRouter    mr.MetricRouter
 	CollectManager  collectors.CollectorManager
-	SinkManager     sinks.SinkManager
+	SinkManagers    []sinks.SinkManager
 	ReceiveManager  receivers.ReceiveManager
 	MultiChanTicker mct.MultiChanTicker
+	ControlServer   cs.ControlServer
+	MetricPrinter   mpr.MetricPrinter
 
-	Channels []chan lp.CCMessage
+	// Configurations of the components which cannot be reloaded
+	SinkConfig     json.RawMessage
+	ReceiverConfig json.RawMessage
+	ReloadDone     chan bool
+	ReloadLock     sync.Mutex // Held during a reload, so the shutdown does not close reloading components
+
+	Channels []chan lp.CCMessage // Channels from the router to the sink managers or the metric printer
 	Sync     sync.WaitGroup
 }
 
@@ -79,6 +138,15 @@ func ReadCli() map[string]string {
 	cfg := flag.String("config", "./config.json", "Path to configuration file")
 	logfile := flag.String("log", "stderr", "Path for logfile")
 	once := flag.Bool("once", false, "Run all collectors only once")
+	onceWait := flag.Duration("once-wait", time.Second, "Sampling window between the reads in single-shot mode (-once)")
+	onceReads := flag.Int("once-reads", 1, "Number of reads in single-shot mode (-once)")
+	validate := flag.Bool("validate", false, "Validate the configuration files and exit")
+	printConfigFlag := flag.Bool("print-config", false, "Print the effective configuration with all overlays applied and exit")
+	stdout := flag.String("stdout", "", "Print all metrics to stdout ('influx', 'json' or 'table') instead of sending them to the sinks")
+	filter := flag.String("filter", "", "Print only metrics with names matching the comma separated glob patterns (-stdout)")
+	listMetricsFormat := flag.String("list-metrics", "", "Print the metrics of the configured collectors ('json' or 'markdown') and exit")
+	record := flag.String("record", "", "Record the inputs of all collectors in the given directory")
+	replay := flag.String("replay", "", "Replay the collector inputs recorded with -record in the given directory and exit")
 	loglevel := flag.String("loglevel", "info", "Set log level")
 	flag.Parse()
 	m = make(map[string]string)
@@ -89,6 +157,23 @@ func ReadCli() map[string]string {
 	} else {
 		m["once"] = "false"
 	}
+	m["once_wait"] = onceWait.String()
+	m["once_reads"] = fmt.Sprintf("%d", *onceReads)
+	if *validate {
+		m["validate"] = "true"
+	} else {
+		m["validate"] = "false"
+	}
+	if *printConfigFlag {
+		m["print_config"] = "true"
+	} else {
+		m["print_config"] = "false"
+	}
+	m["list_metrics"] = *listMetricsFormat
+	m["stdout"] = *stdout
+	m["filter"] = *filter
+	m["record"] = *record
+	m["replay"] = *replay
 	m["loglevel"] = *loglevel
 	return m
 }
@@ -120,6 +205,16 @@ func shutdownHandler(config *RuntimeConfig, shutdownSignal chan os.Signal) {
 
 	cclog.Info("Shutdown...")
 
+	// Stop configuration reloads and wait for a running reload to finish
+	close(config.ReloadDone)
+	config.ReloadLock.Lock()
+	config.ReloadLock.Unlock()
+
+	if config.ControlServer != nil {
+		cclog.Debug("Shutdown ControlServer...")
+		config.ControlServer.Close()
+	}
+
 	cclog.Debug("Shutdown Ticker...")
 	config.MultiChanTicker.Close()
 
@@ -135,10 +230,380 @@ func shutdownHandler(config *RuntimeConfig, shutdownSignal chan os.Signal) {
 		cclog.Debug("Shutdown Router...")
 		config.MetricRouter.Close()
 	}
-	if config.SinkManager != nil {
+	closeOutputs(config)
+}
+
+// startOutputs starts the sink managers or the metric printer
+func startOutputs(config *RuntimeConfig) {
+	for _, s := range config.SinkManagers {
+		s.Start()
+	}
+	if config.MetricPrinter != nil {
+		config.MetricPrinter.Start()
+	}
+}
+
+// waitOutputs waits until the sink managers or the metric printer received all messages
+// from the router, but at most for the given timeout
+func waitOutputs(config *RuntimeConfig, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for _, c := range config.Channels {
+		for len(c) > 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// closeOutputs stops the sink managers or the metric printer
+func closeOutputs(config *RuntimeConfig) {
+	if len(config.SinkManagers) > 0 {
 		cclog.Debug("Shutdown SinkManager...")
-		config.SinkManager.Close()
+		for _, s := range config.SinkManagers {
+			s.Close()
+		}
+	}
+	if config.MetricPrinter != nil {
+		cclog.Debug("Shutdown MetricPrinter...")
+		config.MetricPrinter.Close()
+	}
+}
+
+// newSinkManagers creates a sink manager for each sink used by the router outputs, each
+// connected to the router by its own channel. Configured sinks not used by any output
+// are not started. It returns the channels by their name.
+func newSinkManagers(config *RuntimeConfig, sinkConf json.RawMessage, used []string, size int) (map[string]chan lp.CCMessage, error) {
+	var sinkConfigs map[string]json.RawMessage
+	err := json.Unmarshal(sinkConf, &sinkConfigs)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range used {
+		if _, ok := sinkConfigs[name]; !ok {
+			return nil, fmt.Errorf("router outputs use unknown sink '%s'", name)
+		}
+	}
+	for name := range sinkConfigs {
+		if _, found := slices.BinarySearch(used, name); !found {
+			cclog.Info("Sink ", name, " is not used by any router output and not started")
+		}
+	}
+
+	channels := make(map[string]chan lp.CCMessage)
+	for _, name := range used {
+		conf, err := json.Marshal(map[string]json.RawMessage{name: sinkConfigs[name]})
+		if err != nil {
+			return nil, err
+		}
+		s, err := sinks.New(&config.Sync, conf)
+		if err != nil {
+			return nil, fmt.Errorf("sink %s: %v", name, err)
+		}
+		c := make(chan lp.CCMessage, size)
+		s.AddInput(c)
+		config.MetricRouter.AddSinkOutput(name, c)
+		config.SinkManagers = append(config.SinkManagers, s)
+		config.Channels = append(config.Channels, c)
+		channels[CHANNEL_ROUTER_TO_SINKS+"/"+name] = c
+	}
+	return channels, nil
+}
+
+// checkConfigFiles checks that the main configuration file and all referenced
+// component configuration files ('*-file' keys) contain valid JSON
+func checkConfigFiles(configFile string) error {
+	raw, err := os.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	var keys map[string]json.RawMessage
+	err = json.Unmarshal(raw, &keys)
+	if err != nil {
+		return fmt.Errorf("%s: %v", configFile, err)
+	}
+	for key, value := range keys {
+		if !strings.HasSuffix(key, "-file") {
+			continue
+		}
+		var filename string
+		err = json.Unmarshal(value, &filename)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %v", configFile, key, err)
+		}
+		raw, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		if !json.Valid(raw) {
+			return fmt.Errorf("%s: invalid JSON", filename)
+		}
+	}
+	return nil
+}
+
+// reloadConfig re-reads and checks the configuration files and applies changed collector
+// and router settings to the running components. If the configuration is invalid or the
+// router rejects it, nothing is applied and an error is returned.
+func reloadConfig(config *RuntimeConfig) error {
+	cclog.Info("Reload configuration...")
+
+	configFile := config.CliArgs["configfile"]
+	if errs := checkConfiguration(configFile); len(errs) > 0 {
+		for _, err := range errs {
+			cclog.Error("Reload: ", err.Error())
+		}
+		return fmt.Errorf("configuration %s has %d error(s)", configFile, len(errs))
+	}
+
+	var mainConfig CentralConfigFile
+	err := json.Unmarshal(getPackageConfig("main"), &mainConfig)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(mainConfig, config.ConfigFile) {
+		cclog.Error("Reload: changes of the global options like 'interval', 'duration' or 'channels' require a restart")
+	}
+	if len(config.SinkManagers) > 0 && !bytes.Equal(getPackageConfig("sinks"), config.SinkConfig) {
+		cclog.Error("Reload: changes of the sink configuration require a restart")
+	}
+	if !bytes.Equal(getPackageConfig("receivers"), config.ReceiverConfig) {
+		cclog.Error("Reload: changes of the receiver configuration require a restart")
+	}
+
+	err = config.MetricRouter.Reload(getPackageConfig("router"))
+	if err != nil {
+		return fmt.Errorf("reload of metric router configuration failed: %v", err)
+	}
+	err = config.CollectManager.Reload(getPackageConfig("collectors"))
+	if err != nil {
+		return fmt.Errorf("reload of metric collector configuration failed: %v", err)
+	}
+	cclog.Info("Reload configuration done")
+	return nil
+}
+
+// reloadHandler reloads the configuration every time a SIGHUP signal is received
+func reloadHandler(config *RuntimeConfig, reloadSignal chan os.Signal) {
+	defer config.Sync.Done()
+	for {
+		select {
+		case <-config.ReloadDone:
+			signal.Stop(reloadSignal)
+			return
+		case <-reloadSignal:
+			config.ReloadLock.Lock()
+			select {
+			case <-config.ReloadDone:
+				// The shutdown started meanwhile
+			default:
+				if err := reloadConfig(config); err != nil {
+					cclog.Error("Reload failed, keeping current configuration: ", err.Error())
+				}
+			}
+			config.ReloadLock.Unlock()
+		}
+	}
+}
+
+// runOnce runs the collectors in single-shot mode: After an initial read to get a baseline
+// for collectors deriving values, all collectors are read the requested number of times
+// separated by the sampling window. Afterwards, all pending metrics are forwarded through
+// the router to the sinks and all components are stopped.
+// It returns the exit code: 0 on success, 1 for invalid single-shot options and 2 if any
+// collector failed to initialize or a read failed (error, panic or timeout), see collectorStatus().
+func runOnce(rcfg *RuntimeConfig) int {
+	wait, err := time.ParseDuration(rcfg.CliArgs["once_wait"])
+	if err != nil || wait < 0 {
+		cclog.Error("Invalid sampling window for single-shot mode: ", rcfg.CliArgs["once_wait"])
+		return 1
+	}
+	reads, err := strconv.Atoi(rcfg.CliArgs["once_reads"])
+	if err != nil || reads < 1 {
+		cclog.Error("Number of reads in single-shot mode must be at least 1")
+		return 1
+	}
+
+	rcfg.MetricRouter.Start()
+	startOutputs(rcfg)
+
+	// Like the collectors, the sampling window uses the clock of the ticker
+	clk := rcfg.MultiChanTicker.Clock()
+	rcfg.CollectManager.Warmup()
+	for i := 0; i < reads; i++ {
+		timer := clk.NewTimer(wait)
+		<-timer.C()
+		// Start a new interval for the router's interval timestamp and the metric cache
+		rcfg.MultiChanTicker.Tick(clk.Now())
+		rcfg.CollectManager.ReadNow("")
+	}
+	// Evaluate the interval aggregations of the last interval. The second tick
+	// is delivered after the metric cache finished the evaluation of the first one.
+	rcfg.MultiChanTicker.Tick(clk.Now())
+	rcfg.MultiChanTicker.Tick(clk.Now())
+	rcfg.MetricRouter.Flush()
+
+	// Wait until the sink managers received all messages
+	waitOutputs(rcfg, 10*time.Second)
+
+	// Closing the collectors resets their initialization state
+	status := collectorStatus(rcfg)
+	rcfg.MultiChanTicker.Close()
+	rcfg.CollectManager.Close()
+	rcfg.MetricRouter.Close()
+	closeOutputs(rcfg)
+	rcfg.Sync.Wait()
+	return status
+}
+
+// collectorStatus returns the exit code of the single-shot and replay modes: 2 if a collector failed
+// to initialize or a read failed (error, panic or timeout), otherwise 0. It has to be
+// called before the collector manager is closed.
+func collectorStatus(rcfg *RuntimeConfig) int {
+	status := 0
+	failed := rcfg.CollectManager.Failed()
+	if len(failed) > 0 {
+		cclog.Error("Collectors failed to initialize: ", strings.Join(failed, ", "))
+		status = 2
+	}
+	for _, c := range rcfg.CollectManager.Collectors() {
+		if c.Errors > 0 || c.Stalled {
+			cclog.Error(fmt.Sprintf("Collector %s: %d failed reads (%d timeouts), last error: %s", c.Name, c.Errors, c.Timeouts, c.LastError))
+			status = 2
+		}
+	}
+	return status
+}
+
+// runReplay replays the collector inputs recorded with -record: For each recorded read cycle,
+// the clock is set to the recorded time and all collectors are read with the recorded inputs.
+// Afterwards, all pending metrics are forwarded through the router to the sinks and all
+// components are stopped. It returns the exit code like runOnce.
+func runReplay(rcfg *RuntimeConfig, fake *clock.Fake, ticks []collectors.RecordedTick) int {
+	rcfg.MetricRouter.Start()
+	startOutputs(rcfg)
+
+	for _, tick := range ticks {
+		fake.Set(tick.Time())
+		if tick.Warmup {
+			rcfg.CollectManager.Warmup()
+			continue
+		}
+		rcfg.MultiChanTicker.Tick(tick.Time())
+		rcfg.CollectManager.ReadNow("")
+	}
+	// Evaluate the interval aggregations of the last interval
+	for i := 0; i < 2; i++ {
+		fake.Advance(rcfg.Interval)
+		rcfg.MultiChanTicker.Tick(fake.Now())
+	}
+	rcfg.MetricRouter.Flush()
+
+	// Wait until the sink managers received all messages
+	waitOutputs(rcfg, 10*time.Second)
+
+	// Closing the collectors resets their initialization state
+	status := collectorStatus(rcfg)
+	rcfg.MultiChanTicker.Close()
+	rcfg.CollectManager.Close()
+	rcfg.MetricRouter.Close()
+	closeOutputs(rcfg)
+	rcfg.Sync.Wait()
+	return status
+}
+
+// registerPipelineStats registers the message counters of the metric router, the delivered
+// and missed ticks of the ticker, the fill levels of the given channels, the dropped
+// messages of the channels with a back-pressure policy and the spools of the sinks
+// for the self collector
+func registerPipelineStats(router mr.MetricRouter, ticker mct.MultiChanTicker, channels map[string]chan lp.CCMessage) {
+	collectors.RegisterPipelineStats("router", func() []collectors.PipelineStat {
+		stats := make([]collectors.PipelineStat, 0)
+		for input, s := range router.Stats() {
+			tags := map[string]string{"input": input}
+			stats = append(stats,
+				collectors.PipelineStat{Name: "router_messages_received", Tags: tags, Value: s.Received},
+				collectors.PipelineStat{Name: "router_messages_forwarded", Tags: tags, Value: s.Forwarded},
+				collectors.PipelineStat{Name: "router_messages_dropped", Tags: tags, Value: s.Dropped},
+				collectors.PipelineStat{Name: "router_messages_suppressed", Tags: tags, Value: s.Suppressed},
+				collectors.PipelineStat{Name: "router_messages_derived", Tags: tags, Value: s.Derived})
+		}
+		return append(stats, collectors.PipelineStat{
+			Name:  "router_aggregation_duration",
+			Unit:  "seconds",
+			Value: router.AggregationDuration().Seconds(),
+		})
+	})
+	collectors.RegisterPipelineStats("ticker", func() []collectors.PipelineStat {
+		stats := make([]collectors.PipelineStat, 0)
+		for _, s := range ticker.Stats() {
+			tags := map[string]string{"receiver": s.Name}
+			stats = append(stats,
+				collectors.PipelineStat{Name: "ticker_delivered_ticks", Tags: tags, Value: s.Delivered},
+				collectors.PipelineStat{Name: "ticker_missed_ticks", Tags: tags, Value: s.Missed})
+		}
+		return stats
+	})
+	collectors.RegisterPipelineStats("channels", func() []collectors.PipelineStat {
+		stats := make([]collectors.PipelineStat, 0, 2*len(channels))
+		for name, c := range channels {
+			tags := map[string]string{"channel": name}
+			stats = append(stats,
+				collectors.PipelineStat{Name: "channel_fill_level", Tags: tags, Value: len(c)},
+				collectors.PipelineStat{Name: "channel_capacity", Tags: tags, Value: cap(c)})
+		}
+		for _, s := range bp.Stats() {
+			tags := map[string]string{"channel": s.Channel, "policy": s.Policy}
+			stats = append(stats, collectors.PipelineStat{Name: "channel_dropped_messages", Tags: tags, Value: s.Dropped})
+		}
+		return stats
+	})
+	collectors.RegisterPipelineStats("spool", func() []collectors.PipelineStat {
+		stats := make([]collectors.PipelineStat, 0)
+		for _, s := range spool.Stats() {
+			tags := map[string]string{"sink": s.Sink}
+			unavailable := 0
+			if s.Unavailable {
+				unavailable = 1
+			}
+			stats = append(stats,
+				collectors.PipelineStat{Name: "spool_messages_spooled", Tags: tags, Value: s.Spooled},
+				collectors.PipelineStat{Name: "spool_messages_replayed", Tags: tags, Value: s.Replayed},
+				collectors.PipelineStat{Name: "spool_messages_dropped", Tags: map[string]string{"sink": s.Sink, "reason": "size"}, Value: s.DroppedSize},
+				collectors.PipelineStat{Name: "spool_messages_dropped", Tags: map[string]string{"sink": s.Sink, "reason": "age"}, Value: s.DroppedAge},
+				collectors.PipelineStat{Name: "spool_messages_dropped", Tags: map[string]string{"sink": s.Sink, "reason": "error"}, Value: s.DroppedIO},
+				collectors.PipelineStat{Name: "spool_messages", Tags: tags, Value: s.Messages},
+				collectors.PipelineStat{Name: "spool_size", Tags: tags, Unit: "bytes", Value: s.Bytes},
+				collectors.PipelineStat{Name: "spool_sink_unavailable", Tags: tags, Value: unavailable})
+		}
+		return stats
+	})
+}
+
+// tickSplay returns the delay of the aligned ticks of this host. It is derived from a hash
+// of the hostname, so it is the same on every start and spread over [0, splay).
+func tickSplay(splay string, interval time.Duration) (time.Duration, error) {
+	if len(splay) == 0 {
+		return 0, nil
 	}
+	s, err := time.ParseDuration(splay)
+	if err != nil {
+		return 0, fmt.Errorf("splay: %v", err)
+	}
+	if s < 0 {
+		return 0, errors.New("splay: must not be negative")
+	}
+	if s >= interval {
+		return 0, errors.New("splay: must be smaller than interval")
+	}
+	if s == 0 {
+		return 0, nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return 0, fmt.Errorf("splay: %v", err)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(hostname))
+	return time.Duration(h.Sum64() % uint64(s)), nil
 }
 
 func mainFunc() int {
@@ -149,19 +614,39 @@ func mainFunc() int {
 	rcfg := RuntimeConfig{
 		MetricRouter:   nil,
 		CollectManager: nil,
-		SinkManager:    nil,
+		SinkManagers:   nil,
 		ReceiveManager: nil,
 		CliArgs:        ReadCli(),
+		ReloadDone:     make(chan bool),
 	}
 
 	// Set loglevel based on command line input.
 	cclog.Init(rcfg.CliArgs["loglevel"], false)
 
-	// Init ccConfig with configuration file
-	ccconf.Init(rcfg.CliArgs["configfile"])
+	// Only validate the configuration files
+	if rcfg.CliArgs["validate"] == "true" {
+		return validateConfiguration(rcfg.CliArgs["configfile"])
+	}
+
+	// Only print the metric catalog
+	if len(rcfg.CliArgs["list_metrics"]) > 0 {
+		return listMetrics(rcfg.CliArgs["configfile"], rcfg.CliArgs["list_metrics"])
+	}
+
+	// Only print the effective configuration
+	if rcfg.CliArgs["print_config"] == "true" {
+		return printConfig(rcfg.CliArgs["configfile"])
+	}
+
+	// Read the configuration files and apply the overlays
+	err = loadConfig(rcfg.CliArgs["configfile"])
+	if err != nil {
+		cclog.Error("Error reading configuration: ", err.Error())
+		return 1
+	}
 
 	// Load and check configuration
-	main := ccconf.GetPackageConfig("main")
+	main := getPackageConfig("main")
 	err = json.Unmarshal(main, &rcfg.ConfigFile)
 	if err != nil {
 		cclog.Error("Error reading configuration file ", rcfg.CliArgs["configfile"], ": ", err.Error())
@@ -198,19 +683,35 @@ func mainFunc() int {
 		return 1
 	}
 
-	routerConf := ccconf.GetPackageConfig("router")
+	// Set the procfs and sysfs directories, e.g. for the host's file systems mounted into a container
+	roots := hostfs.Roots{Procfs: rcfg.ConfigFile.ProcfsRoot, Sysfs: rcfg.ConfigFile.SysfsRoot}
+	if errs := roots.Validate(); len(errs) > 0 {
+		for _, err := range errs {
+			cclog.Error(err.Error())
+		}
+		return 1
+	}
+	hostfs.SetRoots(roots)
+	if len(roots.Sysfs) > 0 {
+		// The topology was read from the default sysfs at startup
+		ccTopology.Reload()
+	}
+
+	routerConf := getPackageConfig("router")
 	if len(routerConf) == 0 {
 		cclog.Error("Metric router configuration file must be set")
 		return 1
 	}
 
-	sinkConf := ccconf.GetPackageConfig("sinks")
-	if len(sinkConf) == 0 {
+	// In stdout mode, the sink configuration is not used
+	sinkConf := getPackageConfig("sinks")
+	if len(sinkConf) == 0 && len(rcfg.CliArgs["stdout"]) == 0 {
 		cclog.Error("Sink configuration file must be set")
 		return 1
 	}
+	rcfg.SinkConfig = sinkConf
 
-	collectorConf := ccconf.GetPackageConfig("collectors")
+	collectorConf := getPackageConfig("collectors")
 	if len(collectorConf) == 0 {
 		cclog.Error("Metric collector configuration file must be set")
 		return 1
@@ -221,8 +722,57 @@ func mainFunc() int {
 	// 	cclog.SetOutput(logfile)
 	// }
 
-	// Creat new multi channel ticker
-	rcfg.MultiChanTicker = mct.NewTicker(rcfg.Interval)
+	// Record or replay the inputs of the collectors
+	recordDir, replayDir := rcfg.CliArgs["record"], rcfg.CliArgs["replay"]
+	var replayClock *clock.Fake
+	var replayTicks []collectors.RecordedTick
+	if len(recordDir) > 0 && len(replayDir) > 0 {
+		cclog.Error("The options -record and -replay cannot be used together")
+		return 1
+	}
+	if len(recordDir) > 0 {
+		err = collectors.RecordInputs(recordDir)
+		if err != nil {
+			cclog.Error("Cannot record collector inputs: ", err.Error())
+			return 1
+		}
+	}
+	if len(replayDir) > 0 {
+		err = collectors.ReplayInputs(replayDir)
+		if err == nil {
+			replayTicks, err = collectors.RecordedTicks(replayDir)
+		}
+		if err == nil && len(replayTicks) == 0 {
+			err = fmt.Errorf("no read cycles recorded in %s", replayDir)
+		}
+		if err != nil {
+			cclog.Error("Cannot replay collector inputs: ", err.Error())
+			return 1
+		}
+		replayClock = clock.NewFake(replayTicks[0].Time())
+	}
+
+	// Creat new multi channel ticker. In single-shot and replay mode, the ticks are
+	// triggered manually
+	if len(rcfg.ConfigFile.Splay) > 0 && !rcfg.ConfigFile.AlignTicks {
+		cclog.Error("Configuration value 'splay' requires 'align_ticks'")
+		return 1
+	}
+	if replayClock != nil {
+		rcfg.MultiChanTicker = mct.NewTickerWithClock(replayClock, 0)
+	} else if rcfg.CliArgs["once"] == "true" {
+		rcfg.MultiChanTicker = mct.NewTicker(0)
+	} else if rcfg.ConfigFile.AlignTicks {
+		splay, err := tickSplay(rcfg.ConfigFile.Splay, rcfg.Interval)
+		if err != nil {
+			cclog.Error(err.Error())
+			return 1
+		}
+		cclog.ComponentDebug("MultiChanTicker", "Aligned ticks every", rcfg.Interval, "with splay", splay)
+		rcfg.MultiChanTicker = mct.NewAlignedTicker(rcfg.Interval, splay)
+	} else {
+		rcfg.MultiChanTicker = mct.NewTicker(rcfg.Interval)
+	}
 
 	// Create new metric router
 	rcfg.MetricRouter, err = mr.New(rcfg.MultiChanTicker, &rcfg.Sync, routerConf)
@@ -231,17 +781,63 @@ func mainFunc() int {
 		return 1
 	}
 
-	// Create new sink
-	rcfg.SinkManager, err = sinks.New(&rcfg.Sync, sinkConf)
+	// Check the sizes and back-pressure policies of the channels between the components
+	if errs := validateChannels(rcfg.ConfigFile.Channels); len(errs) > 0 {
+		for _, err := range errs {
+			cclog.Error(err.Error())
+		}
+		return 1
+	}
+	channels := rcfg.ConfigFile.Channels
+
+	// Sinks used by the conditional routing of the metric router
+	routedSinks, err := mr.OutputSinks(routerConf)
 	if err != nil {
 		cclog.Error(err.Error())
 		return 1
 	}
 
-	// Connect metric router to sink manager
-	RouterToSinksChannel := make(chan lp.CCMessage, 200)
-	rcfg.SinkManager.AddInput(RouterToSinksChannel)
-	rcfg.MetricRouter.AddOutput(RouterToSinksChannel)
+	sinkChannels := make(map[string]chan lp.CCMessage)
+	if format := rcfg.CliArgs["stdout"]; len(format) > 0 {
+		// Create new metric printer replacing the sinks. It prints all metrics.
+		rcfg.MetricPrinter, err = mpr.New(&rcfg.Sync, format, rcfg.CliArgs["filter"])
+		if err != nil {
+			cclog.Error(err.Error())
+			return 1
+		}
+		RouterToSinksChannel := make(chan lp.CCMessage, channels[CHANNEL_ROUTER_TO_SINKS].ChannelSize())
+		rcfg.MetricPrinter.AddInput(RouterToSinksChannel)
+		rcfg.MetricRouter.AddOutput(RouterToSinksChannel)
+		rcfg.Channels = append(rcfg.Channels, RouterToSinksChannel)
+		sinkChannels[CHANNEL_ROUTER_TO_SINKS] = RouterToSinksChannel
+	} else if len(routedSinks) > 0 {
+		// Create a sink manager for each sink used by the router outputs
+		sinkChannels, err = newSinkManagers(&rcfg, sinkConf, routedSinks, channels[CHANNEL_ROUTER_TO_SINKS].ChannelSize())
+		if err != nil {
+			cclog.Error(err.Error())
+			return 1
+		}
+	} else {
+		// Create new sink
+		sinkManager, err := sinks.New(&rcfg.Sync, sinkConf)
+		if err != nil {
+			cclog.Error(err.Error())
+			return 1
+		}
+		RouterToSinksChannel := make(chan lp.CCMessage, channels[CHANNEL_ROUTER_TO_SINKS].ChannelSize())
+		sinkManager.AddInput(RouterToSinksChannel)
+		rcfg.MetricRouter.AddOutput(RouterToSinksChannel)
+		rcfg.SinkManagers = append(rcfg.SinkManagers, sinkManager)
+		rcfg.Channels = append(rcfg.Channels, RouterToSinksChannel)
+		sinkChannels[CHANNEL_ROUTER_TO_SINKS] = RouterToSinksChannel
+	}
+
+	// Set the back-pressure policy of the channels to the sink managers or the metric printer
+	err = rcfg.MetricRouter.SetOutputPolicy(CHANNEL_ROUTER_TO_SINKS, channels[CHANNEL_ROUTER_TO_SINKS].Policy)
+	if err != nil {
+		cclog.Error(err.Error())
+		return 1
+	}
 
 	// Create new collector manager
 	rcfg.CollectManager, err = collectors.New(rcfg.MultiChanTicker, rcfg.Duration, &rcfg.Sync, collectorConf)
@@ -251,12 +847,30 @@ func mainFunc() int {
 	}
 
 	// Connect collector manager to metric router
-	CollectToRouterChannel := make(chan lp.CCMessage, 200)
+	CollectToRouterChannel := make(chan lp.CCMessage, channels[CHANNEL_COLLECTORS_TO_ROUTER].ChannelSize())
 	rcfg.CollectManager.AddOutput(CollectToRouterChannel)
+	err = rcfg.CollectManager.SetOutputPolicy(CHANNEL_COLLECTORS_TO_ROUTER, channels[CHANNEL_COLLECTORS_TO_ROUTER].Policy)
+	if err != nil {
+		cclog.Error(err.Error())
+		return 1
+	}
 	rcfg.MetricRouter.AddCollectorInput(CollectToRouterChannel)
 
+	// Provide the statistics of the metric pipeline to the self collector
+	sinkChannels[CHANNEL_COLLECTORS_TO_ROUTER] = CollectToRouterChannel
+	registerPipelineStats(rcfg.MetricRouter, rcfg.MultiChanTicker, sinkChannels)
+
+	// Replay and single-shot mode without receivers
+	if replayClock != nil {
+		return runReplay(&rcfg, replayClock, replayTicks)
+	}
+	if rcfg.CliArgs["once"] == "true" {
+		return runOnce(&rcfg)
+	}
+
 	// Create new receive manager
-	receiveConf := ccconf.GetPackageConfig("receivers")
+	receiveConf := getPackageConfig("receivers")
+	rcfg.ReceiverConfig = receiveConf
 	if len(receiveConf) > 0 {
 		rcfg.ReceiveManager, err = receivers.New(&rcfg.Sync, receiveConf)
 		if err != nil {
@@ -265,12 +879,22 @@ func mainFunc() int {
 		}
 
 		// Connect receive manager to metric router
-		ReceiveToRouterChannel := make(chan lp.CCMessage, 200)
+		ReceiveToRouterChannel := make(chan lp.CCMessage, channels[CHANNEL_RECEIVERS_TO_ROUTER].ChannelSize())
 		rcfg.ReceiveManager.AddOutput(ReceiveToRouterChannel)
 		rcfg.MetricRouter.AddReceiverInput(ReceiveToRouterChannel)
 		use_recv = true
 	}
 
+	// Create new control server
+	controlConf := getPackageConfig("control")
+	if len(controlConf) > 0 {
+		rcfg.ControlServer, err = cs.New(&rcfg.Sync, controlConf, rcfg.CollectManager, rcfg.MetricRouter)
+		if err != nil {
+			cclog.Error(err.Error())
+			return 1
+		}
+	}
+
 	// Create shutdown handler
 	shutdownSignal := make(chan os.Signal, 1)
 	signal.Notify(shutdownSignal, os.Interrupt)
@@ -280,20 +904,22 @@ func mainFunc() int {
 
 	// Start the managers
 	rcfg.MetricRouter.Start()
-	rcfg.SinkManager.Start()
+	startOutputs(&rcfg)
 	rcfg.CollectManager.Start()
 
 	if use_recv {
 		rcfg.ReceiveManager.Start()
 	}
-
-	// Wait until one tick has passed. This is a workaround
-	if rcfg.CliArgs["once"] == "true" {
-		x := 1.2 * float64(rcfg.Interval.Seconds())
-		time.Sleep(time.Duration(int(x)) * time.Second)
-		shutdownSignal <- os.Interrupt
+	if rcfg.ControlServer != nil {
+		rcfg.ControlServer.Start()
 	}
 
+	// Create reload handler
+	reloadSignal := make(chan os.Signal, 1)
+	signal.Notify(reloadSignal, syscall.SIGHUP)
+	rcfg.Sync.Add(1)
+	go reloadHandler(&rcfg, reloadSignal)
+
 	// Wait that all goroutines finish
 	rcfg.Sync.Wait()
 
@@ -122,7 +122,7 @@ func (m *BeegfsMetaCollector) Read(interval time.Duration, output chan lp.CCMess
 		return
 	}
 	//get mounpoint
-	buffer, _ := os.ReadFile(string("/proc/mounts"))
+	buffer, _ := os.ReadFile(m.hostPath("/proc/mounts"))
 	mounts := strings.Split(string(buffer), "\n")
 	var mountpoints []string
 	for _, line := range mounts {
@@ -153,7 +153,7 @@ func (m *BeegfsMetaCollector) Read(interval time.Duration, output chan lp.CCMess
 		// --mount=/mnt/beeond/: Which mount point
 		//cmd := exec.Command(m.config.Beegfs, "/root/mc/test.txt")
 		mountoption := "--mount=" + mountpoint
-		cmd := exec.Command(m.config.Beegfs, "--clientstats",
+		cmd := exec.CommandContext(m.readContext(), m.config.Beegfs, "--clientstats",
 			"--nodetype=meta", mountoption, "--allstats")
 		cmd.Stdin = strings.NewReader("\n")
 		cmdStdout := new(bytes.Buffer)
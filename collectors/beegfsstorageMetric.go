@@ -115,7 +115,7 @@ func (m *BeegfsStorageCollector) Read(interval time.Duration, output chan lp.CCM
 		return
 	}
 	//get mounpoint
-	buffer, _ := os.ReadFile(string("/proc/mounts"))
+	buffer, _ := os.ReadFile(m.hostPath("/proc/mounts"))
 	mounts := strings.Split(string(buffer), "\n")
 	var mountpoints []string
 	for _, line := range mounts {
@@ -145,7 +145,7 @@ func (m *BeegfsStorageCollector) Read(interval time.Duration, output chan lp.CCM
 		// --mount=/mnt/beeond/: Which mount point
 		//cmd := exec.Command(m.config.Beegfs, "/root/mc/test.txt")
 		mountoption := "--mount=" + mountpoint
-		cmd := exec.Command(m.config.Beegfs, "--clientstats",
+		cmd := exec.CommandContext(m.readContext(), m.config.Beegfs, "--clientstats",
 			"--nodetype=storage", mountoption, "--allstats")
 		cmd.Stdin = strings.NewReader("\n")
 		cmdStdout := new(bytes.Buffer)
@@ -0,0 +1,147 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	topo "github.com/ClusterCockpit/cc-metric-collector/pkg/ccTopology"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/hostfs"
+	"github.com/PaesslerAG/gval"
+)
+
+// Language of the 'enabled_if' expressions: the gval language of the router with
+// functions checking the host
+var enabledIfLanguage = gval.NewLanguage(
+	gval.Full(),
+	gval.Function("match", enabledIfMatch),
+	gval.Function("exists", enabledIfExists),
+	gval.Function("getenv", os.Getenv),
+	gval.Function("kernelAtLeast", enabledIfKernelAtLeast),
+)
+
+// enabledIfMatch reports whether the regular expression matches the string. Like in
+// the router, '%' is used instead of '\' in the regular expression (e.g. '%d' for '\d').
+func enabledIfMatch(pattern, s string) (bool, error) {
+	regex, err := regexp.Compile(strings.ReplaceAll(pattern, "%", "\\"))
+	if err != nil {
+		return false, err
+	}
+	return regex.MatchString(s), nil
+}
+
+// enabledIfExists reports whether the path exists. Paths below /proc and /sys
+// are rebased to the global 'procfs_root' and 'sysfs_root'.
+func enabledIfExists(path string) bool {
+	_, err := os.Stat(hostfs.Path(path))
+	return err == nil
+}
+
+// enabledIfKernelAtLeast reports whether the kernel version is at least the given version
+func enabledIfKernelAtLeast(version string) bool {
+	return compareVersions(hostFacts()["kernelVersion"].(string), version) >= 0
+}
+
+// compareVersions compares the leading numeric components of two versions like
+// '5.14.0-362.el9.x86_64' and returns -1, 0 or 1
+func compareVersions(a, b string) int {
+	numbers := func(v string) []int {
+		n := make([]int, 0, 3)
+		for _, part := range strings.Split(v, ".") {
+			end := 0
+			for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+				end++
+			}
+			if end == 0 {
+				break
+			}
+			x, _ := strconv.Atoi(part[:end])
+			n = append(n, x)
+			if end < len(part) {
+				break
+			}
+		}
+		return n
+	}
+	na, nb := numbers(a), numbers(b)
+	for i := 0; i < max(len(na), len(nb)); i++ {
+		var x, y int
+		if i < len(na) {
+			x = na[i]
+		}
+		if i < len(nb) {
+			y = nb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+var (
+	hostFactsOnce sync.Once
+	hostFactsMap  map[string]interface{}
+)
+
+// hostFacts returns the variables of the 'enabled_if' expressions. They are determined
+// once at the first use.
+func hostFacts() map[string]interface{} {
+	hostFactsOnce.Do(func() {
+		fqdn, _ := os.Hostname()
+		osrelease, _ := os.ReadFile(hostfs.Path("/proc/sys/kernel/osrelease"))
+		cinfo := topo.CpuInfo()
+		hostFactsMap = map[string]interface{}{
+			"hostname":       strings.SplitN(fqdn, ".", 2)[0],
+			"fqdn":           fqdn,
+			"kernelVersion":  strings.TrimSpace(string(osrelease)),
+			"numHWThreads":   cinfo.NumHWthreads,
+			"numCores":       cinfo.NumCores,
+			"numSockets":     cinfo.NumSockets,
+			"numNumaDomains": cinfo.NumNumaDomains,
+			"numDies":        cinfo.NumDies,
+			"smtWidth":       cinfo.SMTWidth,
+		}
+	})
+	return hostFactsMap
+}
+
+// parseEnabledIf compiles an 'enabled_if' expression
+func parseEnabledIf(expression string) (gval.Evaluable, error) {
+	eval, err := enabledIfLanguage.NewEvaluable(expression)
+	if err != nil {
+		return nil, fmt.Errorf("enabled_if: %v", err)
+	}
+	return eval, nil
+}
+
+// evalEnabledIf evaluates an 'enabled_if' expression against the host facts.
+// An empty expression is true.
+func evalEnabledIf(expression string) (bool, error) {
+	if len(expression) == 0 {
+		return true, nil
+	}
+	eval, err := parseEnabledIf(expression)
+	if err != nil {
+		return false, err
+	}
+	enabled, err := eval.EvalBool(context.Background(), hostFacts())
+	if err != nil {
+		return false, fmt.Errorf("enabled_if: %v", err)
+	}
+	return enabled, nil
+}
@@ -0,0 +1,146 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package collectors
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/hostfs"
+)
+
+// Configuration keys of a collector configuration block that are handled by the
+// collector manager and not passed to the schema check of the collector
+var managerConfigKeys = []string{"type", "interval", "timeout", "max_failures", "procfs_root", "sysfs_root", "enabled_if"}
+
+// Optional interface for metric collectors that check their configuration
+// beyond its structure (e.g. formulas). It must not initialize the collector.
+type configValidator interface {
+	validateConfig(config json.RawMessage) []error
+}
+
+// configSchema returns the type of the configuration structure of a collector,
+// the type of its field 'config'. For collectors without configuration structure,
+// an empty structure is returned, so any key is reported as unknown.
+func configSchema(collector MetricCollector) reflect.Type {
+	v := reflect.ValueOf(collector)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if f, ok := v.Type().FieldByName("config"); ok {
+		return f.Type
+	}
+	return reflect.TypeOf(struct{}{})
+}
+
+// validateCollectorConfig checks a single collector configuration block against the
+// schema of the collector. Unknown keys and values of the wrong type are reported.
+func validateCollectorConfig(collector MetricCollector, config json.RawMessage) []error {
+	errs := make([]error, 0)
+	if len(config) == 0 {
+		return errs
+	}
+
+	// Check and remove keys handled by the collector manager
+	var keys map[string]json.RawMessage
+	err := json.Unmarshal(config, &keys)
+	if err != nil {
+		return append(errs, err)
+	}
+	if _, err := collectorInterval(keys["interval"], 0); err != nil {
+		errs = append(errs, err)
+	}
+	if f, ok := keys["max_failures"]; ok {
+		var maxFailures int
+		if err := json.Unmarshal(f, &maxFailures); err != nil || maxFailures < 0 {
+			errs = append(errs, fmt.Errorf("max_failures: must be a non-negative number: %s", string(f)))
+		}
+	}
+	if t, ok := keys["timeout"]; ok {
+		var timeout string
+		err := json.Unmarshal(t, &timeout)
+		if err == nil {
+			_, err = collectorTimeout(timeout)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if e, ok := keys["enabled_if"]; ok {
+		var expression string
+		err := json.Unmarshal(e, &expression)
+		if err == nil {
+			_, err = parseEnabledIf(expression)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	var roots hostfs.Roots
+	if err := json.Unmarshal(config, &roots); err != nil {
+		errs = append(errs, err)
+	} else {
+		errs = append(errs, roots.Validate()...)
+	}
+	for _, k := range managerConfigKeys {
+		delete(keys, k)
+	}
+	stripped, err := json.Marshal(keys)
+	if err != nil {
+		return append(errs, err)
+	}
+
+	d := json.NewDecoder(bytes.NewReader(stripped))
+	d.DisallowUnknownFields()
+	err = d.Decode(reflect.New(configSchema(collector)).Interface())
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if v, ok := collector.(configValidator); ok {
+		errs = append(errs, v.validateConfig(stripped)...)
+	}
+	return errs
+}
+
+// ValidateConfig checks the collectors configuration without initializing any collector.
+// All errors are returned with the name of the collector as context.
+func ValidateConfig(collectConfig json.RawMessage) []error {
+	errs := make([]error, 0)
+	var config map[string]json.RawMessage
+	err := json.Unmarshal(collectConfig, &config)
+	if err != nil {
+		return append(errs, err)
+	}
+
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		collectorType, _, err := collectorTypeOf(name, config[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			continue
+		}
+		newCollector, found := AvailableCollectors[collectorType]
+		if !found {
+			errs = append(errs, fmt.Errorf("%s: unknown collector type '%s'", name, collectorType))
+			continue
+		}
+		for _, err := range validateCollectorConfig(newCollector(), config[name]) {
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,356 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package collectors
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Modes of the input recording
+const (
+	INPUTS_LIVE   = ""       // collectors read the system
+	INPUTS_RECORD = "record" // collectors read the system and their inputs are recorded
+	INPUTS_REPLAY = "replay" // collectors read recorded inputs
+)
+
+// Directory names of the recorded inputs. The inputs of the initialization are stored
+// in INPUTS_INIT_DIR, the inputs of each read cycle in INPUTS_READ_DIR with the
+// sequence number of the cycle. Each directory contains one file per collector and
+// the file INPUTS_TICK_FILE with the timestamp of the read cycle.
+const (
+	INPUTS_INIT_DIR  = "init"
+	INPUTS_READ_DIR  = "read-%06d"
+	INPUTS_TICK_FILE = "tick.json"
+)
+
+var inputsConfig struct {
+	mode string // INPUTS_LIVE, INPUTS_RECORD or INPUTS_REPLAY
+	dir  string // directory of the recorded inputs
+}
+
+// RecordInputs records all files, directory listings, command outputs and timestamps
+// read by the collectors supporting it in the given directory
+func RecordInputs(dir string) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+	inputsConfig.mode = INPUTS_RECORD
+	inputsConfig.dir = dir
+	return nil
+}
+
+// ReplayInputs lets the collectors read the inputs recorded in the given directory
+// instead of the system
+func ReplayInputs(dir string) error {
+	info, err := os.Stat(filepath.Join(dir, INPUTS_INIT_DIR))
+	if err != nil {
+		return fmt.Errorf("no recorded inputs in %s: %v", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("no recorded inputs in %s", dir)
+	}
+	inputsConfig.mode = INPUTS_REPLAY
+	inputsConfig.dir = dir
+	return nil
+}
+
+// RecordedTick is a recorded read cycle of all collectors
+type RecordedTick struct {
+	Timestamp int64 `json:"timestamp"` // time of the read cycle in unix nanoseconds
+	Warmup    bool  `json:"warmup"`    // whether the metrics of the read cycle were discarded
+}
+
+// Time returns the time of the read cycle
+func (t RecordedTick) Time() time.Time {
+	return time.Unix(0, t.Timestamp)
+}
+
+// RecordedTicks returns all recorded read cycles in the given directory
+func RecordedTicks(dir string) ([]RecordedTick, error) {
+	dirs, err := filepath.Glob(filepath.Join(dir, "read-[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(dirs)
+	ticks := make([]RecordedTick, 0, len(dirs))
+	for i, d := range dirs {
+		if filepath.Base(d) != fmt.Sprintf(INPUTS_READ_DIR, i+1) {
+			return nil, fmt.Errorf("missing read cycle %d in %s", i+1, dir)
+		}
+		var tick RecordedTick
+		raw, err := os.ReadFile(filepath.Join(d, INPUTS_TICK_FILE))
+		if err == nil {
+			err = json.Unmarshal(raw, &tick)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", d, err)
+		}
+		ticks = append(ticks, tick)
+	}
+	return ticks, nil
+}
+
+// Inputs of a collector recorded during one Init() or Read()
+type recordedInputs struct {
+	Timestamps []int64                    `json:"timestamps,omitempty"` // results of now() in unix nanoseconds
+	Files      map[string]recordedFile    `json:"files,omitempty"`      // file contents by path
+	Globs      map[string][]string        `json:"globs,omitempty"`      // matches by pattern
+	Commands   map[string]recordedCommand `json:"commands,omitempty"`   // outputs by command line
+	next       int                        // index of the next timestamp to replay
+}
+
+// Recorded content of a file
+type recordedFile struct {
+	Data     string `json:"data,omitempty"`
+	Error    string `json:"error,omitempty"`
+	NotExist bool   `json:"not_exist,omitempty"`
+}
+
+// Recorded output of a command
+type recordedCommand struct {
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Interface of metric collectors whose inputs can be recorded and replayed
+type inputRecorder interface {
+	recordsInputs() bool
+	startInputs(inputs *recordedInputs, replay bool)
+	stopInputs() *recordedInputs
+}
+
+// enableInputRecording marks the collector as reading all its inputs with the helpers
+// readFile(), openFile(), glob(), command() and now(), so they can be recorded and replayed.
+// It has to be called in Init().
+func (c *metricCollector) enableInputRecording() {
+	c.recordable = true
+}
+
+// recordsInputs returns whether the collector supports recording its inputs
+func (c *metricCollector) recordsInputs() bool {
+	return c.recordable
+}
+
+// startInputs starts recording inputs or replaying the given inputs
+func (c *metricCollector) startInputs(inputs *recordedInputs, replay bool) {
+	c.inputsLock.Lock()
+	defer c.inputsLock.Unlock()
+	c.inputs = inputs
+	c.replay = replay
+}
+
+// stopInputs stops recording or replaying and returns the inputs
+func (c *metricCollector) stopInputs() *recordedInputs {
+	c.inputsLock.Lock()
+	defer c.inputsLock.Unlock()
+	inputs := c.inputs
+	c.inputs = nil
+	c.replay = false
+	return inputs
+}
+
+// replaying returns whether the collector reads recorded inputs. Collectors can use it
+// to skip checks of the system, like the existence of commands.
+func (c *metricCollector) replaying() bool {
+	c.inputsLock.Lock()
+	defer c.inputsLock.Unlock()
+	return c.inputs != nil && c.replay
+}
+
+// inputTime records or replays a timestamp. It returns false if neither recording nor replaying.
+func (c *metricCollector) inputTime(live func() time.Time) (time.Time, bool) {
+	c.inputsLock.Lock()
+	defer c.inputsLock.Unlock()
+	if c.inputs == nil {
+		return time.Time{}, false
+	}
+	if c.replay {
+		if c.inputs.next < len(c.inputs.Timestamps) {
+			t := time.Unix(0, c.inputs.Timestamps[c.inputs.next])
+			c.inputs.next++
+			return t, true
+		}
+		return live(), true
+	}
+	t := live()
+	c.inputs.Timestamps = append(c.inputs.Timestamps, t.UnixNano())
+	return t, true
+}
+
+// readFile reads a file like os.ReadFile. Paths below /proc and /sys are rebased
+// to 'procfs_root' and 'sysfs_root'.
+func (c *metricCollector) readFile(path string) ([]byte, error) {
+	c.inputsLock.Lock()
+	defer c.inputsLock.Unlock()
+	if c.inputs == nil {
+		return os.ReadFile(c.hostPath(path))
+	}
+	if c.replay {
+		f, ok := c.inputs.Files[path]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("file %s: %w", path, fs.ErrNotExist)
+		case f.NotExist:
+			return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+		case len(f.Error) > 0:
+			return nil, errors.New(f.Error)
+		}
+		return []byte(f.Data), nil
+	}
+	data, err := os.ReadFile(c.hostPath(path))
+	f := recordedFile{Data: string(data)}
+	if err != nil {
+		f.NotExist = errors.Is(err, fs.ErrNotExist)
+		f.Error = err.Error()
+	}
+	if c.inputs.Files == nil {
+		c.inputs.Files = make(map[string]recordedFile)
+	}
+	c.inputs.Files[path] = f
+	return data, err
+}
+
+// openFile opens a file for reading like os.Open. Paths below /proc and /sys are
+// rebased to 'procfs_root' and 'sysfs_root'.
+func (c *metricCollector) openFile(path string) (io.ReadCloser, error) {
+	c.inputsLock.Lock()
+	recording := c.inputs != nil
+	c.inputsLock.Unlock()
+	if !recording {
+		return os.Open(c.hostPath(path))
+	}
+	data, err := c.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// glob returns the paths matching the pattern like filepath.Glob. Patterns below /proc
+// and /sys are rebased to 'procfs_root' and 'sysfs_root', the matches are returned
+// below /proc and /sys.
+func (c *metricCollector) glob(pattern string) ([]string, error) {
+	c.inputsLock.Lock()
+	defer c.inputsLock.Unlock()
+	if c.inputs != nil && c.replay {
+		return c.inputs.Globs[pattern], nil
+	}
+	matches, err := filepath.Glob(c.hostPath(pattern))
+	if err != nil {
+		return nil, err
+	}
+	for i := range matches {
+		matches[i] = c.roots.Original(matches[i])
+	}
+	if c.inputs != nil {
+		if c.inputs.Globs == nil {
+			c.inputs.Globs = make(map[string][]string)
+		}
+		c.inputs.Globs[pattern] = matches
+	}
+	return matches, nil
+}
+
+// command runs an external command with the context of the current read and returns
+// its standard output like exec.Cmd.Output()
+func (c *metricCollector) command(name string, args ...string) ([]byte, error) {
+	key := strings.Join(append([]string{name}, args...), " ")
+	c.inputsLock.Lock()
+	inputs, replay := c.inputs, c.replay
+	c.inputsLock.Unlock()
+	if inputs != nil && replay {
+		c.inputsLock.Lock()
+		defer c.inputsLock.Unlock()
+		r, ok := inputs.Commands[key]
+		if !ok {
+			return nil, fmt.Errorf("command '%s' was not recorded", key)
+		}
+		if len(r.Error) > 0 {
+			return []byte(r.Output), errors.New(r.Error)
+		}
+		return []byte(r.Output), nil
+	}
+	output, err := exec.CommandContext(c.readContext(), name, args...).Output()
+	if inputs != nil {
+		r := recordedCommand{Output: string(output)}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		c.inputsLock.Lock()
+		if inputs.Commands == nil {
+			inputs.Commands = make(map[string]recordedCommand)
+		}
+		inputs.Commands[key] = r
+		c.inputsLock.Unlock()
+	}
+	return output, err
+}
+
+// inputsFile returns the file of the recorded inputs of a collector. A sequence
+// number of zero denotes the initialization.
+func inputsFile(collectorName string, seq int) string {
+	dir := INPUTS_INIT_DIR
+	if seq > 0 {
+		dir = fmt.Sprintf(INPUTS_READ_DIR, seq)
+	}
+	return filepath.Join(inputsConfig.dir, dir, collectorName+".json")
+}
+
+// loadInputs loads the recorded inputs of a collector for replaying
+func loadInputs(collectorName string, seq int) (*recordedInputs, error) {
+	raw, err := os.ReadFile(inputsFile(collectorName, seq))
+	if err != nil {
+		return nil, err
+	}
+	inputs := new(recordedInputs)
+	err = json.Unmarshal(raw, inputs)
+	if err != nil {
+		return nil, err
+	}
+	return inputs, nil
+}
+
+// saveInputs writes the recorded inputs of a collector
+func saveInputs(collectorName string, seq int, inputs *recordedInputs) error {
+	filename := inputsFile(collectorName, seq)
+	err := os.MkdirAll(filepath.Dir(filename), 0o755)
+	if err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(inputs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, raw, 0o644)
+}
+
+// saveTick writes the time of a recorded read cycle
+func saveTick(seq int, t time.Time, warmup bool) error {
+	dir := filepath.Join(inputsConfig.dir, fmt.Sprintf(INPUTS_READ_DIR, seq))
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(RecordedTick{Timestamp: t.UnixNano(), Warmup: warmup})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, INPUTS_TICK_FILE), raw, 0o644)
+}
@@ -8,52 +8,232 @@
 package collectors
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	cclog "github.com/ClusterCockpit/cc-lib/ccLogger"
 	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+	bp "github.com/ClusterCockpit/cc-metric-collector/pkg/backPressure"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/clock"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/hostfs"
 	mct "github.com/ClusterCockpit/cc-metric-collector/pkg/multiChanTicker"
 )
 
-// Map of all available metric collectors
-var AvailableCollectors = map[string]MetricCollector{
-
-	"likwid":          new(LikwidCollector),
-	"loadavg":         new(LoadavgCollector),
-	"memstat":         new(MemstatCollector),
-	"netstat":         new(NetstatCollector),
-	"ibstat":          new(InfinibandCollector),
-	"lustrestat":      new(LustreCollector),
-	"cpustat":         new(CpustatCollector),
-	"topprocs":        new(TopProcsCollector),
-	"nvidia":          new(NvidiaCollector),
-	"customcmd":       new(CustomCmdCollector),
-	"iostat":          new(IOstatCollector),
-	"diskstat":        new(DiskstatCollector),
-	"tempstat":        new(TempCollector),
-	"ipmistat":        new(IpmiCollector),
-	"gpfs":            new(GpfsCollector),
-	"cpufreq":         new(CPUFreqCollector),
-	"cpufreq_cpuinfo": new(CPUFreqCpuInfoCollector),
-	"nfs3stat":        new(Nfs3Collector),
-	"nfs4stat":        new(Nfs4Collector),
-	"numastats":       new(NUMAStatsCollector),
-	"beegfs_meta":     new(BeegfsMetaCollector),
-	"beegfs_storage":  new(BeegfsStorageCollector),
-	"rapl":            new(RAPLCollector),
-	"rocm_smi":        new(RocmSmiCollector),
-	"self":            new(SelfCollector),
-	"schedstat":       new(SchedstatCollector),
-	"nfsiostat":       new(NfsIOStatCollector),
+// Map of all available metric collectors. Each configured collector gets a new instance.
+var AvailableCollectors = map[string]func() MetricCollector{
+
+	"likwid":          func() MetricCollector { return new(LikwidCollector) },
+	"loadavg":         func() MetricCollector { return new(LoadavgCollector) },
+	"memstat":         func() MetricCollector { return new(MemstatCollector) },
+	"netstat":         func() MetricCollector { return new(NetstatCollector) },
+	"ibstat":          func() MetricCollector { return new(InfinibandCollector) },
+	"lustrestat":      func() MetricCollector { return new(LustreCollector) },
+	"cpustat":         func() MetricCollector { return new(CpustatCollector) },
+	"topprocs":        func() MetricCollector { return new(TopProcsCollector) },
+	"nvidia":          func() MetricCollector { return new(NvidiaCollector) },
+	"customcmd":       func() MetricCollector { return new(CustomCmdCollector) },
+	"iostat":          func() MetricCollector { return new(IOstatCollector) },
+	"diskstat":        func() MetricCollector { return new(DiskstatCollector) },
+	"tempstat":        func() MetricCollector { return new(TempCollector) },
+	"ipmistat":        func() MetricCollector { return new(IpmiCollector) },
+	"gpfs":            func() MetricCollector { return new(GpfsCollector) },
+	"cpufreq":         func() MetricCollector { return new(CPUFreqCollector) },
+	"cpufreq_cpuinfo": func() MetricCollector { return new(CPUFreqCpuInfoCollector) },
+	"nfs3stat":        func() MetricCollector { return new(Nfs3Collector) },
+	"nfs4stat":        func() MetricCollector { return new(Nfs4Collector) },
+	"numastats":       func() MetricCollector { return new(NUMAStatsCollector) },
+	"beegfs_meta":     func() MetricCollector { return new(BeegfsMetaCollector) },
+	"beegfs_storage":  func() MetricCollector { return new(BeegfsStorageCollector) },
+	"rapl":            func() MetricCollector { return new(RAPLCollector) },
+	"rocm_smi":        func() MetricCollector { return new(RocmSmiCollector) },
+	"self":            func() MetricCollector { return new(SelfCollector) },
+	"schedstat":       func() MetricCollector { return new(SchedstatCollector) },
+	"nfsiostat":       func() MetricCollector { return new(NfsIOStatCollector) },
+	"plugin":          func() MetricCollector { return new(PluginCollector) },
+}
+
+// Delays between two attempts to initialize a metric collector whose initialization failed.
+// The delay is doubled after each failed attempt.
+const (
+	INIT_RETRY_MIN_DELAY = 10 * time.Second
+	INIT_RETRY_MAX_DELAY = time.Hour
+)
+
+// Maximal time to wait for a stalled read to return before closing a metric collector
+const STALLED_CLOSE_TIMEOUT = 10 * time.Second
+
+// Management information of a configured metric collector
+type collectorEntry struct {
+	name         string          // name of the collector in the configuration
+	instance     string          // instance name if the collector type is configured multiple times
+	collector    MetricCollector // metric collector
+	config       json.RawMessage // json encoded config of the metric collector
+	enabled      bool            // whether the metric collector is read each interval
+	initialized  bool            // whether the metric collector is initialized, see updateState()
+	parallel     bool            // whether the metric collector is read in parallel with others
+	every        int             // read the metric collector every n-th tick
+	ticks        int             // number of ticks since the last read
+	skipped      uint64          // number of read intervals skipped before the next read
+	timeout      time.Duration   // maximal duration of a read (0 = unlimited)
+	pending      chan readResult // receives the result of a read that exceeded the timeout
+	stalled      atomic.Bool     // whether a read exceeded the timeout and did not return yet
+	timeouts     atomic.Uint64   // number of reads that exceeded the timeout
+	maxFailures  int             // disable the metric collector after this number of consecutive failed reads (0 = never)
+	failures     int             // number of consecutive failed reads
+	errors       atomic.Uint64   // number of failed reads
+	lastError    string          // error of the last failed read
+	initFailures int             // number of consecutive failed initializations
+	nextInit     time.Time       // time of the next initialization attempt (zero = no retry)
+	lastRead     time.Time       // start time of the last read
+	lastDuration atomic.Int64    // duration of the last read in nanoseconds
+	messages     atomic.Uint64   // number of messages sent by the metric collector
+	blocked      atomic.Int64    // time spent waiting for the output channel in nanoseconds
+}
+
+// Result of a read of a metric collector
+type readResult struct {
+	duration time.Duration // duration of the read
+	err      error         // error reported by the metric collector or recovered panic
+}
+
+// Configuration options of a metric collector handled by the collector manager
+type collectorEntryConfig struct {
+	Type        string          `json:"type,omitempty"`         // collector type if the name is not a collector type
+	Interval    json.RawMessage `json:"interval,omitempty"`     // read interval as multiple of the base interval or as duration
+	Timeout     string          `json:"timeout,omitempty"`      // maximal duration of a read
+	MaxFailures int             `json:"max_failures,omitempty"` // disable after this number of consecutive failed reads
+	ProcfsRoot  string          `json:"procfs_root,omitempty"`  // procfs directory overriding the global one
+	SysfsRoot   string          `json:"sysfs_root,omitempty"`   // sysfs directory overriding the global one
+	EnabledIf   string          `json:"enabled_if,omitempty"`   // expression on host facts, the collector is skipped if false
+}
+
+// collectorTimeout parses the read timeout of a collector
+func collectorTimeout(timeout string) (time.Duration, error) {
+	if len(timeout) == 0 {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, fmt.Errorf("timeout: %v", err)
+	}
+	if d <= 0 {
+		return 0, errors.New("timeout: must be greater than zero")
+	}
+	return d, nil
+}
+
+// collectorTypeOf returns the collector type and the instance name of a configured collector.
+// The type is given by the 'type' option or by the part of the name before '@'
+// (like 'customcmd@slurm'), otherwise the name is the type. For all names that
+// are not a collector type, the instance name is the name without the 'type@' prefix.
+func collectorTypeOf(collectorName string, collectorCfg json.RawMessage) (string, string, error) {
+	var entryCfg collectorEntryConfig
+	if len(collectorCfg) > 0 {
+		err := json.Unmarshal(collectorCfg, &entryCfg)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	collectorType := entryCfg.Type
+	if len(collectorType) == 0 {
+		collectorType, _, _ = strings.Cut(collectorName, "@")
+	}
+	if collectorName == collectorType {
+		return collectorType, "", nil
+	}
+	return collectorType, strings.TrimPrefix(collectorName, collectorType+"@"), nil
+}
+
+// collectorInterval returns the number of ticks between two reads of a collector.
+// The interval is given either as multiple of the base interval (number) or as duration
+// (string like '60s'), which is rounded up to a multiple of the base interval.
+// Without base interval (manually triggered ticks), the collector is read each tick.
+func collectorInterval(interval json.RawMessage, base time.Duration) (int, error) {
+	if len(interval) == 0 {
+		return 1, nil
+	}
+	var multiple int
+	if err := json.Unmarshal(interval, &multiple); err == nil {
+		if multiple < 1 {
+			return 0, errors.New("interval: multiple of the base interval must be at least 1")
+		}
+		return multiple, nil
+	}
+	var str string
+	if err := json.Unmarshal(interval, &str); err != nil {
+		return 0, fmt.Errorf("interval: must be a multiple of the base interval or a duration: %s", string(interval))
+	}
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, fmt.Errorf("interval: %v", err)
+	}
+	if d <= 0 {
+		return 0, errors.New("interval: must be greater than zero")
+	}
+	if base <= 0 {
+		return 1, nil
+	}
+	every := int((d + base - 1) / base)
+	if time.Duration(every)*base != d {
+		cclog.ComponentDebug("CollectorManager", "Interval", d, "rounded up to", time.Duration(every)*base)
+	}
+	return every, nil
+}
+
+// due counts the ticks and reports whether the collector has to be read at this tick
+func (e *collectorEntry) due() bool {
+	e.ticks++
+	if e.ticks < e.every {
+		return false
+	}
+	e.skipped = uint64(e.ticks/e.every - 1)
+	e.ticks = 0
+	return true
+}
+
+// missTicks accounts ticks the collector manager missed because it was busy
+func (e *collectorEntry) missTicks(missed uint64) {
+	e.ticks += int(missed)
+}
+
+// Runtime information of a configured metric collector
+type CollectorInfo struct {
+	Name             string    `json:"name"`               // Name of the collector in the configuration
+	Initialized      bool      `json:"initialized"`        // Is metric collector initialized?
+	Enabled          bool      `json:"enabled"`            // Is metric collector read each interval?
+	Parallel         bool      `json:"parallel"`           // Is metric collector read in parallel with others?
+	Interval         string    `json:"interval"`           // Effective read interval
+	LastRead         time.Time `json:"last_read"`          // Start time of the last read
+	LastReadDuration string    `json:"last_read_duration"` // Duration of the last read
+	Stalled          bool      `json:"stalled"`            // Did the last read exceed the timeout and not return yet?
+	Timeouts         uint64    `json:"timeouts"`           // Number of reads that exceeded the timeout
+	Errors           uint64    `json:"errors"`             // Number of failed reads (errors, panics, timeouts)
+	Messages         uint64    `json:"messages"`           // Number of messages sent
+	BlockedTime      string    `json:"blocked_time"`       // Time spent waiting for the router channel
+	Failures         int       `json:"failures"`           // Number of consecutive failed reads
+	LastError        string    `json:"last_error,omitempty"`
+	NextInit         time.Time `json:"next_init,omitzero"` // Time of the next initialization attempt
+}
+
+// Interface for metric collectors that report about the other collectors
+type collectorManagerUser interface {
+	setCollectorManager(cm *collectorManager)
 }
 
 // Metric collector manager data structure
 type collectorManager struct {
-	collectors   []MetricCollector          // List of metric collectors to read in parallel
-	serial       []MetricCollector          // List of metric collectors to read serially
+	entries      map[string]*collectorEntry // Map of collector name to configured metric collector
 	output       chan lp.CCMessage          // Output channels
+	sender       bp.Sender                  // Sender applying the back-pressure policy of the output channel
 	done         chan bool                  // channel to finish / stop metric collector manager
 	ticker       mct.MultiChanTicker        // periodically ticking once each interval
 	duration     time.Duration              // duration (for metrics that measure over a given duration)
@@ -61,13 +241,25 @@ type collectorManager struct {
 	config       map[string]json.RawMessage // json encoded config for collector manager
 	collector_wg sync.WaitGroup             // internally used wait group for the parallel reading of collector
 	parallel_run bool                       // Flag whether the collectors are currently read in parallel
+	readLock     sync.Mutex                 // Lock serializing the read cycles, reloading and closing the collectors
+	lock         sync.Mutex                 // Lock for the collector entries and their state reported by the control API
+	started      bool                       // Flag whether the ticker driven reading was started
+	readSeq      int                        // Sequence number of the read cycle for recording and replaying inputs
+	warmup       bool                       // Flag whether the current read cycle is the warmup
 }
 
 // Metric collector manager access functions
 type CollectorManager interface {
 	Init(ticker mct.MultiChanTicker, duration time.Duration, wg *sync.WaitGroup, collectConfig json.RawMessage) error
 	AddOutput(output chan lp.CCMessage)
+	SetOutputPolicy(channel string, policy string) error
 	Start()
+	Reload(collectConfig json.RawMessage) error
+	Collectors() []CollectorInfo
+	SetEnabled(collectorName string, enabled bool) error
+	ReadNow(collectorName string) error
+	Warmup()
+	Failed() []string
 	Close()
 }
 
@@ -79,8 +271,7 @@ type CollectorManager interface {
 // * configuration (read from config file in variable collectConfigFile)
 // Initialization is done for all configured collectors
 func (cm *collectorManager) Init(ticker mct.MultiChanTicker, duration time.Duration, wg *sync.WaitGroup, collectConfig json.RawMessage) error {
-	cm.collectors = make([]MetricCollector, 0)
-	cm.serial = make([]MetricCollector, 0)
+	cm.entries = make(map[string]*collectorEntry)
 	cm.output = nil
 	cm.done = make(chan bool)
 	cm.wg = wg
@@ -95,32 +286,575 @@ func (cm *collectorManager) Init(ticker mct.MultiChanTicker, duration time.Durat
 
 	// Initialize configured collectors
 	for collectorName, collectorCfg := range cm.config {
-		if _, found := AvailableCollectors[collectorName]; !found {
-			cclog.ComponentError("CollectorManager", "SKIP unknown collector", collectorName)
-			continue
+		if e := cm.newEntry(collectorName, collectorCfg); e != nil {
+			cm.entries[collectorName] = e
+		}
+	}
+	return nil
+}
+
+// newEntry creates the entry of a configured metric collector and initializes the metric
+// collector. It returns nil if the collector is skipped. The entry is not added to the
+// configured metric collectors, so the initialization does not hold the lock.
+func (cm *collectorManager) newEntry(collectorName string, collectorCfg json.RawMessage) *collectorEntry {
+	collectorType, instance, err := collectorTypeOf(collectorName, collectorCfg)
+	if err != nil {
+		cclog.ComponentError("CollectorManager", "SKIP collector", collectorName+":", err.Error())
+		return nil
+	}
+	newCollector, found := AvailableCollectors[collectorType]
+	if !found {
+		cclog.ComponentError("CollectorManager", "SKIP unknown collector", collectorName)
+		return nil
+	}
+	e := &collectorEntry{
+		name:      collectorName,
+		instance:  instance,
+		collector: newCollector(),
+		config:    collectorCfg,
+		enabled:   true,
+		every:     1,
+	}
+
+	var entryCfg collectorEntryConfig
+	err = json.Unmarshal(collectorCfg, &entryCfg)
+	if err == nil {
+		// Skip collectors not intended for this host
+		var enabled bool
+		enabled, err = evalEnabledIf(entryCfg.EnabledIf)
+		if err == nil && !enabled {
+			cclog.ComponentDebug("CollectorManager", "SKIP collector", collectorName, "on this host, enabled_if is false:", entryCfg.EnabledIf)
+			return nil
 		}
-		collector := AvailableCollectors[collectorName]
+	}
+	if err == nil {
+		e.every, err = collectorInterval(entryCfg.Interval, cm.ticker.Interval())
+	}
+	if err == nil {
+		e.timeout, err = collectorTimeout(entryCfg.Timeout)
+	}
+	if err == nil && entryCfg.MaxFailures < 0 {
+		err = errors.New("max_failures: must not be negative")
+	}
+	if err != nil {
+		cclog.ComponentError("CollectorManager", "Collector", collectorName, "initialization failed:", err.Error())
+		return e
+	}
+	e.maxFailures = entryCfg.MaxFailures
+	// Read the collector at the first tick
+	e.ticks = e.every - 1
 
-		err = collector.Init(collectorCfg)
+	if u, ok := e.collector.(collectorManagerUser); ok {
+		u.setCollectorManager(cm)
+	}
+	if s, ok := e.collector.(readIntervalSetter); ok {
+		s.setReadInterval(time.Duration(e.every) * cm.ticker.Interval())
+	}
+	if s, ok := e.collector.(clockSetter); ok {
+		s.setClock(cm.ticker.Clock())
+	}
+	if s, ok := e.collector.(hostRootsSetter); ok {
+		s.setHostRoots(hostfs.Roots{Procfs: entryCfg.ProcfsRoot, Sysfs: entryCfg.SysfsRoot})
+	}
+	err = cm.initEntry(e)
+	e.initialized, e.parallel = e.collector.Initialized(), e.collector.Parallel()
+	if err != nil {
+		cclog.ComponentError("CollectorManager", "Collector", collectorName, "initialization failed:", err.Error())
+		cm.scheduleInit(e, cm.ticker.Clock().Now())
+		return e
+	}
+	cclog.ComponentDebug("CollectorManager", "ADD COLLECTOR", e.collector.Name())
+	return e
+}
+
+// updateState copies the state of the metric collector to its entry. The state reported
+// by the control API is read from the entries holding the lock, while the metric
+// collectors are initialized, read and closed without holding it. The caller has to own
+// the metric collector, i.e. hold the read lock or own a closed entry, and not read it.
+func (cm *collectorManager) updateState(e *collectorEntry) {
+	initialized, parallel := e.collector.Initialized(), e.collector.Parallel()
+	cm.lock.Lock()
+	e.initialized, e.parallel = initialized, parallel
+	cm.lock.Unlock()
+}
+
+// initEntry initializes the metric collector of an entry. A panic during the
+// initialization is recovered and returned as error.
+func (cm *collectorManager) initEntry(e *collectorEntry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic in Init(): %v", r)
+		}
+	}()
+	// Commands started during the initialization must not use the context of a previous read
+	if s, ok := e.collector.(readContextSetter); ok {
+		s.setReadContext(context.Background())
+	}
+	r, ok := e.collector.(inputRecorder)
+	if !ok || inputsConfig.mode == INPUTS_LIVE {
+		return e.collector.Init(e.config)
+	}
+	if inputsConfig.mode == INPUTS_REPLAY {
+		inputs, err := loadInputs(e.name, 0)
+		if err != nil {
+			return fmt.Errorf("no recorded inputs: %v", err)
+		}
+		r.startInputs(inputs, true)
+		defer r.stopInputs()
+		return e.collector.Init(e.config)
+	}
+	r.startInputs(new(recordedInputs), false)
+	err = e.collector.Init(e.config)
+	inputs := r.stopInputs()
+	if err != nil {
+		return err
+	}
+	if !r.recordsInputs() {
+		cclog.ComponentError("CollectorManager", "Collector", e.name, "does not support recording its inputs, it cannot be replayed")
+		return nil
+	}
+	if err := saveInputs(e.name, 0, inputs); err != nil {
+		cclog.ComponentError("CollectorManager", "Failed to save inputs of collector", e.name+":", err.Error())
+	}
+	return nil
+}
+
+// startReadInputs starts recording or replaying the inputs of a read of a metric collector.
+// It returns a function to finish the recording, or false if the read has to be skipped
+// because no inputs were recorded for it.
+func (cm *collectorManager) startReadInputs(e *collectorEntry) (func(), bool) {
+	r, ok := e.collector.(inputRecorder)
+	if !ok || inputsConfig.mode == INPUTS_LIVE {
+		return func() {}, true
+	}
+	seq := cm.readSeq
+	if inputsConfig.mode == INPUTS_REPLAY {
+		inputs, err := loadInputs(e.name, seq)
 		if err != nil {
-			cclog.ComponentError("CollectorManager", "Collector", collectorName, "initialization failed:", err.Error())
+			cclog.ComponentDebug("CollectorManager", "SKIP collector", e.name, "without recorded inputs:", err.Error())
+			return nil, false
+		}
+		r.startInputs(inputs, true)
+		return func() { r.stopInputs() }, true
+	}
+	if !r.recordsInputs() {
+		return func() {}, true
+	}
+	r.startInputs(new(recordedInputs), false)
+	return func() {
+		if err := saveInputs(e.name, seq, r.stopInputs()); err != nil {
+			cclog.ComponentError("CollectorManager", "Failed to save inputs of collector", e.name+":", err.Error())
+		}
+	}, true
+}
+
+// nextReadCycle starts a new read cycle for recording and replaying inputs.
+// The caller has to hold the read lock.
+func (cm *collectorManager) nextReadCycle(t time.Time) {
+	if inputsConfig.mode == INPUTS_LIVE {
+		return
+	}
+	cm.readSeq++
+	if inputsConfig.mode == INPUTS_RECORD {
+		if err := saveTick(cm.readSeq, t, cm.warmup); err != nil {
+			cclog.ComponentError("CollectorManager", "Failed to save read cycle", cm.readSeq, ":", err.Error())
+		}
+	}
+}
+
+// scheduleInit schedules the next initialization attempt of a metric collector whose
+// initialization failed. The delay starts with INIT_RETRY_MIN_DELAY and is doubled
+// for each failed attempt up to INIT_RETRY_MAX_DELAY.
+func (cm *collectorManager) scheduleInit(e *collectorEntry, t time.Time) {
+	delay := INIT_RETRY_MIN_DELAY
+	for i := 0; i < e.initFailures && delay < INIT_RETRY_MAX_DELAY; i++ {
+		delay *= 2
+	}
+	delay = min(delay, INIT_RETRY_MAX_DELAY)
+	e.initFailures++
+	e.nextInit = t.Add(delay)
+	cclog.ComponentDebug("CollectorManager", "Retry initialization of collector", e.name, "in", delay)
+}
+
+// retryInit retries the initialization of all enabled metric collectors whose
+// initialization failed and whose retry delay elapsed. The caller has to hold the read
+// lock, but not the lock.
+func (cm *collectorManager) retryInit(t time.Time) {
+	cm.lock.Lock()
+	retry := make([]*collectorEntry, 0)
+	for _, e := range cm.entries {
+		if !e.enabled || e.initialized || e.nextInit.IsZero() || t.Before(e.nextInit) {
 			continue
 		}
-		cclog.ComponentDebug("CollectorManager", "ADD COLLECTOR", collector.Name())
-		if collector.Parallel() {
-			cm.collectors = append(cm.collectors, collector)
+		retry = append(retry, e)
+	}
+	cm.lock.Unlock()
+	for _, e := range retry {
+		err := cm.initEntry(e)
+		cm.updateState(e)
+		cm.lock.Lock()
+		if err != nil {
+			cclog.ComponentError("CollectorManager", "Collector", e.name, "initialization failed again:", err.Error())
+			cm.scheduleInit(e, t)
 		} else {
-			cm.serial = append(cm.serial, collector)
+			cclog.ComponentDebug("CollectorManager", "Collector", e.name, "initialized after", e.initFailures, "failed attempts")
+			e.initFailures = 0
+			e.nextInit = time.Time{}
 		}
+		cm.lock.Unlock()
+	}
+}
+
+// recordResult records the result of a read. After 'max_failures' consecutive
+// failed reads, the metric collector is disabled.
+func (cm *collectorManager) recordResult(e *collectorEntry, res readResult) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	e.lastDuration.Store(int64(res.duration))
+	if res.err == nil {
+		e.failures = 0
+		return
+	}
+	e.errors.Add(1)
+	e.failures++
+	e.lastError = res.err.Error()
+	if e.maxFailures > 0 && e.failures >= e.maxFailures {
+		e.enabled = false
+		cclog.ComponentError("CollectorManager", "Collector", e.name, "disabled after", e.failures, "consecutive failed reads, last error:", e.lastError)
+	}
+}
+
+// closeEntry closes the metric collector of an entry. A metric collector must not be
+// closed while it is read, so closeEntry waits up to STALLED_CLOSE_TIMEOUT for a stalled
+// read to return. If it does not return in time, the metric collector is closed after the
+// read returned. Like the context of the reads, the wait uses the real time.
+// The caller has to hold the read lock, but not the lock.
+func (cm *collectorManager) closeEntry(e *collectorEntry) {
+	if e.pending != nil {
+		pending := e.pending
+		e.pending = nil
+		timer := time.NewTimer(STALLED_CLOSE_TIMEOUT)
+		defer timer.Stop()
+		select {
+		case <-pending:
+			e.stalled.Store(false)
+		case <-timer.C:
+			cclog.ComponentError("CollectorManager", "Collector", e.name, "is still stalled, closing it after the read returned")
+			go func() {
+				<-pending
+				e.stalled.Store(false)
+				if e.collector.Initialized() {
+					e.collector.Close()
+				}
+				cm.updateState(e)
+			}()
+			return
+		}
+	}
+	if e.collector.Initialized() {
+		e.collector.Close()
+	}
+	cm.updateState(e)
+}
+
+// closeAll closes all metric collectors. The caller has to hold the read lock, but not the lock.
+func (cm *collectorManager) closeAll() {
+	cm.lock.Lock()
+	entries := make([]*collectorEntry, 0, len(cm.entries))
+	for _, e := range cm.entries {
+		entries = append(entries, e)
+	}
+	cm.lock.Unlock()
+	for _, e := range entries {
+		cm.closeEntry(e)
+	}
+}
+
+// sameConfig compares two JSON encoded collector configurations ignoring whitespace
+func sameConfig(a, b json.RawMessage) bool {
+	var ca, cb bytes.Buffer
+	if json.Compact(&ca, a) != nil || json.Compact(&cb, b) != nil {
+		return bytes.Equal(a, b)
 	}
+	return bytes.Equal(ca.Bytes(), cb.Bytes())
+}
+
+// Reload applies a new collector configuration to the running metric collector manager.
+// Only collectors that were added, removed or whose configuration changed are
+// (re-)initialized, all other collectors keep running with their current state.
+func (cm *collectorManager) Reload(collectConfig json.RawMessage) error {
+	var newConfig map[string]json.RawMessage
+	err := json.Unmarshal(collectConfig, &newConfig)
+	if err != nil {
+		cclog.ComponentError("CollectorManager", "Reload:", err.Error())
+		return err
+	}
+
+	// Wait until the current read cycle is finished. Closing a stalled collector and
+	// initializing a collector can take long, so both are done without holding the lock.
+	cm.readLock.Lock()
+	defer cm.readLock.Unlock()
+
+	// Remove removed and changed collectors and close them
+	cm.lock.Lock()
+	removed := make([]*collectorEntry, 0)
+	for collectorName, oldCfg := range cm.config {
+		if newCfg, found := newConfig[collectorName]; !found || !sameConfig(oldCfg, newCfg) {
+			if e, found := cm.entries[collectorName]; found {
+				removed = append(removed, e)
+				delete(cm.entries, collectorName)
+			}
+		}
+	}
+	cm.lock.Unlock()
+	for _, e := range removed {
+		cclog.ComponentDebug("CollectorManager", "REMOVE COLLECTOR", e.collector.Name())
+		cm.closeEntry(e)
+	}
+
+	// Initialize added and changed collectors and add them
+	added := make(map[string]*collectorEntry)
+	for collectorName, newCfg := range newConfig {
+		if oldCfg, found := cm.config[collectorName]; found && sameConfig(oldCfg, newCfg) {
+			continue
+		}
+		cclog.ComponentDebug("CollectorManager", "RELOAD COLLECTOR", collectorName)
+		if e := cm.newEntry(collectorName, newCfg); e != nil {
+			added[collectorName] = e
+		}
+	}
+	cm.lock.Lock()
+	for collectorName, e := range added {
+		cm.entries[collectorName] = e
+	}
+	cm.lock.Unlock()
+	cm.config = newConfig
 	return nil
 }
 
+// readCollector reads the metrics of a single collector and records the duration of the read.
+// If the read exceeds the timeout of the collector, readCollector stops waiting, marks the
+// collector as stalled and skips it until the read returns. The context of the read is
+// canceled, so external commands started with it are killed.
+func (cm *collectorManager) readCollector(e *collectorEntry, t time.Time) {
+	if e.pending != nil {
+		select {
+		case res := <-e.pending:
+			cclog.ComponentError("CollectorManager", "Collector", e.name, "returned after", res.duration, "and is no longer stalled")
+			e.pending = nil
+			e.lastDuration.Store(int64(res.duration))
+			e.stalled.Store(false)
+			cm.updateState(e)
+		default:
+			cclog.ComponentDebug("CollectorManager", "SKIP stalled collector", e.name)
+			return
+		}
+	}
+
+	finishInputs, ok := cm.startReadInputs(e)
+	if !ok {
+		return
+	}
+
+	cclog.ComponentDebug("CollectorManager", e.collector.Name(), t)
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if e.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+	}
+	if s, ok := e.collector.(readContextSetter); ok {
+		s.setReadContext(ctx)
+	}
+	if s, ok := e.collector.(skippedIntervalsSetter); ok {
+		s.setSkippedIntervals(e.skipped)
+	}
+	if e.skipped > 0 {
+		cclog.ComponentDebug("CollectorManager", "Collector", e.name, "skipped", e.skipped, "read intervals")
+	}
+	e.skipped = 0
+
+	clk := cm.ticker.Clock()
+	start := clk.Now()
+	cm.lock.Lock()
+	e.lastRead = start
+	output, sender := cm.output, cm.sender
+	cm.lock.Unlock()
+	finished := make(chan readResult, 1)
+	go func() {
+		var err error
+		collectorOutput, closeOutput := countingOutput(e, output, sender, clk)
+		defer func() {
+			// A panic in a metric collector must not stop the whole collector
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic in Read(): %v", r)
+				cclog.ComponentError("CollectorManager", "Collector", e.name, err.Error(), "\n", string(debug.Stack()))
+			}
+			closeOutput()
+			cancel()
+			finishInputs()
+			finished <- readResult{duration: clk.Since(start), err: err}
+		}()
+		e.collector.Read(cm.duration, collectorOutput)
+		if r, ok := e.collector.(readErrorReporter); ok {
+			err = r.takeReadError()
+		}
+	}()
+
+	var timeout <-chan time.Time
+	if e.timeout > 0 {
+		timer := clk.NewTimer(e.timeout)
+		defer timer.Stop()
+		timeout = timer.C()
+	}
+	select {
+	case res := <-finished:
+		cm.recordResult(e, res)
+		cm.updateState(e)
+	case <-timeout:
+		e.pending = finished
+		e.stalled.Store(true)
+		e.timeouts.Add(1)
+		msg := fmt.Sprintf("Collector %s did not finish reading within %v, skipping it until the read returns", e.name, e.timeout)
+		cclog.ComponentError("CollectorManager", msg)
+		cm.recordResult(e, readResult{duration: e.timeout, err: errors.New("read timeout exceeded")})
+		y, err := lp.NewEvent("collector_timeout",
+			map[string]string{"type": "node", "collector": e.name},
+			map[string]string{"source": "CollectorManager"},
+			msg, clk.Now())
+		if err == nil {
+			sender.Send(y)
+		}
+	}
+}
+
+// countingOutput returns the output channel for a read of a metric collector. The messages
+// are forwarded to the output channel with the sender applying its back-pressure policy,
+// counting them and the time spent waiting for the output channel. For collector types
+// configured multiple times, the instance name is added to the 'source' meta data of all
+// messages, like 'CustomCmdCollector@slurm'. The waiting time is measured with the clock of
+// the ticker. The returned function has to be called after the read to forward the
+// remaining messages.
+func countingOutput(e *collectorEntry, output chan lp.CCMessage, sender bp.Sender, clk clock.Clock) (chan lp.CCMessage, func()) {
+	collectorOutput := make(chan lp.CCMessage, cap(output))
+	forwarded := make(chan bool)
+	go func() {
+		for msg := range collectorOutput {
+			if len(e.instance) > 0 {
+				source, ok := msg.GetMeta("source")
+				if !ok {
+					source = e.collector.Name()
+				}
+				msg.AddMeta("source", source+"@"+e.instance)
+			}
+			select {
+			case output <- msg:
+			default:
+				start := clk.Now()
+				sender.Send(msg)
+				e.blocked.Add(int64(clk.Since(start)))
+			}
+			e.messages.Add(1)
+		}
+		close(forwarded)
+	}()
+	return collectorOutput, func() {
+		close(collectorOutput)
+		<-forwarded
+	}
+}
+
+// Statistics of a configured metric collector reported by the self collector
+type collectorStats struct {
+	stalled      bool          // whether a read exceeded the timeout and did not return yet
+	timeouts     uint64        // number of reads that exceeded the timeout
+	errors       uint64        // number of failed reads
+	messages     uint64        // number of messages sent
+	lastDuration time.Duration // duration of the last read
+	blocked      time.Duration // time spent waiting for the output channel
+}
+
+// collectorStates returns the statistics of all configured collectors
+func (cm *collectorManager) collectorStates() map[string]collectorStats {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	states := make(map[string]collectorStats, len(cm.entries))
+	for name, e := range cm.entries {
+		states[name] = collectorStats{
+			stalled:      e.stalled.Load(),
+			timeouts:     e.timeouts.Load(),
+			errors:       e.errors.Load(),
+			messages:     e.messages.Load(),
+			lastDuration: time.Duration(e.lastDuration.Load()),
+			blocked:      time.Duration(e.blocked.Load()),
+		}
+	}
+	return states
+}
+
+// readableCollectors returns all initialized and enabled collectors. If onlyDue is set,
+// only the collectors whose read interval elapsed are returned.
+// The caller has to hold the lock.
+func (cm *collectorManager) readableCollectors(onlyDue bool) []*collectorEntry {
+	entries := make([]*collectorEntry, 0, len(cm.entries))
+	for _, e := range cm.entries {
+		if !e.enabled || !e.initialized {
+			continue
+		}
+		if onlyDue && !e.due() {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// readCollectors reads the given collectors. The parallel collectors are read
+// concurrently, the serial collectors afterwards one after the other. If a done signal is
+// received in between, readCollectors stops and returns false. The caller has to hold
+// the read lock, but not the lock, so the control API is not blocked by the reads.
+func (cm *collectorManager) readCollectors(t time.Time, done chan bool, entries []*collectorEntry) bool {
+	cm.nextReadCycle(t)
+	cm.parallel_run = true
+	for _, e := range entries {
+		if !e.collector.Parallel() {
+			continue
+		}
+		// Wait for done signal or execute the collector
+		select {
+		case <-done:
+			return false
+		default:
+			// Read metrics from collector e via goroutine
+			cm.collector_wg.Add(1)
+			go func(mye *collectorEntry) {
+				cm.readCollector(mye, t)
+				cm.collector_wg.Done()
+			}(e)
+		}
+	}
+	cm.collector_wg.Wait()
+	cm.parallel_run = false
+	for _, e := range entries {
+		if e.collector.Parallel() {
+			continue
+		}
+		// Wait for done signal or execute the collector
+		select {
+		case <-done:
+			return false
+		default:
+			// Read metrics from collector e
+			cm.readCollector(e, t)
+		}
+	}
+	return true
+}
+
 // Start starts the metric collector manager
 func (cm *collectorManager) Start() {
-	tick := make(chan time.Time)
-	cm.ticker.AddChannel(tick)
+	ticks := make(chan mct.Tick)
+	cm.ticker.AddTickChannel("collectors", ticks)
 
+	cm.started = true
 	cm.wg.Add(1)
 	go func() {
 		defer cm.wg.Done()
@@ -131,9 +865,9 @@ func (cm *collectorManager) Start() {
 				cm.collector_wg.Wait()
 				cm.parallel_run = false
 			}
-			for _, c := range cm.collectors {
-				c.Close()
-			}
+			cm.readLock.Lock()
+			cm.closeAll()
+			cm.readLock.Unlock()
 			close(cm.done)
 			cclog.ComponentDebug("CollectorManager", "DONE")
 		}
@@ -144,37 +878,24 @@ func (cm *collectorManager) Start() {
 			case <-cm.done:
 				done()
 				return
-			case t := <-tick:
-				cm.parallel_run = true
-				for _, c := range cm.collectors {
-					// Wait for done signal or execute the collector
-					select {
-					case <-cm.done:
-						done()
-						return
-					default:
-						// Read metrics from collector c via goroutine
-						cclog.ComponentDebug("CollectorManager", c.Name(), t)
-						cm.collector_wg.Add(1)
-						go func(myc MetricCollector) {
-							myc.Read(cm.duration, cm.output)
-							cm.collector_wg.Done()
-						}(c)
+			case tick := <-ticks:
+				t := tick.Time
+				cm.readLock.Lock()
+				cm.retryInit(t)
+				cm.lock.Lock()
+				if tick.Missed > 0 {
+					cclog.ComponentError("CollectorManager", "Missed", tick.Missed, "ticks, the reads took longer than the interval")
+					for _, e := range cm.entries {
+						e.missTicks(tick.Missed)
 					}
 				}
-				cm.collector_wg.Wait()
-				cm.parallel_run = false
-				for _, c := range cm.serial {
-					// Wait for done signal or execute the collector
-					select {
-					case <-cm.done:
-						done()
-						return
-					default:
-						// Read metrics from collector c
-						cclog.ComponentDebug("CollectorManager", c.Name(), t)
-						c.Read(cm.duration, cm.output)
-					}
+				entries := cm.readableCollectors(true)
+				cm.lock.Unlock()
+				ok := cm.readCollectors(t, cm.done, entries)
+				cm.readLock.Unlock()
+				if !ok {
+					done()
+					return
 				}
 			}
 		}
@@ -184,14 +905,190 @@ func (cm *collectorManager) Start() {
 	cclog.ComponentDebug("CollectorManager", "STARTED")
 }
 
+// Collectors returns runtime information about all configured metric collectors
+func (cm *collectorManager) Collectors() []CollectorInfo {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	infos := make([]CollectorInfo, 0, len(cm.entries))
+	for _, e := range cm.entries {
+		infos = append(infos, CollectorInfo{
+			Name:             e.name,
+			Initialized:      e.initialized,
+			Enabled:          e.enabled,
+			Parallel:         e.parallel,
+			Interval:         (time.Duration(e.every) * cm.ticker.Interval()).String(),
+			LastRead:         e.lastRead,
+			LastReadDuration: time.Duration(e.lastDuration.Load()).String(),
+			Stalled:          e.stalled.Load(),
+			Timeouts:         e.timeouts.Load(),
+			Errors:           e.errors.Load(),
+			Messages:         e.messages.Load(),
+			BlockedTime:      time.Duration(e.blocked.Load()).String(),
+			Failures:         e.failures,
+			LastError:        e.lastError,
+			NextInit:         e.nextInit,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// SetEnabled enables or disables reading a configured metric collector each interval.
+// Enabling a collector whose initialization failed retries the initialization.
+// Enabling a collector resets its number of consecutive failed reads.
+func (cm *collectorManager) SetEnabled(collectorName string, enabled bool) error {
+	if enabled {
+		// The collector is initialized without holding the lock, but the read lock, so it
+		// is not read, reloaded or closed meanwhile
+		cm.readLock.Lock()
+		defer cm.readLock.Unlock()
+	}
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	e, found := cm.entries[collectorName]
+	if !found {
+		return fmt.Errorf("unknown collector %s", collectorName)
+	}
+	if enabled && !e.initialized {
+		cm.lock.Unlock()
+		err := cm.initEntry(e)
+		cm.updateState(e)
+		cm.lock.Lock()
+		if err != nil {
+			return fmt.Errorf("initialization of collector %s failed: %v", collectorName, err)
+		}
+		e.initFailures = 0
+		e.nextInit = time.Time{}
+	}
+	if enabled {
+		e.failures = 0
+	}
+	e.enabled = enabled
+	cclog.ComponentDebug("CollectorManager", "SET ENABLED", collectorName, enabled)
+	return nil
+}
+
+// ReadNow reads the given collector immediately, independent of the ticker.
+// If no collector name is given, all enabled collectors are read.
+func (cm *collectorManager) ReadNow(collectorName string) error {
+	// Wait until the current read cycle is finished
+	cm.readLock.Lock()
+	defer cm.readLock.Unlock()
+	cm.lock.Lock()
+	entries := cm.readableCollectors(false)
+	if len(collectorName) > 0 {
+		e, found := cm.entries[collectorName]
+		if !found {
+			cm.lock.Unlock()
+			return fmt.Errorf("unknown collector %s", collectorName)
+		}
+		if !e.initialized {
+			cm.lock.Unlock()
+			return fmt.Errorf("collector %s is not initialized", collectorName)
+		}
+		entries = []*collectorEntry{e}
+	}
+	cm.lock.Unlock()
+	cm.readCollectors(cm.ticker.Clock().Now(), nil, entries)
+	return nil
+}
+
 // AddOutput adds the output channel to the metric collector manager
 func (cm *collectorManager) AddOutput(output chan lp.CCMessage) {
 	cm.output = output
+	cm.sender, _ = bp.NewSender("", output, bp.POLICY_BLOCK)
+}
+
+// SetOutputPolicy sets the back-pressure policy applied if the output channel is full.
+// The dropped messages are reported by the name of the channel.
+func (cm *collectorManager) SetOutputPolicy(channel string, policy string) error {
+	s, err := bp.NewSender(channel, cm.output, policy)
+	if err != nil {
+		return err
+	}
+	cm.lock.Lock()
+	cm.sender = s
+	cm.lock.Unlock()
+	return nil
+}
+
+// Warmup reads all enabled collectors once and discards the metrics. Collectors
+// deriving values from the difference of two reads get their first values this way.
+// The metrics of reads exceeding their timeout are discarded until the reads return.
+func (cm *collectorManager) Warmup() {
+	cm.readLock.Lock()
+	defer cm.readLock.Unlock()
+	discard := make(chan lp.CCMessage)
+	stop := make(chan bool)
+	go func() {
+		for {
+			select {
+			case <-discard:
+			case <-stop:
+				// The channel is not closed, but all warmup reads returned
+				return
+			}
+		}
+	}()
+	cm.lock.Lock()
+	output, sender := cm.output, cm.sender
+	cm.output = discard
+	cm.sender, _ = bp.NewSender("", discard, bp.POLICY_BLOCK)
+	entries := cm.readableCollectors(false)
+	cm.lock.Unlock()
+	cm.warmup = true
+	cm.readCollectors(cm.ticker.Clock().Now(), nil, entries)
+	cm.warmup = false
+	cm.lock.Lock()
+	cm.output, cm.sender = output, sender
+	cm.lock.Unlock()
+
+	// Stalled collectors still write to the discard channel. A read sends its result after
+	// all its metrics were forwarded, so the draining stops once all results are relayed.
+	var stalled sync.WaitGroup
+	for _, e := range entries {
+		if e.pending == nil {
+			continue
+		}
+		pending, relay := e.pending, make(chan readResult, 1)
+		e.pending = relay
+		stalled.Add(1)
+		go func() {
+			relay <- <-pending
+			stalled.Done()
+		}()
+	}
+	go func() {
+		stalled.Wait()
+		close(stop)
+	}()
+	cclog.ComponentDebug("CollectorManager", "WARMUP DONE")
+}
+
+// Failed returns the names of all configured collectors that are not initialized
+func (cm *collectorManager) Failed() []string {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	failed := make([]string, 0)
+	for name, e := range cm.entries {
+		if !e.initialized {
+			failed = append(failed, name)
+		}
+	}
+	sort.Strings(failed)
+	return failed
 }
 
 // Close finishes / stops the metric collector manager
 func (cm *collectorManager) Close() {
 	cclog.ComponentDebug("CollectorManager", "CLOSE")
+	if !cm.started {
+		// No ticker driven reading, just close the metric collectors
+		cm.readLock.Lock()
+		cm.closeAll()
+		cm.readLock.Unlock()
+		return
+	}
 	cm.done <- true
 	// wait for close of channel cm.done
 	<-cm.done
@@ -0,0 +1,320 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package collectors
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/clock"
+	mct "github.com/ClusterCockpit/cc-metric-collector/pkg/multiChanTicker"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Configuration of the test collector
+type testCollectorConfig struct {
+	Id    string `json:"id"`    // key of the collector in testCollectors
+	Block bool   `json:"block"` // Read() waits until release is closed
+}
+
+// Metric collector sending one metric per read, optionally blocking in Read()
+type testCollector struct {
+	metricCollector
+	config  testCollectorConfig
+	release chan bool
+	reads   atomic.Int32
+	inRead  atomic.Bool
+	closed  atomic.Bool
+}
+
+// Test collectors by the id in their configuration
+var (
+	testCollectors     = make(map[string]*testCollector)
+	testCollectorsLock sync.Mutex
+)
+
+func init() {
+	AvailableCollectors["test"] = func() MetricCollector { return new(testCollector) }
+}
+
+func (m *testCollector) Init(config json.RawMessage) error {
+	m.name = "TestCollector"
+	if err := json.Unmarshal(config, &m.config); err != nil {
+		return err
+	}
+	m.release = make(chan bool)
+	testCollectorsLock.Lock()
+	testCollectors[m.config.Id] = m
+	testCollectorsLock.Unlock()
+	m.init = true
+	return nil
+}
+
+func (m *testCollector) Read(interval time.Duration, output chan lp.CCMessage) {
+	m.reads.Add(1)
+	if m.config.Block {
+		m.inRead.Store(true)
+		<-m.release
+		m.inRead.Store(false)
+	}
+	y, err := lp.NewMetric("test_reads", map[string]string{"type": "node"}, nil, m.reads.Load(), m.now())
+	if err == nil {
+		output <- y
+	}
+}
+
+func (m *testCollector) Close() {
+	m.closed.Store(true)
+	m.init = false
+}
+
+// testCollectorById returns the test collector initialized with the given id
+func testCollectorById(t *testing.T, id string) *testCollector {
+	t.Helper()
+	testCollectorsLock.Lock()
+	defer testCollectorsLock.Unlock()
+	c, ok := testCollectors[id]
+	if !ok {
+		t.Fatalf("test collector %s not initialized", id)
+	}
+	return c
+}
+
+// waitFor polls a condition, the collector manager reads in its own goroutine
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// collectorInfo returns the runtime information of a configured collector
+func collectorInfo(cm CollectorManager, name string) CollectorInfo {
+	for _, info := range cm.Collectors() {
+		if info.Name == name {
+			return info
+		}
+	}
+	return CollectorInfo{}
+}
+
+// startTestManager starts a collector manager with a fake clock ticking every 10 seconds.
+// The messages sent to the output channel are collected in the returned function.
+func startTestManager(t *testing.T, config string) (CollectorManager, *clock.Fake, mct.MultiChanTicker, func() []lp.CCMessage) {
+	t.Helper()
+	clk := clock.NewFake(testStart)
+	ticker := mct.NewTickerWithClock(clk, 10*time.Second)
+	var wg sync.WaitGroup
+	cm, err := New(ticker, 0, &wg, json.RawMessage(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := make(chan lp.CCMessage)
+	cm.AddOutput(output)
+	var lock sync.Mutex
+	received := make([]lp.CCMessage, 0)
+	go func() {
+		for m := range output {
+			lock.Lock()
+			received = append(received, m)
+			lock.Unlock()
+		}
+	}()
+	cm.Start()
+	t.Cleanup(func() {
+		cm.Close()
+		wg.Wait()
+		ticker.Close()
+		close(output)
+	})
+	return cm, clk, ticker, func() []lp.CCMessage {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]lp.CCMessage(nil), received...)
+	}
+}
+
+func TestReadCycle(t *testing.T) {
+	cm, clk, _, received := startTestManager(t, `{
+		"test@fast": {"id": "fast"},
+		"test@slow": {"id": "slow", "interval": "30s"}
+	}`)
+	fast := testCollectorById(t, "fast")
+	slow := testCollectorById(t, "slow")
+
+	for i := int32(1); i <= 4; i++ {
+		clk.Advance(10 * time.Second)
+		waitFor(t, "the read of the fast collector", func() bool { return collectorInfo(cm, "test@fast").Messages == uint64(i) })
+	}
+	waitFor(t, "the reads of the slow collector", func() bool { return collectorInfo(cm, "test@slow").Messages == 2 })
+	if n := fast.reads.Load(); n != 4 {
+		t.Errorf("fast collector read %d times, want 4", n)
+	}
+	if n := slow.reads.Load(); n != 2 {
+		t.Errorf("slow collector read %d times, want 2 (first and fourth tick)", n)
+	}
+
+	info := collectorInfo(cm, "test@slow")
+	if info.Interval != "30s" || !info.LastRead.Equal(testStart.Add(40*time.Second)) {
+		t.Errorf("slow collector info %+v, want interval 30s and last read at the fourth tick", info)
+	}
+	sources := make(map[string]int)
+	for _, m := range received() {
+		source, _ := m.GetMeta("source")
+		sources[source]++
+		if m.Time().Sub(testStart)%(10*time.Second) != 0 {
+			t.Errorf("message time %v is not a tick of the fake clock", m.Time())
+		}
+	}
+	if sources["TestCollector@fast"] != 4 || sources["TestCollector@slow"] != 2 {
+		t.Errorf("messages by source %v, want 4 from the fast and 2 from the slow instance", sources)
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	cm, clk, ticker, _ := startTestManager(t, `{
+		"test@stalled": {"id": "stalled", "block": true, "timeout": "5s"}
+	}`)
+	c := testCollectorById(t, "stalled")
+
+	// The collector manager creates the timeout timer after starting the read
+	clk.Advance(10 * time.Second)
+	waitFor(t, "the read and its timeout timer", func() bool { return c.inRead.Load() && clk.Waiters() == 2 })
+	clk.Advance(5 * time.Second)
+	waitFor(t, "the read timeout", func() bool { return collectorInfo(cm, "test@stalled").Stalled })
+	info := collectorInfo(cm, "test@stalled")
+	if info.Timeouts != 1 || info.Errors != 1 || info.Failures != 1 || info.LastError != "read timeout exceeded" {
+		t.Errorf("info after the timeout %+v, want one timeout counted as failed read", info)
+	}
+
+	// The stalled collector is skipped by the next read cycle and by ReadNow(), which waits
+	// for the read cycle to finish
+	clk.Advance(5 * time.Second)
+	waitFor(t, "the next tick", func() bool { return ticker.Stats()[0].Delivered == 2 })
+	if err := cm.ReadNow("test@stalled"); err != nil {
+		t.Fatal(err)
+	}
+	if n := c.reads.Load(); n != 1 {
+		t.Errorf("stalled collector read %d times", n)
+	}
+
+	// After the read returned, the collector is read again
+	close(c.release)
+	waitFor(t, "the stalled read to return", func() bool { return !c.inRead.Load() })
+	clk.Advance(10 * time.Second)
+	waitFor(t, "the next read", func() bool { return collectorInfo(cm, "test@stalled").Messages == 2 })
+	info = collectorInfo(cm, "test@stalled")
+	if info.Stalled || c.reads.Load() != 2 {
+		t.Errorf("info after the stalled read returned %+v with %d reads, want 2 reads and not stalled", info, c.reads.Load())
+	}
+	if info.Failures != 0 || info.Errors != 1 {
+		t.Errorf("successful read after the timeout %+v, want no consecutive failures and one failed read", info)
+	}
+}
+
+func TestReloadStalledCollector(t *testing.T) {
+	cm, clk, _, _ := startTestManager(t, `{
+		"test@reload": {"id": "reload", "block": true, "timeout": "5s"}
+	}`)
+	c := testCollectorById(t, "reload")
+	clk.Advance(10 * time.Second)
+	waitFor(t, "the read and its timeout timer", func() bool { return c.inRead.Load() && clk.Waiters() == 2 })
+	clk.Advance(5 * time.Second)
+	waitFor(t, "the read timeout", func() bool { return collectorInfo(cm, "test@reload").Stalled })
+
+	// Closing the stalled collector waits for its read, the control API is not blocked meanwhile
+	reloaded := make(chan error)
+	go func() {
+		reloaded <- cm.Reload(json.RawMessage(`{"test@added": {"id": "added"}}`))
+	}()
+	waitFor(t, "the removal of the stalled collector", func() bool {
+		start := time.Now()
+		info := collectorInfo(cm, "test@reload")
+		if d := time.Since(start); d > time.Second {
+			t.Fatalf("Collectors() blocked for %v during the reload", d)
+		}
+		return info.Name == ""
+	})
+	if c.closed.Load() {
+		t.Errorf("stalled collector closed during its read")
+	}
+	close(c.release)
+	if err := <-reloaded; err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the stalled collector to be closed", func() bool { return c.closed.Load() })
+	if info := collectorInfo(cm, "test@added"); !info.Initialized || !info.Enabled {
+		t.Errorf("added collector %+v, want initialized and enabled", info)
+	}
+}
+
+func TestWarmupStalledCollector(t *testing.T) {
+	clk := clock.NewFake(testStart)
+	ticker := mct.NewTickerWithClock(clk, 10*time.Second)
+	defer ticker.Close()
+	var wg sync.WaitGroup
+	cm, err := New(ticker, 0, &wg, json.RawMessage(`{"test@warmup": {"id": "warmup", "block": true, "timeout": "5s"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+	output := make(chan lp.CCMessage, 10)
+	cm.AddOutput(output)
+	c := testCollectorById(t, "warmup")
+
+	waiters := clk.Waiters()
+	done := make(chan bool)
+	go func() {
+		cm.Warmup()
+		close(done)
+	}()
+	waitFor(t, "the read and its timeout timer", func() bool { return c.inRead.Load() && clk.Waiters() == waiters+1 })
+	clk.Advance(5 * time.Second)
+	<-done
+
+	// The metric of the stalled warmup read is discarded after Warmup() returned
+	close(c.release)
+	waitFor(t, "the metric of the stalled read", func() bool { return collectorInfo(cm, "test@warmup").Messages == 1 })
+	if err := cm.ReadNow("test@warmup"); err != nil {
+		t.Fatal(err)
+	}
+	if len(output) != 1 || collectorInfo(cm, "test@warmup").Stalled {
+		t.Errorf("%d messages after the read following the stalled warmup read, want 1", len(output))
+	}
+}
+
+func TestCloseCollectors(t *testing.T) {
+	clk := clock.NewFake(testStart)
+	ticker := mct.NewTickerWithClock(clk, 10*time.Second)
+	defer ticker.Close()
+	var wg sync.WaitGroup
+	cm, err := New(ticker, 0, &wg, json.RawMessage(`{"test@close": {"id": "close"}, "unknown": {}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := testCollectorById(t, "close")
+	if failed := cm.Failed(); len(failed) != 0 {
+		t.Errorf("Failed() = %v, unknown collectors are skipped", failed)
+	}
+	cm.Close()
+	if !c.closed.Load() {
+		t.Errorf("collector not closed")
+	}
+	if failed := cm.Failed(); len(failed) != 1 || failed[0] != "test@close" {
+		t.Errorf("Failed() after Close() = %v, want the closed collector", failed)
+	}
+}
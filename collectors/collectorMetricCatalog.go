@@ -0,0 +1,85 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package collectors
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// CollectorMetrics contains the metrics a configured collector can emit
+type CollectorMetrics struct {
+	Collector string              `json:"collector"` // Name of the collector in the configuration
+	Described bool                `json:"described"` // Whether the collector describes its metrics
+	Metrics   []MetricDescription `json:"metrics"`
+}
+
+// excludeMetrics removes all metrics listed in the common 'exclude_metrics' option
+func excludeMetrics(config json.RawMessage, metrics []MetricDescription) []MetricDescription {
+	if len(config) == 0 {
+		return metrics
+	}
+	var c struct {
+		ExcludeMetrics []string `json:"exclude_metrics"`
+	}
+	if json.Unmarshal(config, &c) != nil || len(c.ExcludeMetrics) == 0 {
+		return metrics
+	}
+	out := make([]MetricDescription, 0, len(metrics))
+	for _, d := range metrics {
+		if _, skip := stringArrayContains(c.ExcludeMetrics, d.Name); !skip {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// MetricCatalog returns the metrics the configured collectors can emit.
+// No collector is initialized. Collectors not implementing MetricDescriber are
+// listed without metrics.
+func MetricCatalog(collectConfig json.RawMessage) ([]CollectorMetrics, error) {
+	var config map[string]json.RawMessage
+	err := json.Unmarshal(collectConfig, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	catalog := make([]CollectorMetrics, 0, len(names))
+	for _, name := range names {
+		collectorType, _, err := collectorTypeOf(name, config[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		newCollector, found := AvailableCollectors[collectorType]
+		if !found {
+			return nil, fmt.Errorf("%s: unknown collector type '%s'", name, collectorType)
+		}
+		collector := newCollector()
+		entry := CollectorMetrics{
+			Collector: name,
+			Metrics:   make([]MetricDescription, 0),
+		}
+		if d, ok := collector.(MetricDescriber); ok {
+			metrics, err := d.DescribeMetrics(config[name])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			entry.Described = true
+			entry.Metrics = excludeMetrics(config[name], metrics)
+		}
+		catalog = append(catalog, entry)
+	}
+	return catalog, nil
+}
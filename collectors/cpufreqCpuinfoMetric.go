@@ -12,7 +12,6 @@ import (
 	"encoding/json"
 
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -42,6 +41,7 @@ func (m *CPUFreqCpuInfoCollector) Init(config json.RawMessage) error {
 	}
 
 	m.setup()
+	m.enableInputRecording()
 
 	m.name = "CPUFreqCpuInfoCollector"
 	m.parallel = true
@@ -51,8 +51,8 @@ func (m *CPUFreqCpuInfoCollector) Init(config json.RawMessage) error {
 		"unit":   "MHz",
 	}
 
-	const cpuInfoFile = "/proc/cpuinfo"
-	file, err := os.Open(cpuInfoFile)
+	cpuInfoFile := "/proc/cpuinfo"
+	file, err := m.openFile(cpuInfoFile)
 	if err != nil {
 		return fmt.Errorf("failed to open file '%s': %v", cpuInfoFile, err)
 	}
@@ -132,8 +132,8 @@ func (m *CPUFreqCpuInfoCollector) Read(interval time.Duration, output chan lp.CC
 		return
 	}
 
-	const cpuInfoFile = "/proc/cpuinfo"
-	file, err := os.Open(cpuInfoFile)
+	cpuInfoFile := "/proc/cpuinfo"
+	file, err := m.openFile(cpuInfoFile)
 	if err != nil {
 		cclog.ComponentError(
 			m.name,
@@ -143,7 +143,7 @@ func (m *CPUFreqCpuInfoCollector) Read(interval time.Duration, output chan lp.CC
 	defer file.Close()
 
 	processorCounter := 0
-	now := time.Now()
+	now := m.now()
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		lineSplit := strings.Split(scanner.Text(), ":")
@@ -171,6 +171,20 @@ func (m *CPUFreqCpuInfoCollector) Read(interval time.Duration, output chan lp.CC
 	}
 }
 
+// DescribeMetrics returns the metrics the cpufreq_cpuinfo collector can emit
+func (m *CPUFreqCpuInfoCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	return []MetricDescription{
+		{
+			Name:        "cpufreq",
+			Unit:        "MHz",
+			Scopes:      []string{"hwthread"},
+			Kind:        METRIC_KIND_GAUGE,
+			Group:       "CPU",
+			Description: "Current clock frequency from /proc/cpuinfo",
+		},
+	}, nil
+}
+
 func (m *CPUFreqCpuInfoCollector) Close() {
 	m.init = false
 }
@@ -71,7 +71,7 @@ func (m *CPUFreqCollector) Init(config json.RawMessage) error {
 		}
 
 		// Check access to current frequency file
-		scalingCurFreqFile := filepath.Join("/sys/devices/system/cpu", fmt.Sprintf("cpu%d", c.CpuID), "cpufreq/scaling_cur_freq")
+		scalingCurFreqFile := filepath.Join(m.hostPath("/sys/devices/system/cpu"), fmt.Sprintf("cpu%d", c.CpuID), "cpufreq/scaling_cur_freq")
 		err := unix.Access(scalingCurFreqFile, unix.R_OK)
 		if err != nil {
 			return fmt.Errorf("unable to access file '%s': %v", scalingCurFreqFile, err)
@@ -104,7 +104,7 @@ func (m *CPUFreqCollector) Read(interval time.Duration, output chan lp.CCMessage
 		return
 	}
 
-	now := time.Now()
+	now := m.now()
 	for i := range m.topology {
 		t := &m.topology[i]
 
@@ -130,6 +130,20 @@ func (m *CPUFreqCollector) Read(interval time.Duration, output chan lp.CCMessage
 	}
 }
 
+// DescribeMetrics returns the metrics the cpufreq collector can emit
+func (m *CPUFreqCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	return []MetricDescription{
+		{
+			Name:        "cpufreq",
+			Unit:        "Hz",
+			Scopes:      []string{"hwthread"},
+			Kind:        METRIC_KIND_GAUGE,
+			Group:       "CPU",
+			Description: "Current clock frequency from sysfs",
+		},
+	}, nil
+}
+
 func (m *CPUFreqCollector) Close() {
 	m.init = false
 }
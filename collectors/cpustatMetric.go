@@ -11,7 +11,6 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -40,6 +39,7 @@ type CpustatCollector struct {
 func (m *CpustatCollector) Init(config json.RawMessage) error {
 	m.name = "CpustatCollector"
 	m.setup()
+	m.enableInputRecording()
 	m.parallel = true
 	m.meta = map[string]string{"source": m.name, "group": "CPU"}
 	m.nodetags = map[string]string{"type": "node"}
@@ -77,9 +77,10 @@ func (m *CpustatCollector) Init(config json.RawMessage) error {
 	}
 
 	// Check input file
-	file, err := os.Open(string(CPUSTATFILE))
+	file, err := m.openFile(CPUSTATFILE)
 	if err != nil {
 		cclog.ComponentError(m.name, err.Error())
+		return err
 	}
 	defer file.Close()
 
@@ -107,7 +108,7 @@ func (m *CpustatCollector) Init(config json.RawMessage) error {
 			num_cpus++
 		}
 	}
-	m.lastTimestamp = time.Now()
+	m.lastTimestamp = m.now()
 	m.init = true
 	return nil
 }
@@ -150,12 +151,14 @@ func (m *CpustatCollector) Read(interval time.Duration, output chan lp.CCMessage
 		return
 	}
 	num_cpus := 0
-	now := time.Now()
+	now := m.now()
 	tsdelta := now.Sub(m.lastTimestamp)
 
-	file, err := os.Open(string(CPUSTATFILE))
+	file, err := m.openFile(CPUSTATFILE)
 	if err != nil {
 		cclog.ComponentError(m.name, err.Error())
+		m.reportReadError(err)
+		return
 	}
 	defer file.Close()
 
@@ -184,6 +187,40 @@ func (m *CpustatCollector) Read(interval time.Duration, output chan lp.CCMessage
 	m.lastTimestamp = now
 }
 
+// DescribeMetrics returns the metrics the cpustat collector can emit
+func (m *CpustatCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	describe := func(name, description string) MetricDescription {
+		return MetricDescription{
+			Name:        name,
+			Unit:        "Percent",
+			Scopes:      []string{"node", "hwthread"},
+			Kind:        METRIC_KIND_GAUGE,
+			Group:       "CPU",
+			Description: description,
+		}
+	}
+	metrics := []MetricDescription{
+		describe("cpu_user", "Time spent in user mode"),
+		describe("cpu_nice", "Time spent in user mode with low priority"),
+		describe("cpu_system", "Time spent in system mode"),
+		describe("cpu_idle", "Time spent in the idle task"),
+		describe("cpu_iowait", "Time waiting for I/O to complete"),
+		describe("cpu_irq", "Time servicing interrupts"),
+		describe("cpu_softirq", "Time servicing softirqs"),
+		describe("cpu_steal", "Time spent in other operating systems when running in a virtualized environment"),
+		describe("cpu_guest", "Time spent running a virtual CPU for guest operating systems"),
+		describe("cpu_guest_nice", "Time spent running a niced guest"),
+		describe("cpu_used", "Time not spent in the idle task"),
+	}
+	return append(metrics, MetricDescription{
+		Name:        "num_cpus",
+		Scopes:      []string{"node"},
+		Kind:        METRIC_KIND_GAUGE,
+		Group:       "CPU",
+		Description: "Number of hardware threads",
+	}), nil
+}
+
 func (m *CpustatCollector) Close() {
 	m.init = false
 }
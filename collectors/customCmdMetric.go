@@ -88,7 +88,7 @@ func (m *CustomCmdCollector) Read(interval time.Duration, output chan lp.CCMessa
 	}
 	for _, cmd := range m.commands {
 		cmdfields := strings.Fields(cmd)
-		command := exec.Command(cmdfields[0], strings.Join(cmdfields[1:], " "))
+		command := exec.CommandContext(m.readContext(), cmdfields[0], strings.Join(cmdfields[1:], " "))
 		command.Wait()
 		stdout, err := command.Output()
 		if err != nil {
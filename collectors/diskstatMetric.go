@@ -19,7 +19,10 @@ import (
 	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
 )
 
-const MOUNTFILE = `/proc/self/mounts`
+// The mounts of the init process: With procfs_root, /proc/self is the process reading the
+// file and not a process of the host, and /proc/self only lists the mounts of the own
+// mount namespace, e.g. of the container or the systemd service with a private /tmp.
+const MOUNTFILE = `/proc/1/mounts`
 
 type DiskstatCollectorConfig struct {
 	ExcludeMetrics []string `json:"exclude_metrics,omitempty"`
@@ -52,7 +55,7 @@ func (m *DiskstatCollector) Init(config json.RawMessage) error {
 			m.allowedMetrics[excl] = false
 		}
 	}
-	file, err := os.Open(MOUNTFILE)
+	file, err := os.Open(m.hostPath(MOUNTFILE))
 	if err != nil {
 		cclog.ComponentError(m.name, err.Error())
 		return err
@@ -67,7 +70,7 @@ func (m *DiskstatCollector) Read(interval time.Duration, output chan lp.CCMessag
 		return
 	}
 
-	file, err := os.Open(MOUNTFILE)
+	file, err := os.Open(m.hostPath(MOUNTFILE))
 	if err != nil {
 		cclog.ComponentError(m.name, err.Error())
 		return
@@ -142,6 +145,36 @@ mountLoop:
 	}
 }
 
+// DescribeMetrics returns the metrics the diskstat collector can emit
+func (m *DiskstatCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	return []MetricDescription{
+		{
+			Name:        "disk_total",
+			Unit:        "GBytes",
+			Scopes:      []string{"node"},
+			Kind:        METRIC_KIND_GAUGE,
+			Group:       "Disk",
+			Description: "Total size of the mounted device",
+		},
+		{
+			Name:        "disk_free",
+			Unit:        "GBytes",
+			Scopes:      []string{"node"},
+			Kind:        METRIC_KIND_GAUGE,
+			Group:       "Disk",
+			Description: "Free space on the mounted device",
+		},
+		{
+			Name:        "part_max_used",
+			Unit:        "percent",
+			Scopes:      []string{"node"},
+			Kind:        METRIC_KIND_GAUGE,
+			Group:       "Disk",
+			Description: "Maximal usage of all mounted devices",
+		},
+	}, nil
+}
+
 func (m *DiskstatCollector) Close() {
 	m.init = false
 }
@@ -118,7 +118,7 @@ func (m *GpfsCollector) Read(interval time.Duration, output chan lp.CCMessage) {
 	}
 
 	// Current time stamp
-	now := time.Now()
+	now := m.now()
 	// time difference to last time stamp
 	timeDiff := now.Sub(m.lastTimestamp).Seconds()
 	// Save current timestamp
@@ -128,7 +128,7 @@ func (m *GpfsCollector) Read(interval time.Duration, output chan lp.CCMessage) {
 	// -p: generate output that can be parsed
 	// -s: suppress the prompt on input
 	// fs_io_s: Displays I/O statistics per mounted file system
-	cmd := exec.Command(m.config.Mmpmon, "-p", "-s")
+	cmd := exec.CommandContext(m.readContext(), m.config.Mmpmon, "-p", "-s")
 	cmd.Stdin = strings.NewReader("once fs_io_s\n")
 	cmdStdout := new(bytes.Buffer)
 	cmdStderr := new(bytes.Buffer)
@@ -620,6 +620,73 @@ func (m *GpfsCollector) Read(interval time.Duration, output chan lp.CCMessage) {
 	}
 }
 
+// DescribeMetrics returns the metrics the GPFS collector can emit per file system
+func (m *GpfsCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	var c struct {
+		SendBandwidths    bool `json:"send_bandwidths"`
+		SendTotalValues   bool `json:"send_total_values"`
+		SendDerivedValues bool `json:"send_derived_values"`
+	}
+	if len(config) > 0 {
+		err := json.Unmarshal(config, &c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	metrics := make([]MetricDescription, 0)
+	add := func(name, unit, kind, description string) {
+		metrics = append(metrics, MetricDescription{
+			Name:        name,
+			Unit:        unit,
+			Scopes:      []string{"node"},
+			Kind:        kind,
+			Group:       "GPFS",
+			Description: description,
+		})
+	}
+	for _, d := range []struct {
+		name, bw, description string
+	}{
+		{"gpfs_bytes_read", "gpfs_bw_read", "Bytes read"},
+		{"gpfs_bytes_written", "gpfs_bw_write", "Bytes written"},
+	} {
+		add(d.name, "bytes", METRIC_KIND_COUNTER, d.description+" per file system")
+		if c.SendBandwidths {
+			add(d.bw, "bytes/sec", METRIC_KIND_GAUGE, d.description+" per second and file system")
+		}
+	}
+	for _, d := range []struct {
+		name, rate, description string
+	}{
+		{"gpfs_num_opens", "gpfs_opens_rate", "Open calls"},
+		{"gpfs_num_closes", "gpfs_closes_rate", "Close calls"},
+		{"gpfs_num_reads", "gpfs_reads_rate", "Read requests"},
+		{"gpfs_num_writes", "gpfs_writes_rate", "Write requests"},
+		{"gpfs_num_readdirs", "gpfs_readdirs_rate", "Readdir calls"},
+		{"gpfs_num_inode_updates", "gpfs_inode_updates_rate", "Inode updates"},
+	} {
+		add(d.name, "", METRIC_KIND_COUNTER, d.description+" per file system")
+		if c.SendDerivedValues {
+			add(d.rate, "requests/sec", METRIC_KIND_GAUGE, d.description+" per second and file system")
+		}
+	}
+	if c.SendTotalValues {
+		add("gpfs_bytes_total", "bytes", METRIC_KIND_COUNTER, "Bytes read and written per file system")
+		if c.SendBandwidths {
+			add("gpfs_bw_total", "bytes/sec", METRIC_KIND_GAUGE, "Bytes read and written per second and file system")
+		}
+		add("gpfs_iops", "", METRIC_KIND_COUNTER, "Read and write requests per file system")
+		if c.SendDerivedValues {
+			add("gpfs_iops_rate", "requests/sec", METRIC_KIND_GAUGE, "Read and write requests per second and file system")
+		}
+		add("gpfs_metaops", "", METRIC_KIND_COUNTER, "Metadata operations (opens, closes, readdirs, inode updates) per file system")
+		if c.SendDerivedValues {
+			add("gpfs_metaops_rate", "requests/sec", METRIC_KIND_GAUGE, "Metadata operations per second and file system")
+		}
+	}
+	return metrics, nil
+}
+
 func (m *GpfsCollector) Close() {
 	m.init = false
 }
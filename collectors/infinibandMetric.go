@@ -84,7 +84,8 @@ func (m *InfinibandCollector) Init(config json.RawMessage) error {
 	}
 
 	// Loop for all InfiniBand directories
-	globPattern := filepath.Join(IB_BASEPATH, "*", "ports", "*")
+	ibBase := m.hostPath(IB_BASEPATH)
+	globPattern := filepath.Join(ibBase, "*", "ports", "*")
 	ibDirs, err := filepath.Glob(globPattern)
 	if err != nil {
 		return fmt.Errorf("unable to glob files with pattern %s: %v", globPattern, err)
@@ -105,10 +106,14 @@ func (m *InfinibandCollector) Init(config json.RawMessage) error {
 			continue
 		}
 
-		// Get device and port component
-		pathSplit := strings.Split(path, string(os.PathSeparator))
-		device := pathSplit[4]
-		port := pathSplit[6]
+		// Get device and port component (<device>/ports/<port>)
+		relPath, err := filepath.Rel(ibBase, path)
+		if err != nil {
+			continue
+		}
+		pathSplit := strings.Split(relPath, string(os.PathSeparator))
+		device := pathSplit[0]
+		port := pathSplit[2]
 
 		// Skip excluded devices
 		skip := false
@@ -197,7 +202,7 @@ func (m *InfinibandCollector) Read(interval time.Duration, output chan lp.CCMess
 	}
 
 	// Current time stamp
-	now := time.Now()
+	now := m.now()
 	// time difference to last time stamp
 	timeDiff := now.Sub(m.lastTimestamp).Seconds()
 	// Save current timestamp
@@ -313,6 +318,72 @@ func (m *InfinibandCollector) Read(interval time.Duration, output chan lp.CCMess
 	}
 }
 
+// DescribeMetrics returns the metrics the infiniband collector can emit
+func (m *InfinibandCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	var c struct {
+		SendAbsoluteValues bool `json:"send_abs_values"`
+		SendTotalValues    bool `json:"send_total_values"`
+		SendDerivedValues  bool `json:"send_derived_values"`
+	}
+	c.SendAbsoluteValues = true
+	if len(config) > 0 {
+		err := json.Unmarshal(config, &c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	metrics := make([]MetricDescription, 0)
+	for _, d := range []struct {
+		name, unit, description string
+	}{
+		{"ib_recv", "bytes", "Received bytes"},
+		{"ib_xmit", "bytes", "Transmitted bytes"},
+		{"ib_recv_pkts", "packets", "Received packets"},
+		{"ib_xmit_pkts", "packets", "Transmitted packets"},
+	} {
+		if c.SendAbsoluteValues {
+			metrics = append(metrics, MetricDescription{
+				Name:        d.name,
+				Unit:        d.unit,
+				Scopes:      []string{"node"},
+				Kind:        METRIC_KIND_COUNTER,
+				Group:       "Network",
+				Description: d.description + " per Infiniband port",
+			})
+		}
+		if c.SendDerivedValues {
+			metrics = append(metrics, MetricDescription{
+				Name:        d.name + "_bw",
+				Unit:        d.unit + "/sec",
+				Scopes:      []string{"node"},
+				Kind:        METRIC_KIND_GAUGE,
+				Group:       "Network",
+				Description: d.description + " per second and Infiniband port",
+			})
+		}
+	}
+	if c.SendTotalValues {
+		metrics = append(metrics,
+			MetricDescription{
+				Name:        "ib_total",
+				Unit:        "bytes",
+				Scopes:      []string{"node"},
+				Kind:        METRIC_KIND_COUNTER,
+				Group:       "Network",
+				Description: "Received and transmitted bytes per Infiniband port",
+			},
+			MetricDescription{
+				Name:        "ib_total_pkts",
+				Unit:        "packets",
+				Scopes:      []string{"node"},
+				Kind:        METRIC_KIND_COUNTER,
+				Group:       "Network",
+				Description: "Received and transmitted packets per Infiniband port",
+			})
+	}
+	return metrics, nil
+}
+
 func (m *InfinibandCollector) Close() {
 	m.init = false
 }
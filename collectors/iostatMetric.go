@@ -11,7 +11,6 @@ import (
 	"bufio"
 	"encoding/json"
 	"errors"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -47,6 +46,7 @@ func (m *IOstatCollector) Init(config json.RawMessage) error {
 	m.parallel = true
 	m.meta = map[string]string{"source": m.name, "group": "Disk"}
 	m.setup()
+	m.enableInputRecording()
 	if len(config) > 0 {
 		err = json.Unmarshal(config, &m.config)
 		if err != nil {
@@ -83,7 +83,7 @@ func (m *IOstatCollector) Init(config json.RawMessage) error {
 	if len(m.matches) == 0 {
 		return errors.New("no metrics to collect")
 	}
-	file, err := os.Open(IOSTATFILE)
+	file, err := m.openFile(IOSTATFILE)
 	if err != nil {
 		cclog.ComponentError(m.name, err.Error())
 		return err
@@ -125,8 +125,9 @@ func (m *IOstatCollector) Read(interval time.Duration, output chan lp.CCMessage)
 	if !m.init {
 		return
 	}
+	now := m.now()
 
-	file, err := os.Open(IOSTATFILE)
+	file, err := m.openFile(IOSTATFILE)
 	if err != nil {
 		cclog.ComponentError(m.name, err.Error())
 		return
@@ -159,7 +160,7 @@ func (m *IOstatCollector) Read(interval time.Duration, output chan lp.CCMessage)
 				x, err := strconv.ParseInt(linefields[idx], 0, 64)
 				if err == nil {
 					diff := x - entry.lastValues[name]
-					y, err := lp.NewMessage(name, entry.tags, m.meta, map[string]interface{}{"value": int(diff)}, time.Now())
+					y, err := lp.NewMessage(name, entry.tags, m.meta, map[string]interface{}{"value": int(diff)}, now)
 					if err == nil {
 						output <- y
 					}
@@ -171,6 +172,43 @@ func (m *IOstatCollector) Read(interval time.Duration, output chan lp.CCMessage)
 	}
 }
 
+// DescribeMetrics returns the metrics the iostat collector can emit. All values are
+// differences to the previous read.
+func (m *IOstatCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	metrics := make([]MetricDescription, 0)
+	for _, d := range []struct {
+		name, unit, description string
+	}{
+		{"io_reads", "requests", "Completed read requests"},
+		{"io_reads_merged", "requests", "Merged read requests"},
+		{"io_read_sectors", "sectors", "Read sectors"},
+		{"io_read_ms", "ms", "Time spent reading"},
+		{"io_writes", "requests", "Completed write requests"},
+		{"io_writes_merged", "requests", "Merged write requests"},
+		{"io_writes_sectors", "sectors", "Written sectors"},
+		{"io_writes_ms", "ms", "Time spent writing"},
+		{"io_ioops", "requests", "I/O requests currently in progress"},
+		{"io_ioops_ms", "ms", "Time spent doing I/O"},
+		{"io_ioops_weighted_ms", "ms", "Weighted time spent doing I/O"},
+		{"io_discards", "requests", "Completed discard requests"},
+		{"io_discards_merged", "requests", "Merged discard requests"},
+		{"io_discards_sectors", "sectors", "Discarded sectors"},
+		{"io_discards_ms", "ms", "Time spent discarding"},
+		{"io_flushes", "requests", "Completed flush requests"},
+		{"io_flushes_ms", "ms", "Time spent flushing"},
+	} {
+		metrics = append(metrics, MetricDescription{
+			Name:        d.name,
+			Unit:        d.unit,
+			Scopes:      []string{"node"},
+			Kind:        METRIC_KIND_GAUGE,
+			Group:       "Disk",
+			Description: d.description + " per device since the last read",
+		})
+	}
+	return metrics, nil
+}
+
 func (m *IOstatCollector) Close() {
 	m.init = false
 }
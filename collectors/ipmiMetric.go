@@ -93,7 +93,7 @@ func (m *IpmiCollector) Init(config json.RawMessage) error {
 func (m *IpmiCollector) readIpmiTool(cmd string, output chan lp.CCMessage) {
 
 	// Setup ipmitool command
-	command := exec.Command(cmd, "sensor")
+	command := exec.CommandContext(m.readContext(), cmd, "sensor")
 	stdout, _ := command.StdoutPipe()
 	errBuf := new(bytes.Buffer)
 	command.Stderr = errBuf
@@ -150,7 +150,7 @@ func (m *IpmiCollector) readIpmiTool(cmd string, output chan lp.CCMessage) {
 
 func (m *IpmiCollector) readIpmiSensors(cmd string, output chan lp.CCMessage) {
 
-	command := exec.Command(cmd, "--comma-separated-output", "--sdr-cache-recreate")
+	command := exec.CommandContext(m.readContext(), cmd, "--comma-separated-output", "--sdr-cache-recreate")
 	command.Wait()
 	stdout, err := command.Output()
 	if err != nil {
@@ -192,6 +192,59 @@ func (m *IpmiCollector) Read(interval time.Duration, output chan lp.CCMessage) {
 	}
 }
 
+// DescribeMetrics returns the sensors reported by the configured IPMI reader on this host.
+// The reader is executed once, like in Read(). Without a usable reader no metric is described.
+func (m *IpmiCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	c := new(IpmiCollector)
+	c.name = "IpmiCollector"
+	c.meta = map[string]string{
+		"source": c.name,
+		"group":  "IPMI",
+	}
+	c.config.IpmitoolPath = "ipmitool"
+	c.config.IpmisensorsPath = "ipmi-sensors"
+	if len(config) > 0 {
+		err := json.Unmarshal(config, &c.config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var read func(cmd string, output chan lp.CCMessage)
+	var cmd string
+	if p, err := exec.LookPath(c.config.IpmitoolPath); err == nil {
+		read, cmd = c.readIpmiTool, p
+	} else if p, err := exec.LookPath(c.config.IpmisensorsPath); err == nil {
+		read, cmd = c.readIpmiSensors, p
+	} else {
+		cclog.ComponentError(c.name, "DescribeMetrics(): no usable IPMI reader found")
+		return []MetricDescription{}, nil
+	}
+
+	output := make(chan lp.CCMessage)
+	go func() {
+		read(cmd, output)
+		close(output)
+	}()
+	metrics := make([]MetricDescription, 0)
+	seen := make(map[string]bool)
+	for msg := range output {
+		if seen[msg.Name()] {
+			continue
+		}
+		seen[msg.Name()] = true
+		unit, _ := msg.GetMeta("unit")
+		metrics = append(metrics, MetricDescription{
+			Name:        msg.Name(),
+			Unit:        unit,
+			Scopes:      []string{"node"},
+			Kind:        METRIC_KIND_GAUGE,
+			Group:       "IPMI",
+			Description: "IPMI sensor reading",
+		})
+	}
+	return metrics, nil
+}
+
 func (m *IpmiCollector) Close() {
 	m.init = false
 }
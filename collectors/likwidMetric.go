@@ -178,10 +178,60 @@ func testLikwidMetricFormula(formula string, params []string) bool {
 	return err == nil
 }
 
-func getBaseFreq() float64 {
+// validateConfig checks the metric types and compiles all metric formulas
+// of the LIKWID collector configuration
+func (m *LikwidCollector) validateConfig(config json.RawMessage) []error {
+	errs := make([]error, 0)
+	var c LikwidCollectorConfig
+	err := json.Unmarshal(config, &c)
+	if err != nil {
+		return append(errs, err)
+	}
+	globalParams := []string{"time", "inverseClock"}
+	check := func(path string, metric LikwidCollectorMetricConfig, params []string) bool {
+		if !checkMetricType(metric.Type) {
+			errs = append(errs, fmt.Errorf("%s: metric %s uses invalid type '%s'", path, metric.Name, metric.Type))
+			return false
+		}
+		myparams := make(map[string]float64)
+		for _, p := range params {
+			myparams[p] = float64(1.0)
+		}
+		if err := agg.CheckCondition(metric.Calc); err != nil {
+			errs = append(errs, fmt.Errorf("%s: metric %s: invalid calc '%s': %v", path, metric.Name, metric.Calc, err))
+			return false
+		}
+		if _, err := agg.EvalFloat64Condition(metric.Calc, myparams); err != nil {
+			errs = append(errs, fmt.Errorf("%s: metric %s: calc '%s' cannot be calculated with given counters: %v", path, metric.Name, metric.Calc, err))
+			return false
+		}
+		return true
+	}
+	for i, evset := range c.Eventsets {
+		if len(evset.Events) == 0 {
+			errs = append(errs, fmt.Errorf("eventsets[%d]: no events given", i))
+			continue
+		}
+		params := []string{"time", "inverseClock"}
+		for counter := range evset.Events {
+			params = append(params, counter)
+		}
+		for j, metric := range evset.Metrics {
+			if check(fmt.Sprintf("eventsets[%d].metrics[%d]", i, j), metric, params) {
+				globalParams = append(globalParams, metric.Name)
+			}
+		}
+	}
+	for i, metric := range c.Metrics {
+		check(fmt.Sprintf("globalmetrics[%d]", i), metric, globalParams)
+	}
+	return errs
+}
+
+func getBaseFreq(hostPath func(string) string) float64 {
 	files := []string{
-		"/sys/devices/system/cpu/cpu0/cpufreq/bios_limit",
-		"/sys/devices/system/cpu/cpu0/cpufreq/base_frequency",
+		hostPath("/sys/devices/system/cpu/cpu0/cpufreq/bios_limit"),
+		hostPath("/sys/devices/system/cpu/cpu0/cpufreq/base_frequency"),
 	}
 	var freq float64 = math.NaN()
 	for _, f := range files {
@@ -361,7 +411,7 @@ func (m *LikwidCollector) Init(config json.RawMessage) error {
 		m.tid2socket[c.CpuID] = c.Socket
 	}
 
-	m.basefreq = getBaseFreq()
+	m.basefreq = getBaseFreq(m.hostPath)
 	m.init = true
 	return nil
 }
@@ -581,7 +631,7 @@ func (m *LikwidCollector) calcEventsetMetrics(evset LikwidEventsetConfig, interv
 		}
 		// Send all metrics with same time stamp
 		// This function does only computiation, counter measurement is done before
-		now := time.Now()
+		now := m.now()
 		for domain, tid := range scopemap {
 			if tid >= 0 && len(metric.Calc) > 0 {
 				value, err := agg.EvalFloat64Condition(metric.Calc, evset.results[tid])
@@ -734,7 +784,7 @@ func (m *LikwidCollector) calcEventsetMetrics(evset LikwidEventsetConfig, interv
 func (m *LikwidCollector) calcGlobalMetrics(groups []LikwidEventsetConfig, interval time.Duration, output chan lp.CCMessage) error {
 	// Send all metrics with same time stamp
 	// This function does only computiation, counter measurement is done before
-	now := time.Now()
+	now := m.now()
 
 	for _, metric := range m.config.Metrics {
 		// The metric scope is determined in the Init() function
@@ -833,6 +883,48 @@ func (m *LikwidCollector) Read(interval time.Duration, output chan lp.CCMessage)
 	})
 }
 
+// DescribeMetrics returns the published metrics of all configured event sets and global metrics
+func (m *LikwidCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	var c LikwidCollectorConfig
+	err := json.Unmarshal(config, &c)
+	if err != nil {
+		return nil, err
+	}
+	metrics := make([]MetricDescription, 0)
+	describe := func(metric LikwidCollectorMetricConfig) {
+		if !metric.Publish {
+			return
+		}
+		scopes := []string{metric.Type}
+		if metric.SendCoreTotalVal {
+			scopes = append(scopes, "core")
+		}
+		if metric.SendSocketTotalVal {
+			scopes = append(scopes, "socket")
+		}
+		if metric.SendNodeTotalVal {
+			scopes = append(scopes, "node")
+		}
+		metrics = append(metrics, MetricDescription{
+			Name:        metric.Name,
+			Unit:        metric.Unit,
+			Scopes:      scopes,
+			Kind:        METRIC_KIND_GAUGE,
+			Group:       "PerfCounter",
+			Description: metric.Calc,
+		})
+	}
+	for _, evset := range c.Eventsets {
+		for _, metric := range evset.Metrics {
+			describe(metric)
+		}
+	}
+	for _, metric := range c.Metrics {
+		describe(metric)
+	}
+	return metrics, nil
+}
+
 func (m *LikwidCollector) Close() {
 	if m.init {
 		m.init = false
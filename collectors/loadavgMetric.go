@@ -10,7 +10,6 @@ package collectors
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -43,6 +42,7 @@ func (m *LoadavgCollector) Init(config json.RawMessage) error {
 	m.name = "LoadavgCollector"
 	m.parallel = true
 	m.setup()
+	m.enableInputRecording()
 	if len(config) > 0 {
 		err := json.Unmarshal(config, &m.config)
 		if err != nil {
@@ -77,14 +77,15 @@ func (m *LoadavgCollector) Read(interval time.Duration, output chan lp.CCMessage
 	if !m.init {
 		return
 	}
-	buffer, err := os.ReadFile(LOADAVGFILE)
+	buffer, err := m.readFile(LOADAVGFILE)
 	if err != nil {
 		cclog.ComponentError(
 			m.name,
 			fmt.Sprintf("Read(): Failed to read file '%s': %v", LOADAVGFILE, err))
+		m.reportReadError(err)
 		return
 	}
-	now := time.Now()
+	now := m.now()
 
 	// Load metrics
 	ls := strings.Split(string(buffer), ` `)
@@ -126,6 +127,26 @@ func (m *LoadavgCollector) Read(interval time.Duration, output chan lp.CCMessage
 	}
 }
 
+// DescribeMetrics returns the metrics the loadavg collector can emit
+func (m *LoadavgCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	describe := func(name, description string) MetricDescription {
+		return MetricDescription{
+			Name:        name,
+			Scopes:      []string{"node"},
+			Kind:        METRIC_KIND_GAUGE,
+			Group:       "LOAD",
+			Description: description,
+		}
+	}
+	return []MetricDescription{
+		describe("load_one", "Load average of the last minute"),
+		describe("load_five", "Load average of the last 5 minutes"),
+		describe("load_fifteen", "Load average of the last 15 minutes"),
+		describe("proc_run", "Number of currently runnable processes"),
+		describe("proc_total", "Total number of processes"),
+	}, nil
+}
+
 func (m *LoadavgCollector) Close() {
 	m.init = false
 }
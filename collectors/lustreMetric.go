@@ -57,9 +57,9 @@ func (m *LustreCollector) getDeviceDataCommand(device string) []string {
 	var command *exec.Cmd
 	statsfile := fmt.Sprintf("llite.%s.stats", device)
 	if m.config.Sudo {
-		command = exec.Command(m.sudoCmd, m.lctl, LCTL_OPTION, statsfile)
+		command = exec.CommandContext(m.readContext(), m.sudoCmd, m.lctl, LCTL_OPTION, statsfile)
 	} else {
-		command = exec.Command(m.lctl, LCTL_OPTION, statsfile)
+		command = exec.CommandContext(m.readContext(), m.lctl, LCTL_OPTION, statsfile)
 	}
 	command.Wait()
 	stdout, _ := command.Output()
@@ -379,7 +379,7 @@ func (m *LustreCollector) Init(config json.RawMessage) error {
 			}
 		}
 	}
-	m.lastTimestamp = time.Now()
+	m.lastTimestamp = m.now()
 	m.init = true
 	return nil
 }
@@ -388,7 +388,7 @@ func (m *LustreCollector) Read(interval time.Duration, output chan lp.CCMessage)
 	if !m.init {
 		return
 	}
-	now := time.Now()
+	now := m.now()
 	tdiff := now.Sub(m.lastTimestamp)
 	for device, devData := range m.stats {
 		data := m.getDeviceDataCommand(device)
@@ -433,6 +433,41 @@ func (m *LustreCollector) Read(interval time.Duration, output chan lp.CCMessage)
 	m.lastTimestamp = now
 }
 
+// DescribeMetrics returns the metrics of the enabled value types (absolute, difference, derived)
+func (m *LustreCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	var c LustreCollectorConfig
+	if len(config) > 0 {
+		err := json.Unmarshal(config, &c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	metrics := make([]MetricDescription, 0)
+	describe := func(defs []LustreMetricDefinition, kind, description string) {
+		for _, def := range defs {
+			op := strings.TrimSuffix(strings.TrimPrefix(def.name, "lustre_"), "_diff")
+			metrics = append(metrics, MetricDescription{
+				Name:        def.name,
+				Unit:        def.unit,
+				Scopes:      []string{"node"},
+				Kind:        kind,
+				Group:       "Lustre",
+				Description: fmt.Sprintf(description, strings.ReplaceAll(op, "_", " ")),
+			})
+		}
+	}
+	if c.SendAbsoluteValues {
+		describe(LustreAbsMetrics, METRIC_KIND_COUNTER, "Lustre %s per device")
+	}
+	if c.SendDiffValues {
+		describe(LustreDiffMetrics, METRIC_KIND_GAUGE, "Lustre %s per device since the last read")
+	}
+	if c.SendDerivedValues {
+		describe(LustreDeriveMetrics, METRIC_KIND_GAUGE, "Lustre %s per device")
+	}
+	return metrics, nil
+}
+
 func (m *LustreCollector) Close() {
 	m.init = false
 }
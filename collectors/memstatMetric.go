@@ -12,7 +12,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
@@ -52,11 +51,12 @@ type MemstatStats struct {
 	unit  string
 }
 
-func getStats(filename string) map[string]MemstatStats {
+func (m *MemstatCollector) getStats(filename string) map[string]MemstatStats {
 	stats := make(map[string]MemstatStats)
-	file, err := os.Open(filename)
+	file, err := m.openFile(filename)
 	if err != nil {
 		cclog.Error(err.Error())
+		return stats
 	}
 	defer file.Close()
 
@@ -128,21 +128,22 @@ func (m *MemstatCollector) Init(config json.RawMessage) error {
 		return errors.New("no metrics to collect")
 	}
 	m.setup()
+	m.enableInputRecording()
 
 	if m.config.NodeStats {
-		if stats := getStats(MEMSTATFILE); len(stats) == 0 {
-			return fmt.Errorf("cannot read data from file %s", MEMSTATFILE)
+		if stats := m.getStats(MEMSTATFILE); len(stats) == 0 {
+			return fmt.Errorf("cannot read data from file %s", m.hostPath(MEMSTATFILE))
 		}
 	}
 
 	if m.config.NumaStats {
 		globPattern := filepath.Join(NUMA_MEMSTAT_BASE, "node[0-9]*", "meminfo")
-		regex := regexp.MustCompile(filepath.Join(NUMA_MEMSTAT_BASE, "node(\\d+)", "meminfo"))
-		files, err := filepath.Glob(globPattern)
+		regex := regexp.MustCompile(regexp.QuoteMeta(NUMA_MEMSTAT_BASE) + "/node(\\d+)/meminfo")
+		files, err := m.glob(globPattern)
 		if err == nil {
 			m.nodefiles = make(map[int]MemstatCollectorNode)
 			for _, f := range files {
-				if stats := getStats(f); len(stats) == 0 {
+				if stats := m.getStats(f); len(stats) == 0 {
 					return fmt.Errorf("cannot read data from file %s", f)
 				}
 				rematch := regex.FindStringSubmatch(f)
@@ -170,6 +171,7 @@ func (m *MemstatCollector) Read(interval time.Duration, output chan lp.CCMessage
 	if !m.init {
 		return
 	}
+	now := m.now()
 
 	sendStats := func(stats map[string]MemstatStats, tags map[string]string) {
 		for match, name := range m.matches {
@@ -182,7 +184,7 @@ func (m *MemstatCollector) Read(interval time.Duration, output chan lp.CCMessage
 				}
 			}
 
-			y, err := lp.NewMessage(name, tags, m.meta, map[string]interface{}{"value": value}, time.Now())
+			y, err := lp.NewMessage(name, tags, m.meta, map[string]interface{}{"value": value}, now)
 			if err == nil {
 				if len(unit) > 0 {
 					y.AddMeta("unit", unit)
@@ -215,7 +217,7 @@ func (m *MemstatCollector) Read(interval time.Duration, output chan lp.CCMessage
 					}
 				}
 			}
-			y, err := lp.NewMessage("mem_used", tags, m.meta, map[string]interface{}{"value": memUsed}, time.Now())
+			y, err := lp.NewMessage("mem_used", tags, m.meta, map[string]interface{}{"value": memUsed}, now)
 			if err == nil {
 				if len(unit) > 0 {
 					y.AddMeta("unit", unit)
@@ -226,18 +228,68 @@ func (m *MemstatCollector) Read(interval time.Duration, output chan lp.CCMessage
 	}
 
 	if m.config.NodeStats {
-		nodestats := getStats(MEMSTATFILE)
+		nodestats := m.getStats(MEMSTATFILE)
 		sendStats(nodestats, m.tags)
 	}
 
 	if m.config.NumaStats {
 		for _, nodeConf := range m.nodefiles {
-			stats := getStats(nodeConf.file)
+			stats := m.getStats(nodeConf.file)
 			sendStats(stats, nodeConf.tags)
 		}
 	}
 }
 
+// DescribeMetrics returns the metrics the memstat collector can emit
+func (m *MemstatCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	var c MemstatCollectorConfig
+	if len(config) > 0 {
+		err := json.Unmarshal(config, &c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	scopes := make([]string, 0)
+	if c.NodeStats {
+		scopes = append(scopes, "node")
+	}
+	if c.NumaStats {
+		scopes = append(scopes, "memoryDomain")
+	}
+	metrics := make([]MetricDescription, 0)
+	if len(scopes) == 0 {
+		return metrics, nil
+	}
+	for _, d := range []struct {
+		match, name, description string
+	}{
+		{"MemTotal", "mem_total", "Total usable memory"},
+		{"SwapTotal", "swap_total", "Total swap space"},
+		{"SReclaimable", "mem_sreclaimable", "Reclaimable part of the kernel slab memory"},
+		{"Slab", "mem_slab", "Kernel slab memory"},
+		{"MemFree", "mem_free", "Unused memory"},
+		{"Buffers", "mem_buffers", "Memory used for block device buffers"},
+		{"Cached", "mem_cached", "Memory used for the page cache"},
+		{"MemAvailable", "mem_available", "Memory available for starting new applications"},
+		{"SwapFree", "swap_free", "Unused swap space"},
+		{"MemShared", "mem_shared", "Shared memory"},
+		{"mem_used", "mem_used", "mem_total - (mem_free + mem_buffers + mem_cached)"},
+	} {
+		if _, skip := stringArrayContains(c.ExcludeMetrics, d.match); skip {
+			continue
+		}
+		metrics = append(metrics, MetricDescription{
+			Name:        d.name,
+			Unit:        "kB",
+			Scopes:      scopes,
+			Kind:        METRIC_KIND_GAUGE,
+			Group:       "Memory",
+			Description: d.description,
+		})
+	}
+	return metrics, nil
+}
+
 func (m *MemstatCollector) Close() {
 	m.init = false
 }
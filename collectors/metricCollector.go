@@ -8,11 +8,15 @@
 package collectors
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/clock"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/hostfs"
 )
 
 type MetricCollector interface {
@@ -24,11 +28,156 @@ type MetricCollector interface {
 	Close()                                                // Close / finish metric collector
 }
 
+// Kinds of metrics
+const (
+	METRIC_KIND_GAUGE   = "gauge"   // Value at the time of the read like a fill level or a rate
+	METRIC_KIND_COUNTER = "counter" // Monotonically increasing value
+)
+
+// MetricDescription describes a metric a collector can emit
+type MetricDescription struct {
+	Name        string   `json:"name"`                  // Name of the metric
+	Unit        string   `json:"unit,omitempty"`        // Unit of the metric if known in advance
+	Scopes      []string `json:"scopes"`                // Values of the 'type' tag (node, socket, hwthread, ...)
+	Kind        string   `json:"kind"`                  // METRIC_KIND_GAUGE or METRIC_KIND_COUNTER
+	Group       string   `json:"group,omitempty"`       // Value of the 'group' meta data tag
+	Description string   `json:"description,omitempty"` // Short description of the metric
+}
+
+// Optional interface for metric collectors that describe the metrics they can emit.
+// The description is derived from the configuration only, the collector is not initialized.
+type MetricDescriber interface {
+	DescribeMetrics(config json.RawMessage) ([]MetricDescription, error)
+}
+
 type metricCollector struct {
 	name     string            // name of the metric
 	init     bool              // is metric collector initialized?
 	parallel bool              // can the metric collector be executed in parallel with others
 	meta     map[string]string // static meta data tags
+	ctx      context.Context   // context of the current read, canceled when the read timeout is exceeded
+	readErr  error             // error of the current read reported by the metric collector
+	interval time.Duration     // read interval of the metric collector
+	skipped  uint64            // number of read intervals skipped before the current read
+	clock    clock.Clock       // clock of the collector manager, nil if not set
+	roots    hostfs.Roots      // procfs and sysfs directories of the collector
+
+	recordable bool            // collector reads all inputs with the helpers of collectorInputs.go
+	inputs     *recordedInputs // inputs of the current Init() or Read() while recording or replaying
+	replay     bool            // inputs are replayed instead of recorded
+	inputsLock sync.Mutex
+}
+
+// Interface to pass the procfs and sysfs directories of a collector
+type hostRootsSetter interface {
+	setHostRoots(roots hostfs.Roots)
+}
+
+// setHostRoots sets the procfs and sysfs directories used by hostPath()
+func (c *metricCollector) setHostRoots(roots hostfs.Roots) {
+	c.roots = roots
+}
+
+// hostPath rebases an absolute path below /proc or /sys to the procfs and sysfs
+// directories of the collector ('procfs_root', 'sysfs_root'). All files in procfs
+// and sysfs must be accessed with it.
+func (c *metricCollector) hostPath(path string) string {
+	return c.roots.Path(path)
+}
+
+// Interface to pass the clock of the collector manager to the metric collector
+type clockSetter interface {
+	setClock(c clock.Clock)
+}
+
+// setClock sets the clock used by now()
+func (c *metricCollector) setClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+// getClock returns the clock of the collector manager or the real clock if it is not set.
+// Collectors with timers should create them with it, so they can be tested with a fake clock.
+func (c *metricCollector) getClock() clock.Clock {
+	if c.clock != nil {
+		return c.clock
+	}
+	return clock.Real
+}
+
+// now returns the current time of the collector manager's clock. Collectors deriving
+// rates from the time between two reads should use it instead of time.Now(), so they
+// can be tested with a fake clock. While recording inputs the time is recorded, while
+// replaying the recorded time is returned.
+func (c *metricCollector) now() time.Time {
+	live := c.getClock().Now
+	if t, ok := c.inputTime(live); ok {
+		return t
+	}
+	return live()
+}
+
+// Interface to pass the read interval to the metric collector
+type readIntervalSetter interface {
+	setReadInterval(interval time.Duration)
+}
+
+// setReadInterval sets the interval in which the metric collector is read
+func (c *metricCollector) setReadInterval(interval time.Duration) {
+	c.interval = interval
+}
+
+// Interface to pass the number of skipped read intervals to the metric collector
+type skippedIntervalsSetter interface {
+	setSkippedIntervals(skipped uint64)
+}
+
+// setSkippedIntervals sets the number of read intervals skipped before the current read
+func (c *metricCollector) setSkippedIntervals(skipped uint64) {
+	c.skipped = skipped
+}
+
+// skippedIntervals returns the number of read intervals skipped before the current read
+// because the collector manager was busy. Collectors deriving values from the read
+// interval instead of the measured time between two reads can use it to compensate.
+func (c *metricCollector) skippedIntervals() uint64 {
+	return c.skipped
+}
+
+// Interface to get the error of the last read of a metric collector
+type readErrorReporter interface {
+	takeReadError() error
+}
+
+// reportReadError marks the current read as failed. The collector manager counts
+// failed reads and disables the collector after 'max_failures' consecutive failures.
+func (c *metricCollector) reportReadError(err error) {
+	c.readErr = err
+}
+
+// takeReadError returns and resets the error of the last read
+func (c *metricCollector) takeReadError() error {
+	err := c.readErr
+	c.readErr = nil
+	return err
+}
+
+// Interface to pass the context of the current read to the metric collector
+type readContextSetter interface {
+	setReadContext(ctx context.Context)
+}
+
+// setReadContext sets the context of the current read
+func (c *metricCollector) setReadContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
+// readContext returns the context of the current read. Use it for external commands
+// (exec.CommandContext), so they are killed when the read timeout is exceeded.
+func (c *metricCollector) readContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
 }
 
 // Name returns the name of the metric collector
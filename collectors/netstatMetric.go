@@ -11,7 +11,6 @@ import (
 	"bufio"
 	"encoding/json"
 	"errors"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -66,7 +65,8 @@ func (m *NetstatCollector) Init(config json.RawMessage) error {
 	m.name = "NetstatCollector"
 	m.parallel = true
 	m.setup()
-	m.lastTimestamp = time.Now()
+	m.enableInputRecording()
+	m.lastTimestamp = m.now()
 
 	const (
 		fieldInterface = iota
@@ -105,7 +105,7 @@ func (m *NetstatCollector) Init(config json.RawMessage) error {
 	m.buildAliasMapping()
 
 	// Check access to net statistic file
-	file, err := os.Open(NETSTATFILE)
+	file, err := m.openFile(NETSTATFILE)
 	if err != nil {
 		cclog.ComponentError(m.name, err.Error())
 		return err
@@ -186,13 +186,13 @@ func (m *NetstatCollector) Read(interval time.Duration, output chan lp.CCMessage
 		return
 	}
 	// Current time stamp
-	now := time.Now()
+	now := m.now()
 	// time difference to last time stamp
 	timeDiff := now.Sub(m.lastTimestamp).Seconds()
 	// Save current timestamp
 	m.lastTimestamp = now
 
-	file, err := os.Open(NETSTATFILE)
+	file, err := m.openFile(NETSTATFILE)
 	if err != nil {
 		cclog.ComponentError(m.name, err.Error())
 		return
@@ -244,6 +244,51 @@ func (m *NetstatCollector) Read(interval time.Duration, output chan lp.CCMessage
 	}
 }
 
+// DescribeMetrics returns the metrics the netstat collector can emit
+func (m *NetstatCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	c := NetstatCollectorConfig{
+		SendAbsoluteValues: true,
+		SendDerivedValues:  false,
+	}
+	if len(config) > 0 {
+		err := json.Unmarshal(config, &c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	metrics := make([]MetricDescription, 0)
+	for _, d := range []struct {
+		name, unit, description string
+	}{
+		{"net_bytes_in", "bytes", "Received bytes"},
+		{"net_bytes_out", "bytes", "Transmitted bytes"},
+		{"net_pkts_in", "packets", "Received packets"},
+		{"net_pkts_out", "packets", "Transmitted packets"},
+	} {
+		if c.SendAbsoluteValues {
+			metrics = append(metrics, MetricDescription{
+				Name:        d.name,
+				Unit:        d.unit,
+				Scopes:      []string{"node"},
+				Kind:        METRIC_KIND_COUNTER,
+				Group:       "Network",
+				Description: d.description + " per network device",
+			})
+		}
+		if c.SendDerivedValues {
+			metrics = append(metrics, MetricDescription{
+				Name:        d.name + "_bw",
+				Unit:        d.unit + "/sec",
+				Scopes:      []string{"node"},
+				Kind:        METRIC_KIND_GAUGE,
+				Group:       "Network",
+				Description: d.description + " per second and network device",
+			})
+		}
+	}
+	return metrics, nil
+}
+
 func (m *NetstatCollector) Close() {
 	m.init = false
 }
@@ -43,9 +43,7 @@ type nfsCollector struct {
 }
 
 func (m *nfsCollector) initStats() error {
-	cmd := exec.Command(m.config.Nfsstats, `-l`, `--all`)
-	cmd.Wait()
-	buffer, err := cmd.Output()
+	buffer, err := m.command(m.config.Nfsstats, `-l`, `--all`)
 	if err == nil {
 		for _, line := range strings.Split(string(buffer), "\n") {
 			lf := strings.Fields(line)
@@ -70,9 +68,7 @@ func (m *nfsCollector) initStats() error {
 }
 
 func (m *nfsCollector) updateStats() error {
-	cmd := exec.Command(m.config.Nfsstats, `-l`, `--all`)
-	cmd.Wait()
-	buffer, err := cmd.Output()
+	buffer, err := m.command(m.config.Nfsstats, `-l`, `--all`)
 	if err == nil {
 		for _, line := range strings.Split(string(buffer), "\n") {
 			lf := strings.Fields(line)
@@ -113,10 +109,13 @@ func (m *nfsCollector) MainInit(config json.RawMessage) error {
 	m.tags = map[string]string{
 		"type": "node",
 	}
-	// Check if nfsstat is in executable search path
-	_, err := exec.LookPath(m.config.Nfsstats)
-	if err != nil {
-		return fmt.Errorf("NfsCollector.Init(): Failed to find nfsstat binary '%s': %v", m.config.Nfsstats, err)
+	m.enableInputRecording()
+	// Check if nfsstat is in executable search path. Replayed outputs do not need it.
+	if !m.replaying() {
+		_, err := exec.LookPath(m.config.Nfsstats)
+		if err != nil {
+			return fmt.Errorf("NfsCollector.Init(): Failed to find nfsstat binary '%s': %v", m.config.Nfsstats, err)
+		}
 	}
 	m.data = make(map[string]NfsCollectorData)
 	m.initStats()
@@ -129,7 +128,7 @@ func (m *nfsCollector) Read(interval time.Duration, output chan lp.CCMessage) {
 	if !m.init {
 		return
 	}
-	timestamp := time.Now()
+	timestamp := m.now()
 
 	m.updateStats()
 	prefix := ""
@@ -159,6 +158,22 @@ func (m *nfsCollector) Close() {
 	m.init = false
 }
 
+// describeNfsMetrics returns the descriptions of the operation counters reported by nfsstat
+func describeNfsMetrics(prefix string, operations []string) []MetricDescription {
+	metrics := make([]MetricDescription, 0, len(operations))
+	for _, op := range operations {
+		metrics = append(metrics, MetricDescription{
+			Name:        prefix + "_" + op,
+			Unit:        "calls",
+			Scopes:      []string{"node"},
+			Kind:        METRIC_KIND_GAUGE,
+			Group:       "NFS",
+			Description: fmt.Sprintf("Client %s calls since the last read", op),
+		})
+	}
+	return metrics
+}
+
 type Nfs3Collector struct {
 	nfsCollector
 }
@@ -180,3 +195,27 @@ func (m *Nfs4Collector) Init(config json.RawMessage) error {
 	m.setup()
 	return m.MainInit(config)
 }
+
+// DescribeMetrics returns the NFSv3 operations listed by nfsstat
+func (m *Nfs3Collector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	return describeNfsMetrics("nfs3", []string{
+		"total", "null", "getattr", "setattr", "lookup", "access", "readlink",
+		"read", "write", "create", "mkdir", "symlink", "remove", "rmdir",
+		"rename", "link", "readdir", "readdirplus", "fsstat", "fsinfo",
+		"pathconf", "commit",
+	}), nil
+}
+
+// DescribeMetrics returns the NFSv4 operations listed by nfsstat
+func (m *Nfs4Collector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	return describeNfsMetrics("nfs4", []string{
+		"total", "null", "read", "write", "commit", "open", "open_conf",
+		"open_noat", "open_dgrd", "close", "setattr", "fsinfo", "renew",
+		"setclntid", "confirm", "lock", "lockt", "locku", "access", "getattr",
+		"lookup", "lookup_root", "remove", "rename", "link", "symlink", "create",
+		"pathconf", "statfs", "readlink", "readdir", "server_caps", "delegreturn",
+		"getacl", "setacl", "rel_lkowner", "exchange_id", "create_session",
+		"destroy_session", "sequence", "get_lease_time", "reclaim_comp",
+		"secinfo_no", "bind_conn_to_ses",
+	}), nil
+}
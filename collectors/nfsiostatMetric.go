@@ -10,7 +10,6 @@ package collectors
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -59,8 +58,8 @@ func resolve_regex_fields(s string, regex *regexp.Regexp) map[string]string {
 
 func (m *NfsIOStatCollector) readNfsiostats() map[string]map[string]int64 {
 	data := make(map[string]map[string]int64)
-	filename := "/proc/self/mountstats"
-	stats, err := os.ReadFile(filename)
+	// The mounts of the init process, see MOUNTFILE
+	stats, err := m.readFile("/proc/1/mountstats")
 	if err != nil {
 		return data
 	}
@@ -103,6 +102,7 @@ func (m *NfsIOStatCollector) Init(config json.RawMessage) error {
 	var err error = nil
 	m.name = "NfsIOStatCollector"
 	m.setup()
+	m.enableInputRecording()
 	m.parallel = true
 	m.meta = map[string]string{"source": m.name, "group": "NFS", "unit": "bytes"}
 	m.tags = map[string]string{"type": "node"}
@@ -122,13 +122,13 @@ func (m *NfsIOStatCollector) Init(config json.RawMessage) error {
 		m.key = "server"
 	}
 	m.data = m.readNfsiostats()
-	m.lastTimestamp = time.Now()
+	m.lastTimestamp = m.now()
 	m.init = true
 	return err
 }
 
 func (m *NfsIOStatCollector) Read(interval time.Duration, output chan lp.CCMessage) {
-	now := time.Now()
+	now := m.now()
 	timeDiff := now.Sub(m.lastTimestamp).Seconds()
 	m.lastTimestamp = now
 
@@ -183,6 +183,63 @@ func (m *NfsIOStatCollector) Read(interval time.Duration, output chan lp.CCMessa
 	}
 }
 
+// DescribeMetrics returns the metrics the nfsiostat collector can emit. The excluded metrics
+// are given without the nfsio_ prefix, so they are filtered here.
+func (m *NfsIOStatCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	c := NfsIOStatCollectorConfig{
+		SendAbsoluteValues: true,
+		SendDerivedValues:  false,
+	}
+	if len(config) > 0 {
+		err := json.Unmarshal(config, &c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	metrics := make([]MetricDescription, 0)
+	for _, d := range []struct {
+		name, unit, description string
+	}{
+		{"nread", "bytes", "Bytes transferred by normal read() calls"},
+		{"nwrite", "bytes", "Bytes transferred by normal write() calls"},
+		{"oread", "bytes", "Bytes transferred by read() calls with O_DIRECT"},
+		{"owrite", "bytes", "Bytes transferred by write() calls with O_DIRECT"},
+		{"pageread", "4K_pages", "Pages transferred by read() calls"},
+		{"pagewrite", "4K_pages", "Pages transferred by write() calls"},
+		{"nfsread", "bytes", "Bytes transferred for reading from the server"},
+		{"nfswrite", "bytes", "Bytes transferred for writing to the server"},
+	} {
+		if _, skip := stringArrayContains(c.ExcludeMetrics, d.name); skip {
+			continue
+		}
+		if c.SendAbsoluteValues {
+			metrics = append(metrics, MetricDescription{
+				Name:        "nfsio_" + d.name,
+				Unit:        d.unit,
+				Scopes:      []string{"node"},
+				Kind:        METRIC_KIND_COUNTER,
+				Group:       "NFS",
+				Description: d.description,
+			})
+		}
+		if c.SendDerivedValues {
+			unit := "bytes/sec"
+			if d.unit == "4K_pages" {
+				unit = "4K_pages/s"
+			}
+			metrics = append(metrics, MetricDescription{
+				Name:        "nfsio_" + d.name + "_bw",
+				Unit:        unit,
+				Scopes:      []string{"node"},
+				Kind:        METRIC_KIND_GAUGE,
+				Group:       "NFS",
+				Description: d.description + " per second",
+			})
+		}
+	}
+	return metrics, nil
+}
+
 func (m *NfsIOStatCollector) Close() {
 	// Unset flag
 	m.init = false
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -73,6 +72,7 @@ func (m *NUMAStatsCollector) Init(config json.RawMessage) error {
 	m.name = "NUMAStatsCollector"
 	m.parallel = true
 	m.setup()
+	m.enableInputRecording()
 	m.meta = map[string]string{
 		"source": m.name,
 		"group":  "NUMA",
@@ -89,7 +89,7 @@ func (m *NUMAStatsCollector) Init(config json.RawMessage) error {
 	// Loop for all NUMA node directories
 	base := "/sys/devices/system/node/node"
 	globPattern := base + "[0-9]*"
-	dirs, err := filepath.Glob(globPattern)
+	dirs, err := m.glob(globPattern)
 	if err != nil {
 		return fmt.Errorf("unable to glob files with pattern '%s'", globPattern)
 	}
@@ -119,7 +119,7 @@ func (m *NUMAStatsCollector) Read(interval time.Duration, output chan lp.CCMessa
 		return
 	}
 
-	now := time.Now()
+	now := m.now()
 	timeDiff := now.Sub(m.lastTimestamp).Seconds()
 	m.lastTimestamp = now
 
@@ -127,7 +127,7 @@ func (m *NUMAStatsCollector) Read(interval time.Duration, output chan lp.CCMessa
 		// Loop for all NUMA domains
 		t := &m.topology[i]
 
-		file, err := os.Open(t.file)
+		file, err := m.openFile(t.file)
 		if err != nil {
 			cclog.ComponentError(
 				m.name,
@@ -187,6 +187,51 @@ func (m *NUMAStatsCollector) Read(interval time.Duration, output chan lp.CCMessa
 	}
 }
 
+// DescribeMetrics returns the metrics the numastats collector can emit
+func (m *NUMAStatsCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	c := NUMAStatsCollectorConfig{
+		SendAbsoluteValues: true,
+	}
+	if len(config) > 0 {
+		err := json.Unmarshal(config, &c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	metrics := make([]MetricDescription, 0)
+	for _, d := range []struct {
+		key, description string
+	}{
+		{"numa_hit", "Memory successfully allocated on this node as intended"},
+		{"numa_miss", "Memory allocated on this node despite the process preferring some different node"},
+		{"numa_foreign", "Memory intended for this node, but actually allocated on some different node"},
+		{"local_node", "Memory allocated on this node while a process was running on it"},
+		{"other_node", "Memory allocated on this node while a process was running on some other node"},
+		{"interleave_hit", "Interleaved memory successfully allocated on this node"},
+	} {
+		if c.SendAbsoluteValues {
+			metrics = append(metrics, MetricDescription{
+				Name:        "numastats_" + d.key,
+				Scopes:      []string{"memoryDomain"},
+				Kind:        METRIC_KIND_COUNTER,
+				Group:       "NUMA",
+				Description: d.description,
+			})
+		}
+		if c.SendDerivedValues {
+			metrics = append(metrics, MetricDescription{
+				Name:        "numastats_" + d.key + "_rate",
+				Unit:        "1/s",
+				Scopes:      []string{"memoryDomain"},
+				Kind:        METRIC_KIND_GAUGE,
+				Group:       "NUMA",
+				Description: d.description + " (per second)",
+			})
+		}
+	}
+	return metrics, nil
+}
+
 func (m *NUMAStatsCollector) Close() {
 	m.init = false
 }
@@ -159,7 +159,7 @@ func (m *NvidiaCollector) Init(config json.RawMessage) error {
 		// Add device handle
 		g.device = device
 		g.lastEnergyReading = 0
-		g.lastEnergyTimestamp = time.Now()
+		g.lastEnergyTimestamp = m.now()
 
 		// Add tags
 		g.tags = map[string]string{
@@ -475,12 +475,11 @@ func readPowerUsage(device *NvidiaCollectorDevice, output chan lp.CCMessage) err
 	return nil
 }
 
-func readEnergyConsumption(device *NvidiaCollectorDevice, output chan lp.CCMessage) error {
+func readEnergyConsumption(device *NvidiaCollectorDevice, now time.Time, output chan lp.CCMessage) error {
 	// Retrieves total energy consumption for this GPU in millijoules (mJ) since the driver was last reloaded
 
 	// For Volta or newer fully supported devices.
 	if (!device.excludeMetrics["nv_energy"]) && (!device.excludeMetrics["nv_energy_abs"]) && (!device.excludeMetrics["nv_average_power"]) {
-		now := time.Now()
 		mode, ret := nvml.DeviceGetPowerManagementMode(device.device)
 		if ret != nvml.SUCCESS {
 			return nil
@@ -515,7 +514,7 @@ func readEnergyConsumption(device *NvidiaCollectorDevice, output chan lp.CCMessa
 					}
 				}
 				device.lastEnergyReading = energy
-				device.lastEnergyTimestamp = time.Now()
+				device.lastEnergyTimestamp = now
 			}
 		}
 	}
@@ -760,7 +759,7 @@ func readRemappedRows(device *NvidiaCollectorDevice, output chan lp.CCMessage) e
 				}
 			}
 			if !device.excludeMetrics["nv_remapped_rows_uncorrected"] {
-				y, err := lp.NewMessage("nv_remapped_rows_corrected", device.tags, device.meta, map[string]interface{}{"value": float64(uncorrected)}, time.Now())
+				y, err := lp.NewMessage("nv_remapped_rows_uncorrected", device.tags, device.meta, map[string]interface{}{"value": float64(uncorrected)}, time.Now())
 				if err == nil {
 					output <- y
 				}
@@ -1171,7 +1170,7 @@ func (m *NvidiaCollector) Read(interval time.Duration, output chan lp.CCMessage)
 			cclog.ComponentDebug(m.name, "readPowerUsage for device", name, "failed")
 		}
 
-		err = readEnergyConsumption(device, output)
+		err = readEnergyConsumption(device, m.now(), output)
 		if err != nil {
 			cclog.ComponentDebug(m.name, "readEnergyConsumption for device", name, "failed")
 		}
@@ -1315,6 +1314,99 @@ func (m *NvidiaCollector) Read(interval time.Duration, output chan lp.CCMessage)
 	}
 }
 
+// DescribeMetrics returns the metrics the nvidia collector can emit. The NVLink error
+// counters are sent per link (tag stype=nvlink) and summed up per GPU (suffix _sum).
+func (m *NvidiaCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	var c NvidiaCollectorConfig
+	if len(config) > 0 {
+		err := json.Unmarshal(config, &c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	excluded := func(name string) bool {
+		_, skip := stringArrayContains(c.ExcludeMetrics, name)
+		return skip
+	}
+	metrics := make([]MetricDescription, 0)
+	add := func(name, unit, kind, description string) {
+		metrics = append(metrics, MetricDescription{
+			Name:        name,
+			Unit:        unit,
+			Scopes:      []string{"accelerator"},
+			Kind:        kind,
+			Group:       "Nvidia",
+			Description: description,
+		})
+	}
+	add("nv_fb_mem_total", "MByte", METRIC_KIND_GAUGE, "Total frame buffer memory")
+	add("nv_fb_mem_used", "MByte", METRIC_KIND_GAUGE, "Used frame buffer memory")
+	add("nv_fb_mem_reserved", "MByte", METRIC_KIND_GAUGE, "Frame buffer memory reserved by the driver")
+	add("nv_bar1_mem_total", "MByte", METRIC_KIND_GAUGE, "Total BAR1 memory")
+	add("nv_bar1_mem_used", "MByte", METRIC_KIND_GAUGE, "Used BAR1 memory")
+	add("nv_util", "%", METRIC_KIND_GAUGE, "Time one or more kernels were running on the GPU")
+	add("nv_mem_util", "%", METRIC_KIND_GAUGE, "Time the device memory was read or written")
+	add("nv_temp", "degC", METRIC_KIND_GAUGE, "GPU temperature")
+	add("nv_fan", "%", METRIC_KIND_GAUGE, "Fan speed relative to the maximal speed")
+	add("nv_ecc_mode", "", METRIC_KIND_GAUGE, "ECC mode (ON, OFF, UNKNOWN or N/A)")
+	add("nv_perf_state", "", METRIC_KIND_GAUGE, "Performance state (P0 to P15)")
+	add("nv_power_usage", "watts", METRIC_KIND_GAUGE, "Power usage of the GPU and its circuitry")
+	if !excluded("nv_energy") && !excluded("nv_energy_abs") && !excluded("nv_average_power") {
+		add("nv_energy", "Joules", METRIC_KIND_GAUGE, "Energy consumption since the last read")
+		add("nv_energy_abs", "Joules", METRIC_KIND_COUNTER, "Energy consumption since the driver was loaded")
+		add("nv_average_power", "watts", METRIC_KIND_GAUGE, "Average power usage since the last read")
+	}
+	add("nv_graphics_clock", "MHz", METRIC_KIND_GAUGE, "Graphics clock")
+	add("nv_sm_clock", "MHz", METRIC_KIND_GAUGE, "Streaming multiprocessor clock")
+	add("nv_mem_clock", "MHz", METRIC_KIND_GAUGE, "Memory clock")
+	add("nv_video_clock", "MHz", METRIC_KIND_GAUGE, "Video encoder and decoder clock")
+	add("nv_max_graphics_clock", "MHz", METRIC_KIND_GAUGE, "Maximal graphics clock")
+	add("nv_max_sm_clock", "MHz", METRIC_KIND_GAUGE, "Maximal streaming multiprocessor clock")
+	add("nv_max_mem_clock", "MHz", METRIC_KIND_GAUGE, "Maximal memory clock")
+	add("nv_max_video_clock", "MHz", METRIC_KIND_GAUGE, "Maximal video encoder and decoder clock")
+	add("nv_ecc_uncorrected_error", "", METRIC_KIND_COUNTER, "Uncorrected ECC errors over the lifetime of the GPU")
+	add("nv_ecc_corrected_error", "", METRIC_KIND_COUNTER, "Corrected ECC errors over the lifetime of the GPU")
+	add("nv_power_max_limit", "watts", METRIC_KIND_GAUGE, "Maximal power limit")
+	add("nv_encoder_util", "%", METRIC_KIND_GAUGE, "Utilization of the video encoder")
+	add("nv_decoder_util", "%", METRIC_KIND_GAUGE, "Utilization of the video decoder")
+	add("nv_remapped_rows_corrected", "", METRIC_KIND_COUNTER, "Rows remapped due to correctable errors")
+	add("nv_remapped_rows_uncorrected", "", METRIC_KIND_COUNTER, "Rows remapped due to uncorrectable errors")
+	add("nv_remapped_rows_pending", "", METRIC_KIND_GAUGE, "1 if rows are pending remapping, 0 otherwise")
+	add("nv_remapped_rows_failure", "", METRIC_KIND_GAUGE, "1 if a row remapping failed, 0 otherwise")
+	add("nv_compute_processes", "", METRIC_KIND_GAUGE, "Number of compute processes on the GPU")
+	add("nv_graphics_processes", "", METRIC_KIND_GAUGE, "Number of graphics processes on the GPU")
+	for _, d := range []struct {
+		name, description string
+	}{
+		{"nv_violation_power", "power limit"},
+		{"nv_violation_thermal", "thermal limit"},
+		{"nv_violation_sync_boost", "sync boost"},
+		{"nv_violation_board_limit", "board limit"},
+		{"nv_violation_low_util", "low utilization"},
+		{"nv_violation_reliability", "board reliability limit"},
+		{"nv_violation_below_app_clock", "total application clocks limit"},
+		{"nv_violation_below_base_clock", "total base clocks limit"},
+	} {
+		add(d.name, "sec", METRIC_KIND_COUNTER, "Time the clocks were reduced by the "+d.description)
+	}
+	for _, d := range []struct {
+		name, description string
+	}{
+		{"nv_nvlink_crc_errors", "CRC errors in received data"},
+		{"nv_nvlink_ecc_errors", "ECC errors in received data"},
+		{"nv_nvlink_replay_errors", "Replays of transmitted data"},
+		{"nv_nvlink_recovery_errors", "Link recoveries"},
+		{"nv_nvlink_crc_flit_errors", "CRC errors in received flow control digits"},
+	} {
+		if excluded(d.name) {
+			continue
+		}
+		add(d.name, "", METRIC_KIND_COUNTER, d.description+" per NVLink")
+		add(d.name+"_sum", "", METRIC_KIND_COUNTER, d.description+" of all NVLinks")
+	}
+	return metrics, nil
+}
+
 func (m *NvidiaCollector) Close() {
 	if m.init {
 		nvml.Shutdown()
@@ -0,0 +1,52 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package collectors
+
+import (
+	"sort"
+	"sync"
+)
+
+// PipelineStat is a single statistic of a component of the metric pipeline
+// (router, channels, ...) reported by the self collector
+type PipelineStat struct {
+	Name  string            // Metric name
+	Tags  map[string]string // Additional tags, like the router input or the channel name
+	Unit  string            // Unit of the value (optional)
+	Value interface{}       // Value of the statistic
+}
+
+var (
+	pipelineStatsLock sync.Mutex
+	pipelineStats     = make(map[string]func() []PipelineStat)
+)
+
+// RegisterPipelineStats registers a function returning the statistics of a component of
+// the metric pipeline. The statistics are sent by the self collector with the option
+// 'read_pipeline_stats'. Registering a component again replaces its function.
+func RegisterPipelineStats(component string, stats func() []PipelineStat) {
+	pipelineStatsLock.Lock()
+	defer pipelineStatsLock.Unlock()
+	pipelineStats[component] = stats
+}
+
+// readPipelineStats returns the statistics of all registered components sorted by component name
+func readPipelineStats() []PipelineStat {
+	pipelineStatsLock.Lock()
+	defer pipelineStatsLock.Unlock()
+	components := make([]string, 0, len(pipelineStats))
+	for component := range pipelineStats {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	stats := make([]PipelineStat, 0)
+	for _, component := range components {
+		stats = append(stats, pipelineStats[component]()...)
+	}
+	return stats
+}
@@ -0,0 +1,458 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package collectors
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	cclog "github.com/ClusterCockpit/cc-lib/ccLogger"
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+	influx "github.com/influxdata/line-protocol"
+)
+
+// Version of the plugin protocol
+const PLUGIN_PROTOCOL_VERSION = 1
+
+// Output formats of the plugins
+const (
+	PLUGIN_FORMAT_JSON   = "json"
+	PLUGIN_FORMAT_INFLUX = "influx"
+)
+
+// Default timeouts and delays of the plugin collector
+const (
+	PLUGIN_DEFAULT_START_TIMEOUT     = 10 * time.Second
+	PLUGIN_DEFAULT_READ_TIMEOUT      = 10 * time.Second
+	PLUGIN_DEFAULT_MAX_RESTART_DELAY = 5 * time.Minute
+	PLUGIN_MIN_RESTART_DELAY         = time.Second
+	PLUGIN_STOP_TIMEOUT              = 2 * time.Second
+)
+
+type PluginCollectorConfig struct {
+	Command         string          `json:"command"`                     // Path of the plugin executable
+	Args            []string        `json:"args,omitempty"`              // Arguments of the plugin executable
+	Config          json.RawMessage `json:"config,omitempty"`            // Configuration sent to the plugin
+	StartTimeout    string          `json:"start_timeout,omitempty"`     // Maximal duration of the handshake
+	ReadTimeout     string          `json:"read_timeout,omitempty"`      // Maximal duration of a read
+	MaxRestartDelay string          `json:"max_restart_delay,omitempty"` // Maximal delay between restarts
+}
+
+// Message of the plugin protocol, sent to or received from the plugin as single JSON line
+type pluginMessage struct {
+	Type      string                 `json:"type"`
+	Version   int                    `json:"version,omitempty"`   // hello, init
+	Name      string                 `json:"name,omitempty"`      // hello: plugin name, metric: metric name
+	Format    string                 `json:"format,omitempty"`    // hello: output format of the metrics
+	Config    json.RawMessage        `json:"config,omitempty"`    // init
+	Interval  string                 `json:"interval,omitempty"`  // read
+	Duration  string                 `json:"duration,omitempty"`  // read
+	Skipped   uint64                 `json:"skipped,omitempty"`   // read: number of skipped read intervals
+	Timestamp int64                  `json:"timestamp,omitempty"` // read: unix time in nanoseconds
+	Message   string                 `json:"message,omitempty"`   // error, log
+	Tags      map[string]string      `json:"tags,omitempty"`      // metric
+	Meta      map[string]string      `json:"meta,omitempty"`      // metric
+	Fields    map[string]interface{} `json:"fields,omitempty"`    // metric
+	Time      int64                  `json:"time,omitempty"`      // metric: unix time in nanoseconds
+}
+
+var errPluginExited = errors.New("plugin exited")
+
+type PluginCollector struct {
+	metricCollector
+	config          PluginCollectorConfig
+	path            string
+	startTimeout    time.Duration
+	readTimeout     time.Duration
+	maxRestartDelay time.Duration
+	restartDelay    time.Duration // delay before the next restart, doubled after each failure
+	nextStart       time.Time     // earliest time of the next restart
+	format          string        // output format announced by the plugin
+	lock            sync.Mutex    // lock for the plugin process, a stalled Read() may still use it during Close()
+	cmd             *exec.Cmd
+	stdin           io.WriteCloser
+	stdout, stderr  io.ReadCloser
+	lines           chan string    // lines written by the plugin to stdout, closed when the plugin exits
+	done            chan struct{}  // closed when the plugin is stopped, its output is discarded afterwards
+	readers         sync.WaitGroup // goroutines reading stdout and stderr of the plugin
+	parser          *influx.Parser
+}
+
+// parseDuration parses an optional duration option
+func parseDuration(option, value string, defaultValue time.Duration) (time.Duration, error) {
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", option, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s: must be greater than zero", option)
+	}
+	return d, nil
+}
+
+func (m *PluginCollector) Init(config json.RawMessage) error {
+	var err error
+	m.name = "PluginCollector"
+	m.parallel = true
+	m.setup()
+	m.meta = map[string]string{"source": m.name, "group": "Plugin"}
+	if len(config) > 0 {
+		err = json.Unmarshal(config, &m.config)
+		if err != nil {
+			cclog.ComponentError(m.name, "Error reading config:", err.Error())
+			return err
+		}
+	}
+	if len(m.config.Command) == 0 {
+		return errors.New("no plugin command given")
+	}
+	m.path, err = exec.LookPath(m.config.Command)
+	if err != nil {
+		return fmt.Errorf("plugin command %s not found: %v", m.config.Command, err)
+	}
+	m.startTimeout, err = parseDuration("start_timeout", m.config.StartTimeout, PLUGIN_DEFAULT_START_TIMEOUT)
+	if err != nil {
+		return err
+	}
+	m.readTimeout, err = parseDuration("read_timeout", m.config.ReadTimeout, PLUGIN_DEFAULT_READ_TIMEOUT)
+	if err != nil {
+		return err
+	}
+	m.maxRestartDelay, err = parseDuration("max_restart_delay", m.config.MaxRestartDelay, PLUGIN_DEFAULT_MAX_RESTART_DELAY)
+	if err != nil {
+		return err
+	}
+	m.parser = influx.NewParser(influx.NewMetricHandler())
+	m.parser.SetTimeFunc(m.now)
+
+	// Start the plugin to check the handshake
+	err = m.start()
+	if err != nil {
+		return err
+	}
+	m.init = true
+	return nil
+}
+
+// validateConfig checks the command and the durations without starting the plugin
+func (m *PluginCollector) validateConfig(config json.RawMessage) []error {
+	errs := make([]error, 0)
+	var c PluginCollectorConfig
+	err := json.Unmarshal(config, &c)
+	if err != nil {
+		return append(errs, err)
+	}
+	if len(c.Command) == 0 {
+		errs = append(errs, errors.New("command: no plugin command given"))
+	}
+	for option, value := range map[string]string{
+		"start_timeout":     c.StartTimeout,
+		"read_timeout":      c.ReadTimeout,
+		"max_restart_delay": c.MaxRestartDelay,
+	} {
+		if _, err := parseDuration(option, value, 0); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// send writes a protocol message as JSON line to stdin of the plugin
+func (m *PluginCollector) send(msg pluginMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = m.stdin.Write(append(data, '\n'))
+	return err
+}
+
+// receive waits for the next line written by the plugin
+func (m *PluginCollector) receive(timeout <-chan time.Time, cancel <-chan struct{}) (string, error) {
+	select {
+	case line, ok := <-m.lines:
+		if !ok {
+			return "", errPluginExited
+		}
+		return line, nil
+	case <-timeout:
+		return "", errors.New("plugin did not answer in time")
+	case <-cancel:
+		return "", errors.New("read canceled")
+	}
+}
+
+// receiveMessage waits for the next protocol message of the plugin
+func (m *PluginCollector) receiveMessage(timeout <-chan time.Time) (pluginMessage, error) {
+	var msg pluginMessage
+	line, err := m.receive(timeout, nil)
+	if err != nil {
+		return msg, err
+	}
+	err = json.Unmarshal([]byte(line), &msg)
+	if err != nil {
+		return msg, fmt.Errorf("invalid protocol message '%s': %v", line, err)
+	}
+	return msg, nil
+}
+
+// start starts the plugin and performs the handshake. The caller has to hold the lock.
+// plugin -> {"type":"hello","version":1,"name":"...","format":"json|influx"}
+// collector -> {"type":"init","version":1,"config":{...}}
+// plugin -> {"type":"ready"} or {"type":"error","message":"..."}
+func (m *PluginCollector) start() error {
+	cmd := exec.Command(m.path, m.config.Args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start plugin %s: %v", m.path, err)
+	}
+	m.cmd = cmd
+	m.stdin, m.stdout, m.stderr = stdin, stdout, stderr
+	m.lines = make(chan string, 1024)
+	m.done = make(chan struct{})
+
+	// Both pipes are read until the plugin exits, cmd.Wait() must not be called before
+	lines, done := m.lines, m.done
+	m.readers.Add(2)
+	go func() {
+		defer m.readers.Done()
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-done:
+			}
+		}
+		close(lines)
+	}()
+	go func() {
+		defer m.readers.Done()
+		// Plugins may be verbose on stderr, failures are reported with error messages
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			cclog.ComponentDebug(m.name, "plugin stderr:", scanner.Text())
+		}
+	}()
+
+	timer := m.getClock().NewTimer(m.startTimeout)
+	defer timer.Stop()
+	hello, err := m.receiveMessage(timer.C())
+	if err == nil && hello.Type != "hello" {
+		err = fmt.Errorf("expected hello message, got '%s'", hello.Type)
+	}
+	if err == nil && hello.Version != PLUGIN_PROTOCOL_VERSION {
+		err = fmt.Errorf("unsupported protocol version %d, supported version is %d", hello.Version, PLUGIN_PROTOCOL_VERSION)
+	}
+	if err == nil {
+		switch hello.Format {
+		case "", PLUGIN_FORMAT_JSON:
+			m.format = PLUGIN_FORMAT_JSON
+		case PLUGIN_FORMAT_INFLUX:
+			m.format = PLUGIN_FORMAT_INFLUX
+		default:
+			err = fmt.Errorf("unsupported format '%s'", hello.Format)
+		}
+	}
+	if err == nil {
+		err = m.send(pluginMessage{Type: "init", Version: PLUGIN_PROTOCOL_VERSION, Config: m.config.Config})
+	}
+	if err == nil {
+		var ready pluginMessage
+		ready, err = m.receiveMessage(timer.C())
+		if err == nil && ready.Type == "error" {
+			err = fmt.Errorf("plugin initialization failed: %s", ready.Message)
+		} else if err == nil && ready.Type != "ready" {
+			err = fmt.Errorf("expected ready message, got '%s'", ready.Type)
+		}
+	}
+	if err != nil {
+		m.stop()
+		return fmt.Errorf("handshake with plugin %s failed: %v", m.path, err)
+	}
+	cclog.ComponentDebug(m.name, "Started plugin", hello.Name, "with format", m.format)
+	return nil
+}
+
+// stop asks the plugin to shut down and kills it if it does not exit in time. The
+// plugin has exited when the readers of its stdout and stderr reached the end of the
+// pipes, afterwards the process is released. The caller has to hold the lock.
+func (m *PluginCollector) stop() {
+	if m.cmd == nil {
+		return
+	}
+	m.send(pluginMessage{Type: "shutdown"})
+	m.stdin.Close()
+	close(m.done)
+	exited := make(chan error, 1)
+	go func(cmd *exec.Cmd) {
+		m.readers.Wait()
+		exited <- cmd.Wait()
+	}(m.cmd)
+	timer := m.getClock().NewTimer(PLUGIN_STOP_TIMEOUT)
+	defer timer.Stop()
+	select {
+	case <-exited:
+	case <-timer.C():
+		cclog.ComponentError(m.name, "Plugin did not exit in time, killing it")
+		m.cmd.Process.Kill()
+		// Child processes of the plugin may keep the pipes open
+		m.stdout.Close()
+		m.stderr.Close()
+		<-exited
+	}
+	m.cmd = nil
+}
+
+// failed stops the plugin after an error and schedules the restart.
+// The caller has to hold the lock.
+func (m *PluginCollector) failed(err error) {
+	m.stop()
+	m.restartDelay = min(max(2*m.restartDelay, PLUGIN_MIN_RESTART_DELAY), m.maxRestartDelay)
+	m.nextStart = m.now().Add(m.restartDelay)
+	cclog.ComponentError(m.name, err.Error(), "- restarting plugin in", m.restartDelay)
+	m.reportReadError(err)
+}
+
+// newMessage creates a message from a metric message of the plugin
+func (m *PluginCollector) newMessage(p pluginMessage) (lp.CCMessage, error) {
+	t := m.now()
+	if p.Time != 0 {
+		t = time.Unix(0, p.Time)
+	}
+	return lp.NewMessage(p.Name, p.Tags, p.Meta, p.Fields, t)
+}
+
+// forward sends a metric of the plugin with the default tags and meta data
+func (m *PluginCollector) forward(y lp.CCMessage, output chan lp.CCMessage) {
+	if !y.HasTag("type") {
+		y.AddTag("type", "node")
+	}
+	for k, v := range m.meta {
+		if !y.HasMeta(k) {
+			y.AddMeta(k, v)
+		}
+	}
+	output <- y
+}
+
+// Read sends a read request to the plugin and forwards all metrics until the plugin
+// answers with {"type":"end"}. A crashed or hanging plugin is restarted with an
+// exponential backoff.
+func (m *PluginCollector) Read(interval time.Duration, output chan lp.CCMessage) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.init {
+		return
+	}
+	if m.cmd == nil {
+		if m.now().Before(m.nextStart) {
+			return
+		}
+		err := m.start()
+		if err != nil {
+			m.failed(err)
+			return
+		}
+	}
+
+	err := m.send(pluginMessage{
+		Type:      "read",
+		Interval:  m.interval.String(),
+		Duration:  interval.String(),
+		Skipped:   m.skippedIntervals(),
+		Timestamp: m.now().UnixNano(),
+	})
+	if err != nil {
+		m.failed(fmt.Errorf("failed to send read request: %v", err))
+		return
+	}
+
+	timer := m.getClock().NewTimer(m.readTimeout)
+	defer timer.Stop()
+	for {
+		line, err := m.receive(timer.C(), m.readContext().Done())
+		if err != nil {
+			m.failed(err)
+			return
+		}
+		if !strings.HasPrefix(line, "{") {
+			if m.format != PLUGIN_FORMAT_INFLUX {
+				cclog.ComponentError(m.name, "Skipping invalid line:", line)
+				continue
+			}
+			metrics, err := m.parser.Parse([]byte(line))
+			if err != nil {
+				cclog.ComponentError(m.name, "Skipping invalid line:", line, err.Error())
+				continue
+			}
+			for _, metric := range metrics {
+				m.forward(lp.FromInfluxMetric(metric), output)
+			}
+			continue
+		}
+
+		var p pluginMessage
+		err = json.Unmarshal([]byte(line), &p)
+		if err != nil {
+			cclog.ComponentError(m.name, "Skipping invalid line:", line, err.Error())
+			continue
+		}
+		switch p.Type {
+		case "metric":
+			y, err := m.newMessage(p)
+			if err != nil {
+				cclog.ComponentError(m.name, "Skipping invalid metric:", line, err.Error())
+				continue
+			}
+			m.forward(y, output)
+		case "log":
+			cclog.ComponentDebug(m.name, "plugin:", p.Message)
+		case "error":
+			cclog.ComponentError(m.name, "plugin:", p.Message)
+			m.reportReadError(errors.New(p.Message))
+		case "end":
+			// Successful read, reset the restart delay
+			m.restartDelay = 0
+			return
+		default:
+			cclog.ComponentError(m.name, "Skipping unknown message type", p.Type)
+		}
+	}
+}
+
+// Close stops the plugin. It waits for a running Read(), which returns at the latest
+// after the read timeout.
+func (m *PluginCollector) Close() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.stop()
+	m.init = false
+}
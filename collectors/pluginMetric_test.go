@@ -0,0 +1,64 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package collectors
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+)
+
+// Plugin answering each read with end and then writing more lines than the
+// collector buffers
+const testPluginScript = `#!/bin/sh
+echo '{"type": "hello", "version": 1, "format": "json"}'
+read init
+echo '{"type": "ready"}'
+while read line; do
+	case "$line" in
+	*shutdown*) exit 0 ;;
+	*read*)
+		echo '{"type": "end"}'
+		i=0
+		while [ $i -lt 10000 ]; do
+			echo '{"type": "log", "message": "late"}'
+			i=$((i+1))
+		done ;;
+	esac
+done
+`
+
+func TestPluginStop(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "plugin.sh")
+	if err := os.WriteFile(script, []byte(testPluginScript), 0700); err != nil {
+		t.Fatal(err)
+	}
+	m := new(PluginCollector)
+	if err := m.Init(json.RawMessage(fmt.Sprintf(`{"command": %q}`, script))); err != nil {
+		t.Fatal(err)
+	}
+	output := make(chan lp.CCMessage, 10)
+	m.Read(time.Second, output)
+	lines := m.lines
+	waitFor(t, "the late lines to fill the buffer", func() bool { return len(lines) == cap(lines) })
+
+	// The plugin is blocked writing to stdout, the reader discards its output until it exits
+	start := time.Now()
+	m.Close()
+	if d := time.Since(start); d >= PLUGIN_STOP_TIMEOUT {
+		t.Errorf("plugin killed after %v, want the plugin to exit after the shutdown request", d)
+	}
+	for range lines {
+		// The reader closes the channel at the end of stdout
+	}
+}
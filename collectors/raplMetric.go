@@ -113,7 +113,7 @@ func (m *RAPLCollector) Init(config json.RawMessage) error {
 		foundEnergy := false
 		if v, err := os.ReadFile(z.energyFilepath); err == nil {
 			// timestamp when energy counter was read
-			z.energyTimestamp = time.Now()
+			z.energyTimestamp = m.now()
 			if i, err := strconv.ParseInt(strings.TrimSpace(string(v)), 10, 64); err == nil {
 				foundEnergy = true
 				z.energy = i
@@ -137,7 +137,7 @@ func (m *RAPLCollector) Init(config json.RawMessage) error {
 		return
 	}
 
-	powerCapPrefix := "/sys/devices/virtual/powercap"
+	powerCapPrefix := m.hostPath("/sys/devices/virtual/powercap")
 	controlType := "intel-rapl"
 	controlTypePath := filepath.Join(powerCapPrefix, controlType)
 
@@ -228,7 +228,7 @@ func (m *RAPLCollector) Read(interval time.Duration, output chan lp.CCMessage) {
 
 		// Read current value of the energy counter in micro joules
 		if v, err := os.ReadFile(p.energyFilepath); err == nil {
-			energyTimestamp := time.Now()
+			energyTimestamp := m.now()
 			if i, err := strconv.ParseInt(strings.TrimSpace(string(v)), 10, 64); err == nil {
 				energy := i
 
@@ -262,6 +262,21 @@ func (m *RAPLCollector) Read(interval time.Duration, output chan lp.CCMessage) {
 	}
 }
 
+// DescribeMetrics returns the metrics the RAPL collector can emit. The metrics have no
+// type tag, the RAPL zone is given by the tags id and zone_name.
+func (m *RAPLCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	return []MetricDescription{
+		{
+			Name:        "rapl_average_power",
+			Unit:        "Watt",
+			Scopes:      []string{},
+			Kind:        METRIC_KIND_GAUGE,
+			Group:       "energy",
+			Description: "Average power consumption of the RAPL zone since the last read",
+		},
+	}, nil
+}
+
 // Close closes running average power limit (RAPL) metric collector
 func (m *RAPLCollector) Close() {
 	// Unset flag
@@ -12,7 +12,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -52,6 +51,8 @@ func (m *SchedstatCollector) Init(config json.RawMessage) error {
 	m.name = "SchedstatCollector"
 	// This is for later use, also call it early
 	m.setup()
+	// All inputs are read with the helpers of the metric collector, so they can be recorded and replayed
+	m.enableInputRecording()
 	// Tell whether the collector should be run in parallel with others (reading files, ...)
 	// or it should be run serially, mostly for collectors acutally doing measurements
 	// because they should not measure the execution of the other collectors
@@ -70,9 +71,10 @@ func (m *SchedstatCollector) Init(config json.RawMessage) error {
 	}
 
 	// Check input file
-	file, err := os.Open(string(SCHEDSTATFILE))
+	file, err := m.openFile(SCHEDSTATFILE)
 	if err != nil {
 		cclog.ComponentError(m.name, err.Error())
+		return err
 	}
 	defer file.Close()
 
@@ -96,7 +98,7 @@ func (m *SchedstatCollector) Init(config json.RawMessage) error {
 	}
 
 	// Save current timestamp
-	m.lastTimestamp = time.Now()
+	m.lastTimestamp = m.now()
 
 	// Set this flag only if everything is initialized properly, all required files exist, ...
 	m.init = true
@@ -131,12 +133,14 @@ func (m *SchedstatCollector) Read(interval time.Duration, output chan lp.CCMessa
 	}
 
 	//timestamps
-	now := time.Now()
+	now := m.now()
 	tsdelta := now.Sub(m.lastTimestamp)
 
-	file, err := os.Open(string(SCHEDSTATFILE))
+	file, err := m.openFile(SCHEDSTATFILE)
 	if err != nil {
 		cclog.ComponentError(m.name, err.Error())
+		m.reportReadError(err)
+		return
 	}
 	defer file.Close()
 
@@ -155,6 +159,19 @@ func (m *SchedstatCollector) Read(interval time.Duration, output chan lp.CCMessa
 
 // Close metric collector: close network connection, close files, close libraries, ...
 // Called once by the collector manager
+// DescribeMetrics returns the metrics the schedstat collector can emit
+func (m *SchedstatCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	return []MetricDescription{
+		{
+			Name:        "cpu_load_core",
+			Scopes:      []string{"hwthread"},
+			Kind:        METRIC_KIND_GAUGE,
+			Group:       "SCHEDSTAT",
+			Description: "Share of time tasks were running or waiting on the hardware thread",
+		},
+	}, nil
+}
+
 func (m *SchedstatCollector) Close() {
 	// Unset flag
 	m.init = false
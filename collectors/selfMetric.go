@@ -10,6 +10,7 @@ package collectors
 import (
 	"encoding/json"
 	"runtime"
+	"sort"
 	"syscall"
 	"time"
 
@@ -22,6 +23,8 @@ type SelfCollectorConfig struct {
 	GoRoutines bool `json:"read_goroutines"`
 	CgoCalls   bool `json:"read_cgo_calls"`
 	Rusage     bool `json:"read_rusage"`
+	Collectors bool `json:"read_collector_states"`
+	Pipeline   bool `json:"read_pipeline_stats"`
 }
 
 type SelfCollector struct {
@@ -29,6 +32,12 @@ type SelfCollector struct {
 	config SelfCollectorConfig // the configuration structure
 	meta   map[string]string   // default meta information
 	tags   map[string]string   // default tags
+	cm     *collectorManager   // collector manager for the states of the other collectors
+}
+
+// setCollectorManager sets the collector manager whose collectors are reported
+func (m *SelfCollector) setCollectorManager(cm *collectorManager) {
+	m.cm = cm
 }
 
 func (m *SelfCollector) Init(config json.RawMessage) error {
@@ -144,6 +153,67 @@ func (m *SelfCollector) Read(interval time.Duration, output chan lp.CCMessage) {
 		}
 
 	}
+	if (m.config.Collectors || m.config.Pipeline) && m.cm != nil {
+		states := m.cm.collectorStates()
+		names := make([]string, 0, len(states))
+		for name := range states {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			tags := map[string]string{"type": "node", "collector": name}
+			state := states[name]
+			if m.config.Collectors {
+				stalled := 0
+				if state.stalled {
+					stalled = 1
+				}
+				y, err := lp.NewMessage("collector_stalled", tags, m.meta, map[string]interface{}{"value": stalled}, timestamp)
+				if err == nil {
+					output <- y
+				}
+				y, err = lp.NewMessage("collector_timeouts", tags, m.meta, map[string]interface{}{"value": state.timeouts}, timestamp)
+				if err == nil {
+					output <- y
+				}
+			}
+			if m.config.Pipeline {
+				y, err := lp.NewMessage("collector_read_duration", tags, m.meta, map[string]interface{}{"value": state.lastDuration.Seconds()}, timestamp)
+				if err == nil {
+					y.AddMeta("unit", "seconds")
+					output <- y
+				}
+				y, err = lp.NewMessage("collector_messages", tags, m.meta, map[string]interface{}{"value": state.messages}, timestamp)
+				if err == nil {
+					output <- y
+				}
+				y, err = lp.NewMessage("collector_errors", tags, m.meta, map[string]interface{}{"value": state.errors}, timestamp)
+				if err == nil {
+					output <- y
+				}
+				y, err = lp.NewMessage("collector_blocked_time", tags, m.meta, map[string]interface{}{"value": state.blocked.Seconds()}, timestamp)
+				if err == nil {
+					y.AddMeta("unit", "seconds")
+					output <- y
+				}
+			}
+		}
+	}
+	if m.config.Pipeline {
+		for _, s := range readPipelineStats() {
+			tags := map[string]string{"type": "node"}
+			for k, v := range s.Tags {
+				tags[k] = v
+			}
+			y, err := lp.NewMessage(s.Name, tags, m.meta, map[string]interface{}{"value": s.Value}, timestamp)
+			if err == nil {
+				if len(s.Unit) > 0 {
+					y.AddMeta("unit", s.Unit)
+				}
+				output <- y
+			}
+		}
+	}
 }
 
 func (m *SelfCollector) Close() {
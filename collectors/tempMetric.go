@@ -72,16 +72,34 @@ func (m *TempCollector) Init(config json.RawMessage) error {
 		"unit":   "degC",
 	}
 
-	m.sensors = make([]*TempCollectorSensor, 0)
+	sensors, err := m.findSensors()
+	if err != nil {
+		return err
+	}
+	m.sensors = sensors
+
+	// Empty sensors map
+	if len(m.sensors) == 0 {
+		return fmt.Errorf("no temperature sensors found")
+	}
+
+	// Finished initialization
+	m.init = true
+	return nil
+}
+
+// findSensors returns the temperature sensors below /sys/class/hwmon
+func (m *TempCollector) findSensors() ([]*TempCollectorSensor, error) {
+	sensors := make([]*TempCollectorSensor, 0)
 
 	// Find all temperature sensor files
-	globPattern := filepath.Join("/sys/class/hwmon", "*", "temp*_input")
+	globPattern := filepath.Join(m.hostPath("/sys/class/hwmon"), "*", "temp*_input")
 	inputFiles, err := filepath.Glob(globPattern)
 	if err != nil {
-		return fmt.Errorf("unable to glob files with pattern '%s': %v", globPattern, err)
+		return nil, fmt.Errorf("unable to glob files with pattern '%s': %v", globPattern, err)
 	}
 	if inputFiles == nil {
-		return fmt.Errorf("unable to find any files with pattern '%s'", globPattern)
+		return nil, fmt.Errorf("unable to find any files with pattern '%s'", globPattern)
 	}
 
 	// Get sensor name for each temperature sensor file
@@ -165,17 +183,9 @@ func (m *TempCollector) Init(config json.RawMessage) error {
 			}
 		}
 
-		m.sensors = append(m.sensors, sensor)
-	}
-
-	// Empty sensors map
-	if len(m.sensors) == 0 {
-		return fmt.Errorf("no temperature sensors found")
+		sensors = append(sensors, sensor)
 	}
-
-	// Finished initialization
-	m.init = true
-	return nil
+	return sensors, nil
 }
 
 func (m *TempCollector) Read(interval time.Duration, output chan lp.CCMessage) {
@@ -239,6 +249,54 @@ func (m *TempCollector) Read(interval time.Duration, output chan lp.CCMessage) {
 
 }
 
+// DescribeMetrics returns the metrics of the temperature sensors found on this host.
+// Without sensors no metric is described.
+func (m *TempCollector) DescribeMetrics(config json.RawMessage) ([]MetricDescription, error) {
+	c := new(TempCollector)
+	c.roots = m.roots
+	if len(config) > 0 {
+		err := json.Unmarshal(config, &c.config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sensors, err := c.findSensors()
+	if err != nil {
+		cclog.ComponentError("TempCollector", "DescribeMetrics():", err.Error())
+		return []MetricDescription{}, nil
+	}
+	metrics := make([]MetricDescription, 0)
+	seen := make(map[string]bool)
+	add := func(name string, tags map[string]string, description string) {
+		if len(name) == 0 || seen[name] {
+			return
+		}
+		seen[name] = true
+		scope := "node"
+		if t, ok := tags["type"]; ok {
+			scope = t
+		}
+		metrics = append(metrics, MetricDescription{
+			Name:        name,
+			Unit:        "degC",
+			Scopes:      []string{scope},
+			Kind:        METRIC_KIND_GAUGE,
+			Group:       "IPMI",
+			Description: description,
+		})
+	}
+	for _, sensor := range sensors {
+		add(sensor.metricName, sensor.tags, "Temperature of the sensor")
+		if c.config.ReportMaxTemp && sensor.maxTemp != 0 {
+			add(sensor.maxTempName, sensor.tags, "Maximum temperature of the sensor")
+		}
+		if c.config.ReportCriticalTemp && sensor.critTemp != 0 {
+			add(sensor.critTempName, sensor.tags, "Critical temperature of the sensor")
+		}
+	}
+	return metrics, nil
+}
+
 func (m *TempCollector) Close() {
 	m.init = false
 }
@@ -64,16 +64,17 @@ func (m *TopProcsCollector) Read(interval time.Duration, output chan lp.CCMessag
 	if !m.init {
 		return
 	}
-	command := exec.Command("ps", "-Ao", "comm", "--sort=-pcpu")
+	command := exec.CommandContext(m.readContext(), "ps", "-Ao", "comm", "--sort=-pcpu")
 	command.Wait()
 	stdout, err := command.Output()
 	if err != nil {
 		log.Print(m.name, err)
+		m.reportReadError(err)
 		return
 	}
 
 	lines := strings.Split(string(stdout), "\n")
-	for i := 1; i < m.config.Num_procs+1; i++ {
+	for i := 1; i < m.config.Num_procs+1 && i < len(lines); i++ {
 		name := fmt.Sprintf("topproc%d", i)
 		y, err := lp.NewMessage(name, m.tags, m.meta, map[string]interface{}{"value": string(lines[i])}, time.Now())
 		if err == nil {
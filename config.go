@@ -0,0 +1,103 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	ccconf "github.com/ClusterCockpit/cc-lib/ccConfig"
+	cclog "github.com/ClusterCockpit/cc-lib/ccLogger"
+	co "github.com/ClusterCockpit/cc-metric-collector/internal/configOverlay"
+)
+
+// Keys of the main configuration file for the configuration overlays
+const (
+	CONFIG_OVERLAY_DIR    = "overlay-dir"    // directory with configuration fragments
+	CONFIG_PARTITION_PATH = "partition-path" // file with the Slurm partitions of the host
+)
+
+// Effective configuration of all components after applying the overlays
+var effectiveConfig map[string]json.RawMessage
+
+// loadConfig reads the main configuration file and the referenced component configuration
+// files. Afterwards, the fragments of the overlay directory matching this host are merged
+// into the component configurations in the order of their file names.
+func loadConfig(configFile string) error {
+	raw, err := os.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	var keys map[string]json.RawMessage
+	err = json.Unmarshal(raw, &keys)
+	if err != nil {
+		return fmt.Errorf("%s: %v", configFile, err)
+	}
+	ccconf.Init(configFile)
+
+	config := make(map[string]json.RawMessage)
+	var overlayDir, partitionPath string
+	for key, value := range keys {
+		switch key {
+		case CONFIG_OVERLAY_DIR:
+			err = json.Unmarshal(value, &overlayDir)
+		case CONFIG_PARTITION_PATH:
+			err = json.Unmarshal(value, &partitionPath)
+		default:
+			key = strings.TrimSuffix(key, "-file")
+			if c := ccconf.GetPackageConfig(key); len(c) > 0 {
+				config[key] = c
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s: %v", configFile, key, err)
+		}
+	}
+
+	if len(overlayDir) > 0 {
+		host, err := co.LocalHost(partitionPath)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %v", configFile, CONFIG_PARTITION_PATH, err)
+		}
+		merged, applied, err := co.Apply(config, overlayDir, host)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %v", configFile, CONFIG_OVERLAY_DIR, err)
+		}
+		cclog.ComponentDebug("ConfigOverlay", "Applied fragments:", strings.Join(applied, ", "))
+		config = merged
+	}
+	effectiveConfig = config
+	return nil
+}
+
+// getPackageConfig returns the effective configuration of a component
+func getPackageConfig(key string) json.RawMessage {
+	return effectiveConfig[key]
+}
+
+// printConfig prints the effective configuration of all components with the
+// overlays applied. It returns the exit code.
+func printConfig(configFile string) int {
+	err := checkConfigFiles(configFile)
+	if err == nil {
+		err = loadConfig(configFile)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	out, err := json.MarshalIndent(effectiveConfig, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	fmt.Println(string(out))
+	return 0
+}
@@ -0,0 +1,230 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package configOverlay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	cclog "github.com/ClusterCockpit/cc-lib/ccLogger"
+)
+
+// Key of the host selector in a configuration fragment
+const SELECTOR_KEY = "select"
+
+// Host describes the host the configuration fragments are selected for
+type Host struct {
+	Hostname   string   // Hostname without domain
+	FQDN       string   // Hostname as returned by the operating system
+	Partitions []string // Slurm partitions of the host
+}
+
+// LocalHost returns the description of this host. The Slurm partitions are read from
+// the partition file (separated by whitespace or commas), if given.
+func LocalHost(partitionFile string) (Host, error) {
+	fqdn, err := os.Hostname()
+	if err != nil {
+		return Host{}, err
+	}
+	h := Host{
+		Hostname:   strings.SplitN(fqdn, ".", 2)[0],
+		FQDN:       fqdn,
+		Partitions: make([]string, 0),
+	}
+	if len(partitionFile) > 0 {
+		raw, err := os.ReadFile(partitionFile)
+		if err != nil {
+			return h, fmt.Errorf("cannot read partition file: %v", err)
+		}
+		h.Partitions = strings.FieldsFunc(string(raw), func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+		})
+	}
+	return h, nil
+}
+
+// Selector restricts a configuration fragment to some hosts. All given criteria must match.
+type Selector struct {
+	Hosts      []string `json:"hosts,omitempty"`      // Glob patterns matched against the hostname with and without domain
+	HostRegex  string   `json:"host_regex,omitempty"` // Regular expression matched against the hostname with and without domain
+	Partitions []string `json:"partitions,omitempty"` // Slurm partitions, the host has to be in one of them
+}
+
+// Match reports whether the selector matches the host
+func (s Selector) Match(h Host) (bool, error) {
+	if len(s.Hosts) > 0 {
+		found := false
+		for _, pattern := range s.Hosts {
+			for _, name := range []string{h.Hostname, h.FQDN} {
+				ok, err := path.Match(pattern, name)
+				if err != nil {
+					return false, fmt.Errorf("hosts: invalid pattern '%s': %v", pattern, err)
+				}
+				found = found || ok
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	if len(s.HostRegex) > 0 {
+		regex, err := regexp.Compile(s.HostRegex)
+		if err != nil {
+			return false, fmt.Errorf("host_regex: %v", err)
+		}
+		if !regex.MatchString(h.Hostname) && !regex.MatchString(h.FQDN) {
+			return false, nil
+		}
+	}
+	if len(s.Partitions) > 0 {
+		found := false
+		for _, p := range s.Partitions {
+			for _, hp := range h.Partitions {
+				found = found || p == hp
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// decode decodes a JSON value keeping the numbers as they are
+func decode(raw json.RawMessage) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	var v interface{}
+	err := d.Decode(&v)
+	return v, err
+}
+
+// merge merges src into dst: Objects are merged recursively, a null value removes
+// the key, all other values (including arrays) replace the value in dst
+func merge(dst, src interface{}) interface{} {
+	srcMap, ok := src.(map[string]interface{})
+	if !ok {
+		return src
+	}
+	dstMap, ok := dst.(map[string]interface{})
+	if !ok {
+		dstMap = make(map[string]interface{})
+	}
+	for k, v := range srcMap {
+		if v == nil {
+			delete(dstMap, k)
+			continue
+		}
+		dstMap[k] = merge(dstMap[k], v)
+	}
+	return dstMap
+}
+
+// Merge deep-merges the JSON value src into dst and returns the result. Objects are
+// merged recursively, a null value removes the key, all other values replace the
+// value in dst.
+func Merge(dst, src json.RawMessage) (json.RawMessage, error) {
+	var d interface{}
+	if len(dst) > 0 {
+		var err error
+		d, err = decode(dst)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s, err := decode(src)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(merge(d, s))
+}
+
+// Fragments returns the configuration fragments (*.json) in the directory sorted by name
+func Fragments(dir string) ([]string, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Apply merges the configuration fragments of the directory in the order of their names
+// into the configuration of the components. Fragments with a host selector not matching
+// the host are skipped. It returns the merged configuration and the applied fragments.
+func Apply(config map[string]json.RawMessage, dir string, host Host) (map[string]json.RawMessage, []string, error) {
+	files, err := Fragments(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	merged := make(map[string]json.RawMessage, len(config))
+	for key, value := range config {
+		merged[key] = value
+	}
+	applied := make([]string, 0, len(files))
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		var fragment map[string]json.RawMessage
+		err = json.Unmarshal(raw, &fragment)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if s, ok := fragment[SELECTOR_KEY]; ok {
+			var selector Selector
+			d := json.NewDecoder(bytes.NewReader(s))
+			d.DisallowUnknownFields()
+			err = d.Decode(&selector)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %s: %v", file, SELECTOR_KEY, err)
+			}
+			ok, err := selector.Match(host)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %s: %v", file, SELECTOR_KEY, err)
+			}
+			if !ok {
+				cclog.ComponentDebug("ConfigOverlay", "SKIP fragment", file, "for host", host.FQDN)
+				continue
+			}
+			delete(fragment, SELECTOR_KEY)
+		}
+		for key, value := range fragment {
+			if strings.HasSuffix(key, "-file") {
+				return nil, nil, fmt.Errorf("%s: %s: file references are not supported in fragments", file, key)
+			}
+			if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+				delete(merged, key)
+				continue
+			}
+			m, err := Merge(merged[key], value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %s: %v", file, key, err)
+			}
+			merged[key] = m
+		}
+		cclog.ComponentDebug("ConfigOverlay", "APPLY fragment", file)
+		applied = append(applied, file)
+	}
+	return merged, applied, nil
+}
@@ -0,0 +1,168 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package configOverlay
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var testHost = Host{Hostname: "gpu01", FQDN: "gpu01.cluster.example.org", Partitions: []string{"gpu", "all"}}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector Selector
+		match    bool
+		valid    bool
+	}{
+		{"empty", Selector{}, true, true},
+		{"hostname", Selector{Hosts: []string{"cpu*", "gpu*"}}, true, true},
+		{"fqdn", Selector{Hosts: []string{"*.cluster.example.org"}}, true, true},
+		{"other hosts", Selector{Hosts: []string{"cpu*"}}, false, true},
+		{"regex", Selector{HostRegex: "^gpu[0-9]+$"}, true, true},
+		{"other regex", Selector{HostRegex: "^cpu"}, false, true},
+		{"partition", Selector{Partitions: []string{"gpu"}}, true, true},
+		{"other partition", Selector{Partitions: []string{"fat"}}, false, true},
+		{"all criteria", Selector{Hosts: []string{"gpu*"}, Partitions: []string{"fat"}}, false, true},
+		{"invalid pattern", Selector{Hosts: []string{"gpu["}}, false, false},
+		{"invalid regex", Selector{HostRegex: "gpu("}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := tt.selector.Match(testHost)
+			if valid := err == nil; valid != tt.valid || match != tt.match {
+				t.Errorf("Match() = %v, %v, want %v and valid %v", match, err, tt.match, tt.valid)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		dst  string
+		src  string
+		want string
+	}{
+		{"empty", ``, `{"a": 1}`, `{"a":1}`},
+		{"nested", `{"a": {"b": 1, "c": 2}, "d": 3}`, `{"a": {"b": 10}}`, `{"a":{"b":10,"c":2},"d":3}`},
+		{"remove key", `{"a": {"b": 1, "c": 2}}`, `{"a": {"c": null}}`, `{"a":{"b":1}}`},
+		{"replace array", `{"a": [1, 2]}`, `{"a": [3]}`, `{"a":[3]}`},
+		{"replace value by object", `{"a": 1}`, `{"a": {"b": 2}}`, `{"a":{"b":2}}`},
+		{"numbers kept", `{"a": 1.50}`, `{"b": 12345678901234567890}`, `{"a":1.50,"b":12345678901234567890}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := Merge(json.RawMessage(tt.dst), json.RawMessage(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(merged) != tt.want {
+				t.Errorf("Merge() = %s, want %s", merged, tt.want)
+			}
+		})
+	}
+	if _, err := Merge(json.RawMessage(`{"a": 1}`), json.RawMessage(`{"a":`)); err == nil {
+		t.Errorf("Merge() of invalid JSON succeeded")
+	}
+}
+
+// writeFragments creates the configuration fragments in a new directory
+func writeFragments(t *testing.T, fragments map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range fragments {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestApply(t *testing.T) {
+	config := map[string]json.RawMessage{
+		"collectors": json.RawMessage(`{"cpustat": {}, "likwid": {"force_overwrite": false}}`),
+		"receivers":  json.RawMessage(`{}`),
+	}
+	dir := writeFragments(t, map[string]string{
+		"10-gpu.json":    `{"select": {"partitions": ["gpu"]}, "collectors": {"nvidia": {}, "likwid": null}}`,
+		"20-cpu.json":    `{"select": {"hosts": ["cpu*"]}, "collectors": {"cpustat": null}}`,
+		"30-all.json":    `{"collectors": {"nvidia": {"exclude_devices": ["1"]}}, "receivers": null}`,
+		"40-other.txt":   `{"collectors": null}`,
+		"50-router.json": `{"router": {"interval_timestamp": true}}`,
+	})
+	merged, applied, err := Apply(config, dir, testHost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"collectors": `{"cpustat":{},"nvidia":{"exclude_devices":["1"]}}`,
+		"router":     `{"interval_timestamp":true}`,
+	}
+	got := make(map[string]string)
+	for key, value := range merged {
+		got[key] = string(value)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply() = %v, want %v", got, want)
+	}
+	wantApplied := []string{"10-gpu.json", "30-all.json", "50-router.json"}
+	for i := range applied {
+		applied[i] = filepath.Base(applied[i])
+	}
+	if !reflect.DeepEqual(applied, wantApplied) {
+		t.Errorf("applied %v, want %v", applied, wantApplied)
+	}
+	if string(config["collectors"]) != `{"cpustat": {}, "likwid": {"force_overwrite": false}}` || len(config) != 2 {
+		t.Errorf("Apply() modified the original configuration %v", config)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		fragment string
+	}{
+		{"invalid JSON", `{"collectors": `},
+		{"unknown selector", `{"select": {"hostname": "gpu01"}, "collectors": {}}`},
+		{"invalid selector", `{"select": {"host_regex": "("}, "collectors": {}}`},
+		{"file reference", `{"collectors-file": "/etc/collectors.json"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFragments(t, map[string]string{"fragment.json": tt.fragment})
+			if _, _, err := Apply(map[string]json.RawMessage{}, dir, testHost); err == nil {
+				t.Errorf("invalid fragment applied")
+			}
+		})
+	}
+	if _, _, err := Apply(map[string]json.RawMessage{}, filepath.Join(t.TempDir(), "missing"), testHost); err == nil {
+		t.Errorf("missing directory applied")
+	}
+}
+
+func TestLocalHost(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "partitions")
+	if err := os.WriteFile(file, []byte("gpu,all\nfat \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := LocalHost(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(h.Partitions, []string{"gpu", "all", "fat"}) || len(h.Hostname) == 0 {
+		t.Errorf("LocalHost() = %+v, want the partitions gpu, all and fat", h)
+	}
+	if _, err := LocalHost(file + ".missing"); err == nil {
+		t.Errorf("LocalHost() with a missing partition file succeeded")
+	}
+}
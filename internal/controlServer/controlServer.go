@@ -0,0 +1,273 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package controlServer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	cclog "github.com/ClusterCockpit/cc-lib/ccLogger"
+	"github.com/ClusterCockpit/cc-metric-collector/collectors"
+	mr "github.com/ClusterCockpit/cc-metric-collector/internal/metricRouter"
+)
+
+const CONTROL_DEFAULT_SOCKET_MODE = "0660"
+
+// Control server configuration
+type controlServerConfig struct {
+	Socket     string `json:"socket"`      // Path of the Unix domain socket
+	SocketMode string `json:"socket_mode"` // File mode of the Unix domain socket (default '0660')
+	HTTP       string `json:"http"`        // Optional localhost address for read-only HTTP access like 'localhost:8092'
+}
+
+// Control server data structure
+type controlServer struct {
+	config    controlServerConfig
+	wg        *sync.WaitGroup
+	collect   collectors.CollectorManager
+	router    mr.MetricRouter
+	servers   []*http.Server
+	listeners []net.Listener
+}
+
+// Control server access functions
+type ControlServer interface {
+	Init(wg *sync.WaitGroup, controlConfig json.RawMessage, collect collectors.CollectorManager, router mr.MetricRouter) error
+	Start()
+	Close()
+}
+
+// Init initializes the control server by opening the Unix domain socket and,
+// if configured, the localhost HTTP listener
+func (s *controlServer) Init(wg *sync.WaitGroup, controlConfig json.RawMessage, collect collectors.CollectorManager, router mr.MetricRouter) error {
+	s.wg = wg
+	s.collect = collect
+	s.router = router
+	s.config.SocketMode = CONTROL_DEFAULT_SOCKET_MODE
+
+	err := json.Unmarshal(controlConfig, &s.config)
+	if err != nil {
+		cclog.ComponentError("ControlServer", err.Error())
+		return err
+	}
+	if len(s.config.Socket) == 0 && len(s.config.HTTP) == 0 {
+		return errors.New("neither 'socket' nor 'http' configured for the control server")
+	}
+
+	if len(s.config.Socket) > 0 {
+		mode, err := strconv.ParseUint(s.config.SocketMode, 8, 32)
+		if err != nil {
+			return fmt.Errorf("failed to parse socket_mode '%s': %v", s.config.SocketMode, err)
+		}
+		// Remove stale socket of a previous run, but no other file
+		if info, err := os.Lstat(s.config.Socket); err == nil {
+			if info.Mode()&os.ModeSocket == 0 {
+				return fmt.Errorf("%s exists and is not a socket", s.config.Socket)
+			}
+			os.Remove(s.config.Socket)
+		}
+		l, err := net.Listen("unix", s.config.Socket)
+		if err != nil {
+			return fmt.Errorf("failed to listen on socket %s: %v", s.config.Socket, err)
+		}
+		err = os.Chmod(s.config.Socket, os.FileMode(mode))
+		if err != nil {
+			l.Close()
+			return fmt.Errorf("failed to change mode of socket %s: %v", s.config.Socket, err)
+		}
+		s.listeners = append(s.listeners, l)
+	}
+
+	if len(s.config.HTTP) > 0 {
+		host, _, err := net.SplitHostPort(s.config.HTTP)
+		if err != nil {
+			s.closeListeners()
+			return fmt.Errorf("failed to parse http address %s: %v", s.config.HTTP, err)
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			s.closeListeners()
+			return fmt.Errorf("http address %s is not a localhost address", s.config.HTTP)
+		}
+		l, err := net.Listen("tcp", s.config.HTTP)
+		if err != nil {
+			s.closeListeners()
+			return fmt.Errorf("failed to listen on %s: %v", s.config.HTTP, err)
+		}
+		s.listeners = append(s.listeners, l)
+	}
+	return nil
+}
+
+func (s *controlServer) closeListeners() {
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	s.listeners = nil
+}
+
+// writeJSON sends the value JSON encoded to the client
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		cclog.ComponentError("ControlServer", "Failed to encode response:", err.Error())
+	}
+}
+
+// writeError sends an error message JSON encoded to the client
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// readOnly restricts a handler to the GET endpoints. Every local user can connect to the
+// HTTP listener (and a local browser can be tricked into sending POST requests to it), so
+// the endpoints changing the collectors are only served on the Unix domain socket, whose
+// access is restricted by its file mode.
+func readOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeError(w, http.StatusForbidden, errors.New("only GET requests are allowed via http, use the socket"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// handler creates the HTTP handler for all control endpoints
+func (s *controlServer) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	// List all configured collectors
+	mux.HandleFunc("GET /collectors", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.collect.Collectors())
+	})
+
+	// Enable or disable a collector
+	setEnabled := func(enabled bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			name := r.PathValue("name")
+			err := s.collect.SetEnabled(name, enabled)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			cclog.ComponentDebug("ControlServer", "Collector", name, "enabled:", enabled)
+			writeJSON(w, http.StatusOK, map[string]interface{}{"name": name, "enabled": enabled})
+		}
+	}
+	mux.HandleFunc("POST /collectors/{name}/enable", setEnabled(true))
+	mux.HandleFunc("POST /collectors/{name}/disable", setEnabled(false))
+
+	// Trigger an out-of-band read of a single or all collectors
+	readNow := func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		start := time.Now()
+		err := s.collect.ReadNow(name)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"name": name, "duration": time.Since(start).String()})
+	}
+	mux.HandleFunc("POST /collectors/{name}/read", readNow)
+	mux.HandleFunc("POST /collectors/read", readNow)
+
+	// Message counters of the router
+	mux.HandleFunc("GET /router", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.router.Stats())
+	})
+	return mux
+}
+
+// Start starts serving the control API on all listeners, read-only on the HTTP listener
+func (s *controlServer) Start() {
+	h := s.handler()
+	for _, l := range s.listeners {
+		handler := h
+		if l.Addr().Network() != "unix" {
+			handler = readOnly(h)
+		}
+		srv := &http.Server{
+			Handler:     handler,
+			ReadTimeout: 10 * time.Second,
+		}
+		s.servers = append(s.servers, srv)
+		s.wg.Add(1)
+		go func(srv *http.Server, l net.Listener) {
+			defer s.wg.Done()
+			err := srv.Serve(l)
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				cclog.ComponentError("ControlServer", err.Error())
+			}
+		}(srv, l)
+		cclog.ComponentDebug("ControlServer", "Listening on", l.Addr().String())
+	}
+	cclog.ComponentDebug("ControlServer", "STARTED")
+}
+
+// Close stops the control server and removes the Unix domain socket
+func (s *controlServer) Close() {
+	cclog.ComponentDebug("ControlServer", "CLOSE")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, srv := range s.servers {
+		srv.Shutdown(ctx)
+	}
+	if len(s.servers) == 0 {
+		s.closeListeners()
+	}
+	if len(s.config.Socket) > 0 {
+		os.Remove(s.config.Socket)
+	}
+}
+
+// ValidateConfig checks the control server configuration without opening any socket
+func ValidateConfig(controlConfig json.RawMessage) []error {
+	errs := make([]error, 0)
+	var config controlServerConfig
+	d := json.NewDecoder(bytes.NewReader(controlConfig))
+	d.DisallowUnknownFields()
+	err := d.Decode(&config)
+	if err != nil {
+		return append(errs, err)
+	}
+	if len(config.Socket) == 0 && len(config.HTTP) == 0 {
+		errs = append(errs, errors.New("neither 'socket' nor 'http' configured"))
+	}
+	if len(config.SocketMode) > 0 {
+		if _, err := strconv.ParseUint(config.SocketMode, 8, 32); err != nil {
+			errs = append(errs, fmt.Errorf("socket_mode: %v", err))
+		}
+	}
+	if len(config.HTTP) > 0 {
+		if _, _, err := net.SplitHostPort(config.HTTP); err != nil {
+			errs = append(errs, fmt.Errorf("http: %v", err))
+		}
+	}
+	return errs
+}
+
+// New creates a new initialized control server
+func New(wg *sync.WaitGroup, controlConfig json.RawMessage, collect collectors.CollectorManager, router mr.MetricRouter) (ControlServer, error) {
+	s := new(controlServer)
+	err := s.Init(wg, controlConfig, collect, router)
+	if err != nil {
+		return nil, err
+	}
+	return s, err
+}
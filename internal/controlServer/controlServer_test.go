@@ -0,0 +1,271 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package controlServer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ClusterCockpit/cc-metric-collector/collectors"
+	mr "github.com/ClusterCockpit/cc-metric-collector/internal/metricRouter"
+)
+
+// Collector manager with the collectors 'cpustat' and 'likwid', only the methods used
+// by the control server are implemented
+type testCollectorManager struct {
+	collectors.CollectorManager
+	lock    sync.Mutex
+	enabled map[string]bool
+	reads   []string
+}
+
+func newTestCollectorManager() *testCollectorManager {
+	return &testCollectorManager{enabled: map[string]bool{"cpustat": true, "likwid": true}}
+}
+
+func (cm *testCollectorManager) Collectors() []collectors.CollectorInfo {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	return []collectors.CollectorInfo{
+		{Name: "cpustat", Initialized: true, Enabled: cm.enabled["cpustat"], Interval: "10s"},
+		{Name: "likwid", Initialized: true, Enabled: cm.enabled["likwid"], Interval: "10s"},
+	}
+}
+
+func (cm *testCollectorManager) SetEnabled(name string, enabled bool) error {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	if _, ok := cm.enabled[name]; !ok {
+		return fmt.Errorf("unknown collector %s", name)
+	}
+	cm.enabled[name] = enabled
+	return nil
+}
+
+func (cm *testCollectorManager) ReadNow(name string) error {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	if _, ok := cm.enabled[name]; !ok && len(name) > 0 {
+		return fmt.Errorf("unknown collector %s", name)
+	}
+	cm.reads = append(cm.reads, name)
+	return nil
+}
+
+// Metric router with fixed message counters
+type testRouter struct {
+	mr.MetricRouter
+}
+
+func (r *testRouter) Stats() map[string]mr.MetricRouterInputStats {
+	return map[string]mr.MetricRouterInputStats{"collectors": {Received: 10, Forwarded: 8, Dropped: 2}}
+}
+
+func TestHandler(t *testing.T) {
+	cm := newTestCollectorManager()
+	s := &controlServer{collect: cm, router: new(testRouter)}
+	h := s.handler()
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{"GET", "/collectors", http.StatusOK, `"name":"likwid","initialized":true,"enabled":true`},
+		{"POST", "/collectors/likwid/disable", http.StatusOK, `{"enabled":false,"name":"likwid"}`},
+		{"GET", "/collectors", http.StatusOK, `"name":"likwid","initialized":true,"enabled":false`},
+		{"POST", "/collectors/likwid/enable", http.StatusOK, `{"enabled":true,"name":"likwid"}`},
+		{"POST", "/collectors/unknown/enable", http.StatusBadRequest, `{"error":"unknown collector unknown"}`},
+		{"POST", "/collectors/cpustat/read", http.StatusOK, `"name":"cpustat"`},
+		{"POST", "/collectors/read", http.StatusOK, `"name":""`},
+		{"POST", "/collectors/unknown/read", http.StatusBadRequest, `{"error":"unknown collector unknown"}`},
+		{"GET", "/collectors/cpustat/read", http.StatusMethodNotAllowed, ""},
+		{"GET", "/router", http.StatusOK, `{"collectors":{"received":10,"forwarded":8,"dropped":2,`},
+		{"GET", "/unknown", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, rec.Code, tt.status)
+		}
+		if body := rec.Body.String(); !strings.Contains(body, tt.body) {
+			t.Errorf("%s %s: body %q, want it to contain %q", tt.method, tt.path, body, tt.body)
+		}
+		if tt.status == http.StatusOK && rec.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s %s: content type %q, want application/json", tt.method, tt.path, rec.Header().Get("Content-Type"))
+		}
+	}
+	if strings.Join(cm.reads, ",") != "cpustat," {
+		t.Errorf("reads %q, want cpustat and all collectors", cm.reads)
+	}
+}
+
+func TestSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "control.sock")
+	// A stale socket of a previous run is replaced
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	var wg sync.WaitGroup
+	cm := newTestCollectorManager()
+	s, err := New(&wg, json.RawMessage(fmt.Sprintf(`{"socket": %q, "socket_mode": "0600", "http": "127.0.0.1:0"}`, socket)),
+		cm, new(testRouter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(socket)
+	if err != nil || info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0o600 {
+		t.Fatalf("socket %v with error %v, want a socket with mode 0600", info, err)
+	}
+	s.Start()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return new(net.Dialer).DialContext(ctx, "unix", socket)
+		},
+	}}
+	resp, err := client.Get("http://localhost/router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"received":10`) {
+		t.Errorf("GET /router: status %d, body %q", resp.StatusCode, body)
+	}
+
+	resp, err = client.Post("http://localhost/collectors/likwid/disable", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("POST /collectors/likwid/disable: status %d", resp.StatusCode)
+	}
+
+	// The HTTP listener only serves the GET endpoints
+	addr := s.(*controlServer).listeners[1].Addr().String()
+	resp, err = http.Get("http://" + addr + "/collectors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /collectors via http: status %d", resp.StatusCode)
+	}
+	for _, path := range []string{"/collectors/likwid/enable", "/collectors/likwid/read", "/collectors/read"} {
+		resp, err = http.Post("http://"+addr+path, "application/x-www-form-urlencoded", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("POST %s via http: status %d, want %d", path, resp.StatusCode, http.StatusForbidden)
+		}
+	}
+	if info := collectorInfo(cm, "likwid"); info.Enabled || len(cm.reads) != 0 {
+		t.Errorf("collector changed via http: %+v, reads %v", info, cm.reads)
+	}
+
+	s.Close()
+	wg.Wait()
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("socket not removed after Close(): %v", err)
+	}
+}
+
+// collectorInfo returns the information of a collector of the collector manager
+func collectorInfo(cm collectors.CollectorManager, name string) collectors.CollectorInfo {
+	for _, info := range cm.Collectors() {
+		if info.Name == name {
+			return info
+		}
+	}
+	return collectors.CollectorInfo{}
+}
+
+func TestNoSocket(t *testing.T) {
+	// Only a stale socket is removed, no other file
+	file := filepath.Join(t.TempDir(), "control.sock")
+	if err := os.WriteFile(file, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	if _, err := New(&wg, json.RawMessage(fmt.Sprintf(`{"socket": %q}`, file)), newTestCollectorManager(), new(testRouter)); err == nil {
+		t.Errorf("file replaced by the socket")
+	}
+	if raw, err := os.ReadFile(file); err != nil || string(raw) != "data" {
+		t.Errorf("file changed: %q, %v", raw, err)
+	}
+}
+
+func TestInitErrors(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "control.sock")
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"nothing to listen on", `{"socket_mode": "0600"}`},
+		{"invalid socket mode", fmt.Sprintf(`{"socket": %q, "socket_mode": "rw"}`, socket)},
+		{"missing socket directory", `{"socket": "/nonexistent/control.sock"}`},
+		{"http without port", `{"http": "localhost"}`},
+		{"http not on localhost", fmt.Sprintf(`{"socket": %q, "http": "192.0.2.1:8092"}`, socket)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			s, err := New(&wg, json.RawMessage(tt.config), newTestCollectorManager(), new(testRouter))
+			if err == nil {
+				s.Close()
+				t.Fatalf("invalid configuration accepted")
+			}
+			// The listener on the socket is closed again
+			if conn, err := net.Dial("unix", socket); err == nil {
+				conn.Close()
+				t.Errorf("socket still accepts connections")
+			}
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		config string
+		valid  bool
+	}{
+		{`{"socket": "/run/cc-metric-collector/control.sock"}`, true},
+		{`{"http": "localhost:8092", "socket_mode": "0600"}`, true},
+		{`{}`, false},
+		{`{"socket": "/run/control.sock", "socket_mode": "0999"}`, false},
+		{`{"http": "localhost"}`, false},
+		{`{"socket": "/run/control.sock", "port": 8092}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.config, func(t *testing.T) {
+			errs := ValidateConfig(json.RawMessage(tt.config))
+			if valid := len(errs) == 0; valid != tt.valid {
+				t.Errorf("ValidateConfig() = %v, want valid %v", errs, tt.valid)
+			}
+		})
+	}
+}
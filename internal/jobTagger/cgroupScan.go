@@ -0,0 +1,321 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package jobTagger
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Maximal depth of the cgroup hierarchy searched for job cgroups
+const MAX_SCAN_DEPTH = 6
+
+// Major device number of the NVIDIA GPUs. The minor number is the GPU index,
+// minor numbers from NVIDIA_MAX_MINOR on are control devices.
+const (
+	NVIDIA_MAJOR     = 195
+	NVIDIA_MAX_MINOR = 254
+)
+
+// Files with the effective CPUs of a cgroup: cgroup v2, cgroup v1 and the
+// configured CPUs as fallback
+var cpusetFiles = []string{"cpuset.cpus.effective", "cpuset.effective_cpus", "cpuset.cpus"}
+
+// Environment variables of the job's processes with the indices of the allocated GPUs
+var gpuEnvVars = []string{"SLURM_JOB_GPUS", "SLURM_STEP_GPUS"}
+
+// Cgroup of slurmstepd below the job steps (cgroup v2). Its processes run as root and
+// without the job's environment, so they are skipped.
+const SLURMSTEPD_CGROUP = "slurm"
+
+// Job is a Slurm job found in the cgroup hierarchy
+type Job struct {
+	JobId        string
+	Uid          string // User ID from the cgroup path (v1) or the owner of a process of the job
+	User         string // User name, set by the job tagger
+	Hwthreads    []int  // Hardware threads of the job's cpuset
+	Accelerators []int  // Minor numbers of the NVIDIA GPUs of the job, nil if unknown
+}
+
+// parseList parses a list like '0-3,8,10-11'
+func parseList(s string) ([]int, error) {
+	list := make([]int, 0)
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return list, nil
+	}
+	for _, r := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(r, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(last)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for i := start; i <= end; i++ {
+			list = append(list, i)
+		}
+	}
+	return list, nil
+}
+
+// readCpuset returns the effective CPUs of a cgroup
+func readCpuset(dir string) []int {
+	for _, name := range cpusetFiles {
+		raw, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		list, err := parseList(string(raw))
+		if err == nil && len(list) > 0 {
+			return list
+		}
+	}
+	return nil
+}
+
+// readDevices returns the minor numbers of the NVIDIA GPUs in the device allow list of
+// a cgroup v1 ('devices.list' with lines like 'c 195:0 rw')
+func readDevices(dir string) []int {
+	f, err := os.Open(filepath.Join(dir, "devices.list"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	minors := make([]int, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "c" {
+			continue
+		}
+		var major, minor int
+		if _, err := fmt.Sscanf(fields[1], "%d:%d", &major, &minor); err != nil {
+			continue
+		}
+		if major == NVIDIA_MAJOR && minor < NVIDIA_MAX_MINOR {
+			minors = append(minors, minor)
+		}
+	}
+	sort.Ints(minors)
+	return minors
+}
+
+// forEachProcess calls fn with the procfs directories of the processes found in the cgroup
+// or its children until fn returns true. The cgroups of slurmstepd are skipped.
+func forEachProcess(dir string, procfsRoot string, fn func(pidDir string) bool) {
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return filepath.SkipDir
+		}
+		if d.IsDir() && d.Name() == SLURMSTEPD_CGROUP {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || d.Name() != "cgroup.procs" {
+			return nil
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		for _, pid := range strings.Fields(string(raw)) {
+			if fn(filepath.Join(procfsRoot, pid)) {
+				return filepath.SkipAll
+			}
+		}
+		return nil
+	})
+}
+
+// processOwner returns the uid of the first process found in the cgroup or its children
+func processOwner(dir string, procfsRoot string) string {
+	uid := ""
+	forEachProcess(dir, procfsRoot, func(pidDir string) bool {
+		status, err := os.ReadFile(filepath.Join(pidDir, "status"))
+		if err != nil {
+			return false
+		}
+		for _, line := range strings.Split(string(status), "\n") {
+			if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "Uid:" {
+				uid = fields[1]
+				return true
+			}
+		}
+		return false
+	})
+	return uid
+}
+
+// environGpus returns the GPUs of a job from the environment of the first process found
+// in the cgroup or its children whose environment can be read. Slurm sets SLURM_JOB_GPUS
+// to the indices of the allocated GPUs, which are their minor numbers with the usual
+// 'File=/dev/nvidia[0-N]' in gres.conf. It returns nil if no environment can be read.
+func environGpus(dir string, procfsRoot string) []int {
+	var gpus []int
+	forEachProcess(dir, procfsRoot, func(pidDir string) bool {
+		raw, err := os.ReadFile(filepath.Join(pidDir, "environ"))
+		if err != nil {
+			return false
+		}
+		gpus = make([]int, 0)
+		env := make(map[string]string)
+		for _, entry := range strings.Split(string(raw), "\x00") {
+			if key, value, ok := strings.Cut(entry, "="); ok {
+				env[key] = value
+			}
+		}
+		for _, name := range gpuEnvVars {
+			if list, err := parseList(env[name]); err == nil && len(list) > 0 {
+				gpus = list
+				break
+			}
+		}
+		return true
+	})
+	return gpus
+}
+
+// Scan searches the cgroup hierarchy for Slurm job cgroups ('job_<id>') and reads their
+// cpusets and device allow lists. With cgroup v1, the job cgroups of the cpuset and the
+// devices hierarchy are merged and the uid is taken from the parent cgroup 'uid_<uid>'.
+// With cgroup v2, the uid is the owner of a process of the job and the GPUs are taken
+// from the environment of a process of the job, as there is no device allow list.
+func Scan(cgroupRoot, procfsRoot string) ([]Job, error) {
+	if _, err := os.Stat(cgroupRoot); err != nil {
+		return nil, err
+	}
+	jobs := make(map[string]*Job)
+
+	var walk func(dir string, depth int, uid string)
+	walk = func(dir string, depth int, uid string) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				continue
+			}
+			name := e.Name()
+			path := filepath.Join(dir, name)
+			if id, ok := strings.CutPrefix(name, "job_"); ok {
+				if _, err := strconv.Atoi(id); err != nil {
+					continue
+				}
+				job, ok := jobs[id]
+				if !ok {
+					job = &Job{JobId: id}
+					jobs[id] = job
+				}
+				if len(job.Uid) == 0 {
+					job.Uid = uid
+				}
+				if len(job.Hwthreads) == 0 {
+					job.Hwthreads = readCpuset(path)
+				}
+				if job.Accelerators == nil {
+					job.Accelerators = readDevices(path)
+				}
+				continue
+			}
+			if depth >= MAX_SCAN_DEPTH {
+				continue
+			}
+			if u, ok := strings.CutPrefix(name, "uid_"); ok {
+				walk(path, depth+1, u)
+			} else {
+				walk(path, depth+1, uid)
+			}
+		}
+	}
+	walk(cgroupRoot, 0, "")
+
+	ids := make([]string, 0, len(jobs))
+	for id := range jobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	list := make([]Job, 0, len(ids))
+	for _, id := range ids {
+		job := jobs[id]
+		if len(job.Uid) == 0 || job.Accelerators == nil {
+			dirs, _ := findJobDirs(cgroupRoot, id)
+			for _, d := range dirs {
+				if len(job.Uid) == 0 {
+					job.Uid = processOwner(d, procfsRoot)
+				}
+				if job.Accelerators == nil {
+					job.Accelerators = environGpus(d, procfsRoot)
+				}
+			}
+		}
+		list = append(list, *job)
+	}
+	return list, nil
+}
+
+// findJobDirs returns the cgroups of a job in the hierarchy
+func findJobDirs(cgroupRoot, id string) ([]string, error) {
+	dirs := make([]string, 0)
+	pattern := cgroupRoot
+	for depth := 0; depth <= MAX_SCAN_DEPTH; depth++ {
+		matches, err := filepath.Glob(filepath.Join(pattern, "job_"+id))
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, matches...)
+		pattern = filepath.Join(pattern, "*")
+	}
+	return dirs, nil
+}
+
+// normalizePCI returns a PCI address like '00000000:3B:00.0' as '0000:3b:00.0'
+func normalizePCI(address string) string {
+	domain, rest, ok := strings.Cut(strings.ToLower(address), ":")
+	if !ok {
+		return address
+	}
+	d, err := strconv.ParseUint(domain, 16, 32)
+	if err != nil {
+		return address
+	}
+	return fmt.Sprintf("%04x:%s", d, rest)
+}
+
+// NvidiaDevices returns the PCI addresses of the NVIDIA GPUs by their minor number
+// from '<procfs>/driver/nvidia/gpus/<pci address>/information'
+func NvidiaDevices(procfsRoot string) map[int]string {
+	devices := make(map[int]string)
+	files, _ := filepath.Glob(filepath.Join(procfsRoot, "driver", "nvidia", "gpus", "*", "information"))
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(raw), "\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok || strings.TrimSpace(key) != "Device Minor" {
+				continue
+			}
+			if minor, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+				devices[minor] = normalizePCI(filepath.Base(filepath.Dir(file)))
+			}
+		}
+	}
+	return devices
+}
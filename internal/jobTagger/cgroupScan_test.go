@@ -0,0 +1,192 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package jobTagger
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTree creates the files of a fake cgroup or procfs tree below root
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		list  string
+		want  []int
+		valid bool
+	}{
+		{"", []int{}, true},
+		{"5\n", []int{5}, true},
+		{"0-3,8,10-11", []int{0, 1, 2, 3, 8, 10, 11}, true},
+		{"a", nil, false},
+		{"0-x", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			list, err := parseList(tt.list)
+			if valid := err == nil; valid != tt.valid {
+				t.Fatalf("parseList(%q) error %v, want valid %v", tt.list, err, tt.valid)
+			}
+			if !reflect.DeepEqual(list, tt.want) {
+				t.Errorf("parseList(%q) = %v, want %v", tt.list, list, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadDevices(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []int
+	}{
+		{"gpus", map[string]string{"devices.list": "c 1:3 rwm\nc 195:3 rw\nc 195:1 rw\nc 195:255 rw\nb 195:0 rw\n"}, []int{1, 3}},
+		{"no gpus", map[string]string{"devices.list": "c 1:3 rwm\n"}, []int{}},
+		{"no allow list", map[string]string{"cpuset.cpus": "0"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, tt.files)
+			if gpus := readDevices(dir); !reflect.DeepEqual(gpus, tt.want) {
+				t.Errorf("readDevices() = %#v, want %#v", gpus, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessOwner(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"process of a task", map[string]string{
+			"job/step_0/user/task_0/cgroup.procs": "20\n",
+			"proc/20/status":                      "Name:\tbash\nUid:\t1000\t1000\t1000\t1000\n",
+		}, "1000"},
+		{"slurmstepd skipped", map[string]string{
+			"job/slurm/cgroup.procs":  "10\n",
+			"job/step_0/cgroup.procs": "20\n",
+			"proc/10/status":          "Uid:\t0\t0\t0\t0\n",
+			"proc/20/status":          "Uid:\t1001\t1001\t1001\t1001\n",
+		}, "1001"},
+		{"exited process", map[string]string{
+			"job/step_0/cgroup.procs": "20\n21\n",
+			"proc/21/status":          "Uid:\t1002\t1002\t1002\t1002\n",
+		}, "1002"},
+		{"only slurmstepd", map[string]string{
+			"job/slurm/cgroup.procs": "10\n",
+			"proc/10/status":         "Uid:\t0\t0\t0\t0\n",
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, tt.files)
+			if uid := processOwner(filepath.Join(dir, "job"), filepath.Join(dir, "proc")); uid != tt.want {
+				t.Errorf("processOwner() = %q, want %q", uid, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvironGpus(t *testing.T) {
+	tests := []struct {
+		name    string
+		environ string // no environ file if empty
+		want    []int
+	}{
+		{"job gpus", "PATH=/bin\x00SLURM_JOB_GPUS=0,2\x00", []int{0, 2}},
+		{"step gpus", "SLURM_STEP_GPUS=1-2\x00", []int{1, 2}},
+		{"no gpus", "PATH=/bin\x00", []int{}},
+		{"invalid list", "SLURM_JOB_GPUS=all\x00", []int{}},
+		{"unreadable", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := map[string]string{"job/step_0/cgroup.procs": "20\n"}
+			if len(tt.environ) > 0 {
+				files["proc/20/environ"] = tt.environ
+			}
+			writeTree(t, dir, files)
+			if gpus := environGpus(filepath.Join(dir, "job"), filepath.Join(dir, "proc")); !reflect.DeepEqual(gpus, tt.want) {
+				t.Errorf("environGpus() = %#v, want %#v", gpus, tt.want)
+			}
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []Job
+	}{
+		{"cgroup v1", map[string]string{
+			"cgroup/cpuset/slurm/uid_1000/job_1/cpuset.effective_cpus": "0-1\n",
+			"cgroup/cpuset/slurm/uid_1000/job_1/cpuset.cpus":           "0-3\n",
+			"cgroup/devices/slurm/uid_1000/job_1/devices.list":         "c 195:1 rw\nc 195:255 rw\n",
+			"cgroup/cpuset/slurm/uid_1001/job_3/cpuset.effective_cpus": "2\n",
+			"cgroup/cpuset/slurm/uid_1001/job_x/cpuset.effective_cpus": "3\n",
+		}, []Job{
+			{JobId: "1", Uid: "1000", Hwthreads: []int{0, 1}, Accelerators: []int{1}},
+			{JobId: "3", Uid: "1001", Hwthreads: []int{2}},
+		}},
+		{"cgroup v2", map[string]string{
+			"cgroup/system.slice/slurmstepd.scope/job_2/cpuset.cpus.effective":               "4-5\n",
+			"cgroup/system.slice/slurmstepd.scope/job_2/slurm/cgroup.procs":                  "10\n",
+			"cgroup/system.slice/slurmstepd.scope/job_2/step_0/user/task_0/cgroup.procs":     "20\n",
+			"cgroup/system.slice/slurmstepd.scope/job_4/cpuset.cpus.effective":               "6\n",
+			"cgroup/system.slice/slurmstepd.scope/job_4/step_batch/user/task_0/cgroup.procs": "30\n",
+			"proc/10/status":  "Uid:\t0\t0\t0\t0\n",
+			"proc/10/environ": "SLURM_JOB_GPUS=0-7\x00",
+			"proc/20/status":  "Uid:\t1002\t1002\t1002\t1002\n",
+			"proc/20/environ": "PATH=/bin\x00SLURM_JOB_GPUS=2,3\x00",
+			"proc/30/status":  "Uid:\t1003\t1003\t1003\t1003\n",
+		}, []Job{
+			{JobId: "2", Uid: "1002", Hwthreads: []int{4, 5}, Accelerators: []int{2, 3}},
+			{JobId: "4", Uid: "1003", Hwthreads: []int{6}},
+		}},
+		{"no jobs", map[string]string{
+			"cgroup/system.slice/cpuset.cpus.effective": "0-7\n",
+		}, []Job{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, tt.files)
+			jobs, err := Scan(filepath.Join(dir, "cgroup"), filepath.Join(dir, "proc"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(jobs, tt.want) {
+				t.Errorf("Scan() = %+v, want %+v", jobs, tt.want)
+			}
+		})
+	}
+
+	if _, err := Scan(filepath.Join(t.TempDir(), "missing"), "/proc"); err == nil {
+		t.Errorf("Scan() of a missing cgroup root succeeded")
+	}
+}
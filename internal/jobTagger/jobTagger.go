@@ -0,0 +1,320 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package jobTagger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cclog "github.com/ClusterCockpit/cc-lib/ccLogger"
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/ccTopology"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/clock"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/hostfs"
+)
+
+// Defaults of the job tagger configuration
+const (
+	DEFAULT_CGROUP_ROOT   = "/sys/fs/cgroup"
+	DEFAULT_SCAN_INTERVAL = 30 * time.Second
+	DEFAULT_JOBID_TAG     = "jobid"
+	DEFAULT_USER_TAG      = "user"
+)
+
+// Metric types tagged by default
+var DEFAULT_TYPES = []string{"hwthread", "core", "socket", "die", "memoryDomain", "accelerator"}
+
+// Job tagger configuration
+type JobTaggerConfig struct {
+	CgroupRoot string   `json:"cgroup_root,omitempty"` // Root of the cgroup hierarchy (default '/sys/fs/cgroup' below the global sysfs root)
+	ProcfsRoot string   `json:"procfs_root,omitempty"` // Directory of procfs for the owners of the jobs' processes and the GPU information
+	Interval   string   `json:"interval,omitempty"`    // Interval of scanning the cgroup hierarchy (default '30s')
+	JobIdTag   string   `json:"jobid_tag,omitempty"`   // Name of the job ID tag (default 'jobid')
+	UserTag    string   `json:"user_tag,omitempty"`    // Name of the user tag (default 'user'), '-' to disable
+	Types      []string `json:"types,omitempty"`       // Metric types to tag (default: all)
+}
+
+// Mapping of the type-ids of all metric types to the jobs using them exclusively
+type jobMapping map[string]map[string]*Job
+
+// Job tagger data structure
+type jobTagger struct {
+	config   JobTaggerConfig
+	interval time.Duration
+	types    map[string]bool
+	mapping  atomic.Pointer[jobMapping]
+	users    map[string]string // Cache of user names by uid
+	unknown  bool              // GPUs of a job were unknown, logged once
+	clock    clock.Clock
+	done     chan bool
+	wg       *sync.WaitGroup
+}
+
+// JobTagger adds the job ID and user of the Slurm job using a hardware thread, core,
+// socket or accelerator to its metrics
+type JobTagger interface {
+	Start()
+	Tag(m lp.CCMessage)
+	Close()
+}
+
+// parseConfig decodes the configuration and sets the defaults
+func parseConfig(rawConfig json.RawMessage) (JobTaggerConfig, time.Duration, error) {
+	var config JobTaggerConfig
+	d := json.NewDecoder(bytes.NewReader(rawConfig))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&config); err != nil {
+		return config, 0, err
+	}
+	interval := DEFAULT_SCAN_INTERVAL
+	if len(config.Interval) > 0 {
+		var err error
+		interval, err = time.ParseDuration(config.Interval)
+		if err != nil {
+			return config, 0, fmt.Errorf("interval: %v", err)
+		}
+		if interval <= 0 {
+			return config, 0, errors.New("interval: must be greater than zero")
+		}
+	}
+	for i, t := range config.Types {
+		if !slices.Contains(DEFAULT_TYPES, t) {
+			return config, 0, fmt.Errorf("types[%d]: unknown type '%s', use one of %s", i, t, strings.Join(DEFAULT_TYPES, ", "))
+		}
+	}
+	if len(config.CgroupRoot) == 0 {
+		config.CgroupRoot = hostfs.Path(DEFAULT_CGROUP_ROOT)
+	}
+	if len(config.ProcfsRoot) == 0 {
+		config.ProcfsRoot = hostfs.GetRoots().Procfs
+	}
+	if len(config.JobIdTag) == 0 {
+		config.JobIdTag = DEFAULT_JOBID_TAG
+	}
+	if len(config.UserTag) == 0 {
+		config.UserTag = DEFAULT_USER_TAG
+	}
+	if len(config.Types) == 0 {
+		config.Types = DEFAULT_TYPES
+	}
+	return config, interval, nil
+}
+
+// ValidateConfig checks the job tagger configuration without scanning the cgroups
+func ValidateConfig(rawConfig json.RawMessage) []error {
+	if _, _, err := parseConfig(rawConfig); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
+// userName returns the name of a user or the uid if it is unknown
+func (t *jobTagger) userName(uid string) string {
+	if len(uid) == 0 {
+		return ""
+	}
+	if name, ok := t.users[uid]; ok {
+		return name
+	}
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	t.users[uid] = name
+	return name
+}
+
+// typeHwthreads returns the type-ids of a metric type and their hardware threads
+func typeHwthreads(metricType string) map[int][]int {
+	ids := make(map[int][]int)
+	for _, id := range ccTopology.GetTypeList(metricType) {
+		ids[id] = ccTopology.GetTypeHwthreads(metricType, id)
+	}
+	return ids
+}
+
+// buildMapping maps the type-ids of all configured metric types to the job using them.
+// A type-id used by several jobs is not mapped.
+func (t *jobTagger) buildMapping(jobs []Job, gpus map[int]string) *jobMapping {
+	hwthreadJobs := make(map[int][]*Job)
+	for i := range jobs {
+		for _, cpu := range jobs[i].Hwthreads {
+			hwthreadJobs[cpu] = append(hwthreadJobs[cpu], &jobs[i])
+		}
+	}
+
+	// The only job of a set of hardware threads or nil
+	onlyJob := func(hwthreads []int) *Job {
+		var job *Job
+		for _, cpu := range hwthreads {
+			for _, j := range hwthreadJobs[cpu] {
+				if job != nil && job.JobId != j.JobId {
+					return nil
+				}
+				job = j
+			}
+		}
+		return job
+	}
+
+	mapping := make(jobMapping)
+	for metricType := range t.types {
+		ids := make(map[string]*Job)
+		switch metricType {
+		case "hwthread":
+			for cpu := range hwthreadJobs {
+				if job := onlyJob([]int{cpu}); job != nil {
+					ids[strconv.Itoa(cpu)] = job
+				}
+			}
+		case "accelerator":
+			owners := make(map[int][]*Job)
+			for i := range jobs {
+				for _, minor := range jobs[i].Accelerators {
+					owners[minor] = append(owners[minor], &jobs[i])
+				}
+			}
+			for minor, o := range owners {
+				if len(o) != 1 {
+					continue
+				}
+				ids[strconv.Itoa(minor)] = o[0]
+				if pci, ok := gpus[minor]; ok {
+					ids[pci] = o[0]
+				}
+			}
+		default:
+			for id, hwthreads := range typeHwthreads(metricType) {
+				if job := onlyJob(hwthreads); job != nil {
+					ids[strconv.Itoa(id)] = job
+				}
+			}
+		}
+		mapping[metricType] = ids
+	}
+	return &mapping
+}
+
+// scan reads the jobs from the cgroup hierarchy and replaces the mapping
+func (t *jobTagger) scan() {
+	jobs, err := Scan(t.config.CgroupRoot, t.config.ProcfsRoot)
+	if err != nil {
+		cclog.ComponentError("JobTagger", "Scanning", t.config.CgroupRoot, "failed:", err.Error())
+		return
+	}
+	for i := range jobs {
+		jobs[i].User = t.userName(jobs[i].Uid)
+	}
+	var gpus map[int]string
+	if t.types["accelerator"] {
+		gpus = NvidiaDevices(t.config.ProcfsRoot)
+		for i := range jobs {
+			if jobs[i].Accelerators == nil && !t.unknown {
+				cclog.ComponentInfo("JobTagger", "GPUs of job", jobs[i].JobId, "unknown: no device allow list (cgroup v1)",
+					"and no readable environment of its processes (cgroup v2), GPU metrics of such jobs are not tagged")
+				t.unknown = true
+			}
+		}
+	}
+	t.mapping.Store(t.buildMapping(jobs, gpus))
+	cclog.ComponentDebug("JobTagger", "Found", len(jobs), "jobs")
+}
+
+// Tag adds the job ID and user tags to a metric of a hardware thread, core, socket,
+// die, memory domain or accelerator used by a single job
+func (t *jobTagger) Tag(m lp.CCMessage) {
+	mapping := t.mapping.Load()
+	if mapping == nil {
+		return
+	}
+	metricType, ok := m.GetTag("type")
+	if !ok {
+		return
+	}
+	ids, ok := (*mapping)[metricType]
+	if !ok {
+		return
+	}
+	id, ok := m.GetTag("type-id")
+	if !ok {
+		return
+	}
+	if metricType == "accelerator" && strings.Contains(id, ":") {
+		id = normalizePCI(id)
+	}
+	job, ok := ids[id]
+	if !ok {
+		return
+	}
+	m.AddTag(t.config.JobIdTag, job.JobId)
+	if t.config.UserTag != "-" && len(job.User) > 0 {
+		m.AddTag(t.config.UserTag, job.User)
+	}
+}
+
+// Start scans the cgroup hierarchy once and then periodically in the background
+func (t *jobTagger) Start() {
+	t.scan()
+	ticker := t.clock.NewTicker(t.interval)
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.done:
+				cclog.ComponentDebug("JobTagger", "DONE")
+				return
+			case <-ticker.C():
+				t.scan()
+			}
+		}
+	}()
+	cclog.ComponentDebug("JobTagger", "STARTED")
+}
+
+// Close stops scanning the cgroup hierarchy
+func (t *jobTagger) Close() {
+	cclog.ComponentDebug("JobTagger", "CLOSE")
+	close(t.done)
+}
+
+// New creates a new job tagger
+func New(wg *sync.WaitGroup, rawConfig json.RawMessage) (JobTagger, error) {
+	return NewWithClock(wg, clock.Real, rawConfig)
+}
+
+// NewWithClock creates a new job tagger scanning at the intervals of the given clock
+func NewWithClock(wg *sync.WaitGroup, clk clock.Clock, rawConfig json.RawMessage) (JobTagger, error) {
+	config, interval, err := parseConfig(rawConfig)
+	if err != nil {
+		return nil, err
+	}
+	t := &jobTagger{
+		config:   config,
+		interval: interval,
+		types:    make(map[string]bool),
+		users:    make(map[string]string),
+		clock:    clk,
+		done:     make(chan bool),
+		wg:       wg,
+	}
+	for _, metricType := range config.Types {
+		t.types[metricType] = true
+	}
+	return t, nil
+}
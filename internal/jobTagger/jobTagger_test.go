@@ -0,0 +1,154 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package jobTagger
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/clock"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestTagger creates a job tagger for the given metric types without scanning
+func newTestTagger(t *testing.T, clk clock.Clock, config string) *jobTagger {
+	t.Helper()
+	var wg sync.WaitGroup
+	jt, err := NewWithClock(&wg, clk, json.RawMessage(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jt.(*jobTagger)
+}
+
+// tagged tags a metric of the given type and type-id and returns its job ID and user tags
+func tagged(t *testing.T, jt JobTagger, metricType, typeId string) (string, string) {
+	t.Helper()
+	m, err := lp.NewMetric("test", map[string]string{"type": metricType, "type-id": typeId}, nil, 1, testStart)
+	if err != nil || m == nil {
+		t.Fatalf("cannot create metric: %v", err)
+	}
+	jt.Tag(m)
+	jobid, _ := m.GetTag("jobid")
+	user, _ := m.GetTag("user")
+	return jobid, user
+}
+
+// waitFor polls a condition, the job tagger scans in its own goroutine
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		config string
+		valid  bool
+	}{
+		{`{}`, true},
+		{`{"interval": "1m", "types": ["hwthread", "accelerator"], "user_tag": "-"}`, true},
+		{`{"interval": "60"}`, false},
+		{`{"interval": "0s"}`, false},
+		{`{"types": ["node"]}`, false},
+		{`{"cgroup": "/sys/fs/cgroup"}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.config, func(t *testing.T) {
+			errs := ValidateConfig(json.RawMessage(tt.config))
+			if valid := len(errs) == 0; valid != tt.valid {
+				t.Errorf("ValidateConfig() = %v, want valid %v", errs, tt.valid)
+			}
+		})
+	}
+}
+
+func TestBuildMapping(t *testing.T) {
+	jt := newTestTagger(t, clock.Real, `{"types": ["hwthread", "accelerator"]}`)
+	// The jobs share hardware thread 1 and GPU 0
+	jobs := []Job{
+		{JobId: "1", User: "alice", Hwthreads: []int{0, 1}, Accelerators: []int{0}},
+		{JobId: "2", User: "bob", Hwthreads: []int{1, 2}, Accelerators: []int{0, 1}},
+		{JobId: "3", Hwthreads: []int{3}},
+	}
+	jt.mapping.Store(jt.buildMapping(jobs, map[int]string{0: "0000:3b:00.0", 1: "0000:af:00.0"}))
+
+	tests := []struct {
+		metricType string
+		typeId     string
+		jobid      string
+		user       string
+	}{
+		{"hwthread", "0", "1", "alice"},
+		{"hwthread", "1", "", ""},
+		{"hwthread", "2", "2", "bob"},
+		{"hwthread", "3", "3", ""},
+		{"hwthread", "4", "", ""},
+		{"accelerator", "0", "", ""},
+		{"accelerator", "0000:3b:00.0", "", ""},
+		{"accelerator", "1", "2", "bob"},
+		{"accelerator", "00000000:AF:00.0", "2", "bob"},
+		{"socket", "0", "", ""},
+		{"node", "0", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %s", tt.metricType, tt.typeId), func(t *testing.T) {
+			jobid, user := tagged(t, jt, tt.metricType, tt.typeId)
+			if jobid != tt.jobid || user != tt.user {
+				t.Errorf("tagged with job %q of user %q, want job %q of user %q", jobid, user, tt.jobid, tt.user)
+			}
+		})
+	}
+}
+
+func TestStart(t *testing.T) {
+	dir := t.TempDir()
+	cgroup := filepath.Join(dir, "cgroup", "system.slice", "slurmstepd.scope")
+	writeTree(t, cgroup, map[string]string{"job_1/cpuset.cpus.effective": "0\n"})
+	clk := clock.NewFake(testStart)
+	var wg sync.WaitGroup
+	jt, err := NewWithClock(&wg, clk, json.RawMessage(fmt.Sprintf(`{
+		"cgroup_root": %q,
+		"procfs_root": %q,
+		"interval": "30s",
+		"user_tag": "-",
+		"types": ["hwthread"]
+	}`, filepath.Join(dir, "cgroup"), filepath.Join(dir, "proc"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first scan is done by Start(), the next one after the interval
+	jt.Start()
+	if jobid, _ := tagged(t, jt, "hwthread", "0"); jobid != "1" {
+		t.Errorf("hardware thread 0 tagged with job %q after the start, want job 1", jobid)
+	}
+	writeTree(t, cgroup, map[string]string{"job_2/cpuset.cpus.effective": "1\n"})
+	clk.Advance(29 * time.Second)
+	if jobid, _ := tagged(t, jt, "hwthread", "1"); jobid != "" {
+		t.Errorf("hardware thread 1 tagged with job %q before the interval", jobid)
+	}
+	clk.Advance(time.Second)
+	waitFor(t, "the second scan", func() bool {
+		jobid, _ := tagged(t, jt, "hwthread", "1")
+		return jobid == "2"
+	})
+	jt.Close()
+	wg.Wait()
+}
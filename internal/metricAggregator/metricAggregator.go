@@ -328,6 +328,20 @@ func (c *metricAggregator) AddAggregation(name, function, condition string, tags
 	return nil
 }
 
+// CheckAggregation compiles the function and the condition of an interval aggregation
+// like AddAggregation does, without adding it
+func CheckAggregation(function, condition string) error {
+	newfunc := strings.ReplaceAll(function, "'", "\"")
+	newcond := strings.ReplaceAll(condition, "'", "\"")
+	if _, err := gval.Full(metricCacheLanguage).NewEvaluable(newcond); err != nil {
+		return fmt.Errorf("invalid if condition '%s': %v", condition, err)
+	}
+	if _, err := gval.Full(metricCacheLanguage).NewEvaluable(newfunc); err != nil {
+		return fmt.Errorf("invalid function '%s': %v", function, err)
+	}
+	return nil
+}
+
 func (c *metricAggregator) DeleteAggregation(name string) error {
 	for i, agg := range c.functions {
 		if agg.Name == name {
@@ -396,6 +410,17 @@ func EvalFloat64Condition(condition string, params map[string]float64) (float64,
 	return value, err
 }
 
+// CheckCondition compiles a condition or formula without evaluating it.
+// It returns an error if the term cannot be parsed.
+func CheckCondition(condition string) error {
+	newcond :=
+		strings.ReplaceAll(
+			strings.ReplaceAll(
+				condition, "'", "\""), "%", "\\")
+	_, err := language.NewEvaluable(newcond)
+	return err
+}
+
 func NewAggregator(output chan lp.CCMessage) (MetricAggregator, error) {
 	a := new(metricAggregator)
 	err := a.Init(output)
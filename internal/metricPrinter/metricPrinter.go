@@ -0,0 +1,228 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package metricPrinter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	cclog "github.com/ClusterCockpit/cc-lib/ccLogger"
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+)
+
+// Output formats of the metric printer
+const (
+	PRINTER_FORMAT_INFLUX = "influx"
+	PRINTER_FORMAT_JSON   = "json"
+	PRINTER_FORMAT_TABLE  = "table"
+)
+
+// Time without new messages after which the buffered messages are printed as table
+const PRINTER_TABLE_QUIET_TIME = 250 * time.Millisecond
+
+// Metric printer data structure
+type metricPrinter struct {
+	format  string
+	filters []string
+	input   chan lp.CCMessage
+	output  io.Writer
+	done    chan bool
+	wg      *sync.WaitGroup
+	buffer  []lp.CCMessage
+}
+
+// Metric printer access functions
+type MetricPrinter interface {
+	Init(wg *sync.WaitGroup, format string, filter string) error
+	AddInput(input chan lp.CCMessage)
+	Start()
+	Close()
+}
+
+// Init initializes the metric printer.
+// The filter is a comma separated list of glob patterns matched against the metric names.
+func (p *metricPrinter) Init(wg *sync.WaitGroup, format string, filter string) error {
+	p.wg = wg
+	p.done = make(chan bool)
+	p.output = os.Stdout
+	p.buffer = make([]lp.CCMessage, 0)
+	switch format {
+	case PRINTER_FORMAT_INFLUX, PRINTER_FORMAT_JSON, PRINTER_FORMAT_TABLE:
+		p.format = format
+	default:
+		return fmt.Errorf("unknown output format '%s', use '%s', '%s' or '%s'",
+			format, PRINTER_FORMAT_INFLUX, PRINTER_FORMAT_JSON, PRINTER_FORMAT_TABLE)
+	}
+	p.filters = make([]string, 0)
+	for _, f := range strings.Split(filter, ",") {
+		f = strings.TrimSpace(f)
+		if len(f) == 0 {
+			continue
+		}
+		if _, err := path.Match(f, ""); err != nil {
+			return fmt.Errorf("invalid filter '%s': %v", f, err)
+		}
+		p.filters = append(p.filters, f)
+	}
+	return nil
+}
+
+// AddInput sets the channel the messages are read from
+func (p *metricPrinter) AddInput(input chan lp.CCMessage) {
+	p.input = input
+}
+
+// match checks whether the metric name matches any of the filters
+func (p *metricPrinter) match(msg lp.CCMessage) bool {
+	if len(p.filters) == 0 {
+		return true
+	}
+	for _, f := range p.filters {
+		if ok, _ := path.Match(f, msg.Name()); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// print writes a message in influx or JSON format
+func (p *metricPrinter) print(msg lp.CCMessage) {
+	switch p.format {
+	case PRINTER_FORMAT_INFLUX:
+		fmt.Fprintln(p.output, strings.TrimRight(msg.ToLineProtocol(nil), "\n"))
+	case PRINTER_FORMAT_JSON:
+		j, err := msg.ToJSON(nil)
+		if err != nil {
+			cclog.ComponentError("MetricPrinter", "Failed to encode message", msg.Name(), ":", err.Error())
+			return
+		}
+		fmt.Fprintln(p.output, string(j))
+	}
+}
+
+// printTable writes all buffered messages as table, grouped by source and type-id
+func (p *metricPrinter) printTable() {
+	if len(p.buffer) == 0 {
+		return
+	}
+	get := func(msg lp.CCMessage, key string) string {
+		if v, ok := msg.GetTag(key); ok {
+			return v
+		}
+		if v, ok := msg.GetMeta(key); ok {
+			return v
+		}
+		return "-"
+	}
+	sort.SliceStable(p.buffer, func(i, j int) bool {
+		a, b := p.buffer[i], p.buffer[j]
+		for _, k := range []string{"source", "type", "type-id"} {
+			if va, vb := get(a, k), get(b, k); va != vb {
+				return va < vb
+			}
+		}
+		return a.Name() < b.Name()
+	})
+
+	fmt.Fprintf(p.output, "=== %s\n", p.buffer[0].Time().Format(time.RFC3339))
+	w := tabwriter.NewWriter(p.output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tTYPE\tTYPE-ID\tMETRIC\tVALUE\tUNIT\tOTHER TAGS")
+	for _, msg := range p.buffer {
+		value := "-"
+		if v, ok := msg.GetField("value"); ok {
+			value = fmt.Sprintf("%v", v)
+		}
+		other := make([]string, 0)
+		for k, v := range msg.Tags() {
+			switch k {
+			case "hostname", "type", "type-id", "unit":
+			default:
+				other = append(other, k+"="+v)
+			}
+		}
+		sort.Strings(other)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			get(msg, "source"), get(msg, "type"), get(msg, "type-id"),
+			msg.Name(), value, get(msg, "unit"), strings.Join(other, ","))
+	}
+	w.Flush()
+	fmt.Fprintln(p.output)
+	p.buffer = p.buffer[:0]
+}
+
+// Start starts printing the messages from the input channel.
+// In table format, the messages are buffered and printed when no new
+// messages arrived for PRINTER_TABLE_QUIET_TIME.
+func (p *metricPrinter) Start() {
+	quiet := time.NewTimer(PRINTER_TABLE_QUIET_TIME)
+	quiet.Stop()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer quiet.Stop()
+		for {
+			select {
+			case <-p.done:
+				// Print remaining messages
+				for len(p.input) > 0 {
+					msg := <-p.input
+					if p.match(msg) {
+						if p.format == PRINTER_FORMAT_TABLE {
+							p.buffer = append(p.buffer, msg)
+						} else {
+							p.print(msg)
+						}
+					}
+				}
+				p.printTable()
+				close(p.done)
+				cclog.ComponentDebug("MetricPrinter", "DONE")
+				return
+			case msg := <-p.input:
+				if !p.match(msg) {
+					continue
+				}
+				if p.format != PRINTER_FORMAT_TABLE {
+					p.print(msg)
+					continue
+				}
+				p.buffer = append(p.buffer, msg)
+				quiet.Reset(PRINTER_TABLE_QUIET_TIME)
+			case <-quiet.C:
+				p.printTable()
+			}
+		}
+	}()
+	cclog.ComponentDebug("MetricPrinter", "STARTED")
+}
+
+// Close prints the remaining messages and stops the metric printer
+func (p *metricPrinter) Close() {
+	cclog.ComponentDebug("MetricPrinter", "CLOSE")
+	p.done <- true
+	// wait for close of channel p.done
+	<-p.done
+}
+
+// New creates a new initialized metric printer
+func New(wg *sync.WaitGroup, format string, filter string) (MetricPrinter, error) {
+	p := new(metricPrinter)
+	err := p.Init(wg, format, filter)
+	if err != nil {
+		return nil, err
+	}
+	return p, err
+}
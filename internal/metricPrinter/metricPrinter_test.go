@@ -0,0 +1,114 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package metricPrinter
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testMetric creates a metric or fails the test
+func testMetric(t *testing.T, name string, tags map[string]string, value interface{}) lp.CCMessage {
+	t.Helper()
+	m, err := lp.NewMetric(name, tags, map[string]string{"source": "test", "unit": "bytes"}, value, testStart)
+	if err != nil || m == nil {
+		t.Fatalf("cannot create metric %s: %v", name, err)
+	}
+	return m
+}
+
+// printAll prints the messages with the given format and filter and returns the output
+func printAll(t *testing.T, format, filter string, msgs ...lp.CCMessage) string {
+	t.Helper()
+	var wg sync.WaitGroup
+	p, err := New(&wg, format, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	p.(*metricPrinter).output = &out
+	input := make(chan lp.CCMessage, len(msgs))
+	for _, m := range msgs {
+		input <- m
+	}
+	p.AddInput(input)
+	p.Start()
+	p.Close()
+	wg.Wait()
+	return out.String()
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		filter string
+		valid  bool
+	}{
+		{"table", PRINTER_FORMAT_TABLE, "", true},
+		{"filters", PRINTER_FORMAT_JSON, "cpu_*, mem_used,", true},
+		{"unknown format", "csv", "", false},
+		{"invalid filter", PRINTER_FORMAT_INFLUX, "cpu_[", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			if _, err := New(&wg, tt.format, tt.filter); (err == nil) != tt.valid {
+				t.Errorf("New() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestPrintFiltered(t *testing.T) {
+	msgs := []lp.CCMessage{
+		testMetric(t, "cpu_user", map[string]string{"type": "hwthread", "type-id": "0"}, 1.5),
+		testMetric(t, "mem_used", map[string]string{"type": "node"}, 1024),
+		testMetric(t, "net_bytes_in", map[string]string{"type": "node"}, 10),
+	}
+	for _, format := range []string{PRINTER_FORMAT_INFLUX, PRINTER_FORMAT_JSON} {
+		t.Run(format, func(t *testing.T) {
+			out := printAll(t, format, "cpu_*,mem_used", msgs...)
+			lines := strings.Split(strings.TrimSpace(out), "\n")
+			if len(lines) != 2 || !strings.Contains(lines[0], "cpu_user") || !strings.Contains(lines[1], "mem_used") {
+				t.Errorf("printed %q, want one line for each metric matching the filter", out)
+			}
+		})
+	}
+}
+
+func TestPrintTable(t *testing.T) {
+	out := printAll(t, PRINTER_FORMAT_TABLE, "",
+		testMetric(t, "cpu_user", map[string]string{"type": "hwthread", "type-id": "1", "jobid": "42"}, 2),
+		testMetric(t, "mem_used", map[string]string{"type": "node"}, 1024),
+		testMetric(t, "cpu_user", map[string]string{"type": "hwthread", "type-id": "0"}, 1.5),
+	)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 5 || lines[0] != "=== 2024-01-01T00:00:00Z" {
+		t.Fatalf("printed %q, want a header, the column names and 3 metrics", out)
+	}
+	// Sorted by source, type and type-id
+	want := [][]string{
+		{"SOURCE", "TYPE", "TYPE-ID", "METRIC", "VALUE", "UNIT", "OTHER", "TAGS"},
+		{"test", "hwthread", "0", "cpu_user", "1.5", "bytes"},
+		{"test", "hwthread", "1", "cpu_user", "2", "bytes", "jobid=42"},
+		{"test", "node", "-", "mem_used", "1024", "bytes"},
+	}
+	for i, fields := range want {
+		if got := strings.Fields(lines[i+1]); strings.Join(got, " ") != strings.Join(fields, " ") {
+			t.Errorf("line %d = %q, want the columns %v", i+1, lines[i+1], fields)
+		}
+	}
+}
@@ -9,6 +9,7 @@ package metricRouter
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	cclog "github.com/ClusterCockpit/cc-lib/ccLogger"
@@ -31,13 +32,15 @@ type metricCache struct {
 	numPeriods int
 	curPeriod  int
 	lock       sync.Mutex
+	aggLock    sync.Mutex // Lock for the aggregation engine (evaluation vs. reconfiguration)
 	intervals  []*metricCachePeriod
 	wg         *sync.WaitGroup
 	ticker     mct.MultiChanTicker
-	tickchan   chan time.Time
+	tickchan   chan mct.Tick
 	done       chan bool
 	output     chan lp.CCMessage
 	aggEngine  agg.MetricAggregator
+	evalTime   atomic.Int64 // duration of the last evaluation of the aggregations in nanoseconds
 }
 
 type MetricCache interface {
@@ -47,6 +50,7 @@ type MetricCache interface {
 	GetPeriod(index int) (time.Time, time.Time, []lp.CCMessage)
 	AddAggregation(name, function, condition string, tags, meta map[string]string) error
 	DeleteAggregation(name string) error
+	EvalDuration() time.Duration
 	Close()
 }
 
@@ -80,8 +84,8 @@ func (c *metricCache) Init(output chan lp.CCMessage, ticker mct.MultiChanTicker,
 // Start starts the metric cache
 func (c *metricCache) Start() {
 
-	c.tickchan = make(chan time.Time)
-	c.ticker.AddChannel(c.tickchan)
+	c.tickchan = make(chan mct.Tick)
+	c.ticker.AddTickChannel("cache", c.tickchan)
 	// Router cache is done
 	done := func() {
 		cclog.ComponentDebug("MetricCache", "DONE")
@@ -111,13 +115,20 @@ func (c *metricCache) Start() {
 				done()
 				return
 			case tick := <-c.tickchan:
+				if tick.Missed > 0 {
+					cclog.ComponentError("MetricCache", "Missed", tick.Missed, "ticks, the evaluation of the aggregations took longer than the interval")
+				}
 				c.lock.Lock()
-				old := rotate(tick)
+				old := rotate(tick.Time)
 				// Get the last period and evaluate aggregation metrics
 				starttime, endtime, metrics := c.GetPeriod(old)
 				c.lock.Unlock()
 				if len(metrics) > 0 {
+					c.aggLock.Lock()
+					evalStart := c.ticker.Clock().Now()
 					c.aggEngine.Eval(starttime, endtime, metrics)
+					c.evalTime.Store(int64(c.ticker.Clock().Since(evalStart)))
+					c.aggLock.Unlock()
 				} else {
 					// This message is also printed in the first interval after startup
 					cclog.ComponentDebug("MetricCache", "EMPTY INTERVAL?")
@@ -150,19 +161,28 @@ func (c *metricCache) Add(metric lp.CCMessage) {
 }
 
 func (c *metricCache) AddAggregation(name, function, condition string, tags, meta map[string]string) error {
+	c.aggLock.Lock()
+	defer c.aggLock.Unlock()
 	return c.aggEngine.AddAggregation(name, function, condition, tags, meta)
 }
 
 func (c *metricCache) DeleteAggregation(name string) error {
+	c.aggLock.Lock()
+	defer c.aggLock.Unlock()
 	return c.aggEngine.DeleteAggregation(name)
 }
 
+// EvalDuration returns the duration of the last evaluation of the interval aggregations
+func (c *metricCache) EvalDuration() time.Duration {
+	return time.Duration(c.evalTime.Load())
+}
+
 // Get all metrics of a interval. The index is the difference to the current interval, so index=0
 // is the current one, index=1 the last interval and so on. Returns and empty array if a wrong index
 // is given (negative index, index larger than configured number of total intervals, ...)
 func (c *metricCache) GetPeriod(index int) (time.Time, time.Time, []lp.CCMessage) {
-	var start time.Time = time.Now()
-	var stop time.Time = time.Now()
+	var start time.Time = c.ticker.Clock().Now()
+	var stop time.Time = c.ticker.Clock().Now()
 	var metrics []lp.CCMessage
 	if index >= 0 && index < c.numPeriods {
 		pindex := c.curPeriod - index
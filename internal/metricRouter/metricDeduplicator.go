@@ -0,0 +1,158 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package metricRouter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+)
+
+// Metric deduplicator rule configuration
+type metricDeduplicatorConfig struct {
+	Metrics      []string `json:"metrics,omitempty"`       // Names of the metrics the rule applies to
+	Condition    string   `json:"if,omitempty"`            // Condition selecting the metrics the rule applies to
+	AbsTolerance float64  `json:"abs_tolerance,omitempty"` // Maximal absolute difference of an unchanged value
+	RelTolerance float64  `json:"rel_tolerance,omitempty"` // Maximal difference of an unchanged value relative to the last forwarded value
+	Heartbeat    string   `json:"heartbeat,omitempty"`     // Time after the last forwarded message after which an unchanged value is forwarded anyway (default: never)
+}
+
+// State of a deduplicated series. The times are the times of the messages.
+type metricDeduplicatorSeries struct {
+	value     interface{}   // Last forwarded value
+	forwarded time.Time     // Time of the last forwarded message
+	heartbeat time.Duration // Heartbeat of the rule applied to the last message
+}
+
+// Metric deduplicator data structure
+type metricDeduplicator struct {
+	rules      []metricDeduplicatorConfig
+	heartbeats []time.Duration // Parsed heartbeats of the rules
+	matcher    *ruleMatcher
+	series     seriesMap[metricDeduplicatorSeries]
+}
+
+// MetricDeduplicator suppresses messages with values unchanged since the last forwarded
+// message of the same series. It is not safe for concurrent use.
+type MetricDeduplicator interface {
+	Forward(m lp.CCMessage) bool
+	Tick(now time.Time)
+}
+
+// parseHeartbeat parses the optional heartbeat of a rule
+func parseHeartbeat(heartbeat string) (time.Duration, error) {
+	if len(heartbeat) == 0 {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(heartbeat)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("must not be negative")
+	}
+	return d, nil
+}
+
+// checkDeduplicate checks the deduplication rules and compiles their conditions
+func checkDeduplicate(rules []metricDeduplicatorConfig) []error {
+	errs := make([]error, 0)
+	for i, r := range rules {
+		for j, name := range r.Metrics {
+			if len(name) == 0 {
+				errs = append(errs, fmt.Errorf("deduplicate[%d].metrics[%d]: empty metric name", i, j))
+			}
+		}
+		if r.AbsTolerance < 0 || math.IsNaN(r.AbsTolerance) {
+			errs = append(errs, fmt.Errorf("deduplicate[%d].abs_tolerance: must not be negative", i))
+		}
+		if r.RelTolerance < 0 || math.IsNaN(r.RelTolerance) {
+			errs = append(errs, fmt.Errorf("deduplicate[%d].rel_tolerance: must not be negative", i))
+		}
+		if _, err := parseHeartbeat(r.Heartbeat); err != nil {
+			errs = append(errs, fmt.Errorf("deduplicate[%d].heartbeat: %v", i, err))
+		}
+		if err := checkRuleCondition(fmt.Sprintf("deduplicate[%d].if", i), r.Condition); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// unchanged checks whether a value equals the last forwarded value within the tolerances
+// of the rule. Non-numeric values have to be equal.
+func (r *metricDeduplicatorConfig) unchanged(last, value interface{}) bool {
+	l, lok := toFloat64(last)
+	v, vok := toFloat64(value)
+	if !lok || !vok {
+		return reflect.DeepEqual(last, value)
+	}
+	diff := math.Abs(v - l)
+	return diff == 0 || diff <= r.AbsTolerance || diff <= r.RelTolerance*math.Abs(l)
+}
+
+// Forward checks whether a message should be forwarded. Messages without value and
+// messages not matching any rule are always forwarded.
+func (d *metricDeduplicator) Forward(m lp.CCMessage) bool {
+	if len(d.rules) == 0 {
+		return true
+	}
+	i := d.matcher.match(m)
+	if i < 0 {
+		return true
+	}
+	r := &d.rules[i]
+	value, ok := m.GetField("value")
+	if !ok {
+		return true
+	}
+
+	t := m.Time()
+	s, ok := d.series.lookup(m)
+	s.state.heartbeat = d.heartbeats[i]
+	if !ok {
+		s.state.value = value
+		s.state.forwarded = t
+		return true
+	}
+	s.observe(t)
+	if r.unchanged(s.state.value, value) && (s.state.heartbeat == 0 || t.Sub(s.state.forwarded) < s.state.heartbeat) {
+		return false
+	}
+	s.state.value = value
+	s.state.forwarded = t
+	return true
+}
+
+// Tick removes the state of series without messages for their expiry time. The state
+// is kept at least for the heartbeat of the series.
+func (d *metricDeduplicator) Tick(now time.Time) {
+	d.series.expire(now, func(s *metricDeduplicatorSeries) time.Duration {
+		return s.heartbeat
+	})
+}
+
+// newDeduplicator creates a new metric deduplicator with the given rules
+func newDeduplicator(rules []metricDeduplicatorConfig) MetricDeduplicator {
+	d := &metricDeduplicator{
+		rules:      rules,
+		heartbeats: make([]time.Duration, len(rules)),
+		matcher:    newRuleMatcher("deduplicate"),
+		series:     make(seriesMap[metricDeduplicatorSeries]),
+	}
+	for i, r := range rules {
+		// The rules are checked before
+		d.heartbeats[i], _ = parseHeartbeat(r.Heartbeat)
+		d.matcher.add(r.Metrics, r.Condition)
+	}
+	return d
+}
@@ -0,0 +1,144 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package metricRouter
+
+import (
+	"testing"
+	"time"
+
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/clock"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testMetric creates a metric of the node 'n1' or fails the test
+func testMetric(t *testing.T, name string, value interface{}, ts time.Time) lp.CCMessage {
+	t.Helper()
+	m, err := lp.NewMetric(name, map[string]string{"type": "node", "hostname": "n1"}, map[string]string{"unit": "bytes"}, value, ts)
+	if err != nil || m == nil {
+		t.Fatalf("cannot create metric %s: %v", name, err)
+	}
+	return m
+}
+
+func TestCheckDeduplicate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  metricDeduplicatorConfig
+		valid bool
+	}{
+		{"metrics", metricDeduplicatorConfig{Metrics: []string{"mem_total"}}, true},
+		{"condition", metricDeduplicatorConfig{Condition: "name == 'mem_total'", Heartbeat: "10m"}, true},
+		{"empty metric name", metricDeduplicatorConfig{Metrics: []string{""}}, false},
+		{"negative tolerance", metricDeduplicatorConfig{AbsTolerance: -1}, false},
+		{"heartbeat without unit", metricDeduplicatorConfig{Heartbeat: "60"}, false},
+		{"negative heartbeat", metricDeduplicatorConfig{Heartbeat: "-1m"}, false},
+		{"invalid condition", metricDeduplicatorConfig{Condition: "name =="}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := checkDeduplicate([]metricDeduplicatorConfig{tt.rule})
+			if valid := len(errs) == 0; valid != tt.valid {
+				t.Errorf("checkDeduplicate() = %v, want valid %v", errs, tt.valid)
+			}
+		})
+	}
+}
+
+func TestDeduplicateTolerance(t *testing.T) {
+	d := newDeduplicator([]metricDeduplicatorConfig{
+		{Metrics: []string{"abs"}, AbsTolerance: 5},
+		{Metrics: []string{"rel"}, RelTolerance: 0.1},
+		{Condition: "name == 'state'"},
+	})
+	tests := []struct {
+		name    string
+		value   interface{}
+		forward bool
+	}{
+		{"abs", 100, true},
+		{"abs", 104, false},
+		{"abs", 95.5, false},
+		{"abs", 106, true},
+		{"rel", 100.0, true},
+		{"rel", 109.0, false},
+		{"rel", 111.0, true},
+		{"state", "P0", true},
+		{"state", "P0", false},
+		{"state", "P2", true},
+		{"other", 1, true},
+		{"other", 1, true},
+	}
+	ts := testStart
+	for i, tt := range tests {
+		ts = ts.Add(10 * time.Second)
+		if forward := d.Forward(testMetric(t, tt.name, tt.value, ts)); forward != tt.forward {
+			t.Errorf("message %d (%s=%v): Forward() = %v, want %v", i, tt.name, tt.value, forward, tt.forward)
+		}
+	}
+}
+
+func TestDeduplicateHeartbeat(t *testing.T) {
+	clk := clock.NewFake(testStart)
+	d := newDeduplicator([]metricDeduplicatorConfig{{Metrics: []string{"mem_total"}, Heartbeat: "35s"}})
+	forwarded := make([]time.Duration, 0)
+	for i := 0; i < 10; i++ {
+		if d.Forward(testMetric(t, "mem_total", 1024, clk.Now())) {
+			forwarded = append(forwarded, clk.Since(testStart))
+		}
+		clk.Advance(10 * time.Second)
+	}
+	want := []time.Duration{0, 40 * time.Second, 80 * time.Second}
+	if len(forwarded) != len(want) {
+		t.Fatalf("forwarded at %v, want %v", forwarded, want)
+	}
+	for i := range want {
+		if forwarded[i] != want[i] {
+			t.Errorf("forwarded at %v, want %v", forwarded, want)
+		}
+	}
+}
+
+func TestDeduplicateExpiry(t *testing.T) {
+	clk := clock.NewFake(testStart)
+	d := newDeduplicator([]metricDeduplicatorConfig{
+		{Metrics: []string{"slow"}},
+		{Metrics: []string{"heartbeat"}, Heartbeat: "1h"},
+	}).(*metricDeduplicator)
+
+	// A series read every 5 minutes by a collector with a long interval, the router
+	// ticks every 10 seconds
+	for i := 0; i < 2; i++ {
+		d.Forward(testMetric(t, "slow", 1, clk.Now()))
+		d.Forward(testMetric(t, "heartbeat", 1, clk.Now()))
+		clk.Advance(5 * time.Minute)
+	}
+	for clk.Since(testStart) < 50*time.Minute {
+		d.Tick(clk.Now())
+		clk.Advance(10 * time.Second)
+	}
+	if len(d.series) != 2 {
+		t.Fatalf("%d series left after 45 minutes, want both series kept for 10 periods of 5 minutes", len(d.series))
+	}
+
+	// 10 periods after the last message, only the series with the longer heartbeat is kept
+	clk.Set(testStart.Add(5*time.Minute + 50*time.Minute + time.Second))
+	d.Tick(clk.Now())
+	if len(d.series) != 1 {
+		t.Fatalf("%d series left, want only the series kept for its heartbeat", len(d.series))
+	}
+	if !d.Forward(testMetric(t, "slow", 1, clk.Now())) {
+		t.Errorf("unchanged value of an expired series suppressed")
+	}
+	clk.Set(testStart.Add(5*time.Minute + time.Hour + time.Second))
+	d.Tick(clk.Now())
+	if _, ok := d.series[seriesKey(testMetric(t, "heartbeat", 1, clk.Now()))]; ok {
+		t.Errorf("series kept longer than its heartbeat")
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package metricRouter
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	cclog "github.com/ClusterCockpit/cc-lib/ccLogger"
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+)
+
+// Default suffixes of the names of the derived metrics
+const (
+	DERIVE_RATE_SUFFIX  = "_rate"
+	DERIVE_DELTA_SUFFIX = "_delta"
+)
+
+// Metric deriver rule configuration
+type metricDeriverConfig struct {
+	Metrics     []string `json:"metrics,omitempty"`      // Names of the counter metrics the rule applies to
+	Condition   string   `json:"if,omitempty"`           // Condition selecting the counter metrics the rule applies to
+	Rate        bool     `json:"rate,omitempty"`         // Send the change of the counter per second
+	Delta       bool     `json:"delta,omitempty"`        // Send the change of the counter
+	RateSuffix  string   `json:"rate_suffix,omitempty"`  // Suffix of the name of the rate metric (default '_rate')
+	DeltaSuffix string   `json:"delta_suffix,omitempty"` // Suffix of the name of the delta metric (default '_delta')
+	RateUnit    string   `json:"rate_unit,omitempty"`    // Unit of the rate metric (default: unit of the counter + '/s')
+	CounterMax  float64  `json:"counter_max,omitempty"`  // Maximal value of the counter before it wraps to zero (0 = no wrap)
+	DropCounter bool     `json:"drop_counter,omitempty"` // Do not forward the counter metric itself
+}
+
+// Previous value of a counter series. Its time is the time of the last message of the series.
+type metricDeriverSeries struct {
+	value float64 // Previous value of the counter
+}
+
+// Metric deriver data structure
+type metricDeriver struct {
+	rules   []metricDeriverConfig
+	matcher *ruleMatcher
+	series  seriesMap[metricDeriverSeries]
+}
+
+// MetricDeriver converts counter metrics to rate and delta metrics. It is not
+// safe for concurrent use.
+type MetricDeriver interface {
+	Derive(m lp.CCMessage) (bool, []lp.CCMessage)
+	Tick(now time.Time)
+}
+
+// checkDerive checks the counter conversion rules and compiles their conditions
+func checkDerive(rules []metricDeriverConfig) []error {
+	errs := make([]error, 0)
+	for i, r := range rules {
+		for j, name := range r.Metrics {
+			if len(name) == 0 {
+				errs = append(errs, fmt.Errorf("derive_counters[%d].metrics[%d]: empty metric name", i, j))
+			}
+		}
+		if !r.Rate && !r.Delta {
+			errs = append(errs, fmt.Errorf("derive_counters[%d]: requires 'rate' or 'delta'", i))
+		}
+		if r.Rate && r.Delta && r.rateSuffix() == r.deltaSuffix() {
+			errs = append(errs, fmt.Errorf("derive_counters[%d]: rate and delta metrics need different suffixes", i))
+		}
+		if r.CounterMax < 0 || math.IsNaN(r.CounterMax) {
+			errs = append(errs, fmt.Errorf("derive_counters[%d].counter_max: must not be negative", i))
+		}
+		if err := checkRuleCondition(fmt.Sprintf("derive_counters[%d].if", i), r.Condition); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// rateSuffix returns the suffix of the name of the rate metric
+func (r *metricDeriverConfig) rateSuffix() string {
+	if len(r.RateSuffix) > 0 {
+		return r.RateSuffix
+	}
+	return DERIVE_RATE_SUFFIX
+}
+
+// deltaSuffix returns the suffix of the name of the delta metric
+func (r *metricDeriverConfig) deltaSuffix() string {
+	if len(r.DeltaSuffix) > 0 {
+		return r.DeltaSuffix
+	}
+	return DERIVE_DELTA_SUFFIX
+}
+
+// delta returns the change of a counter. A decrease is a wrap if the counter has a
+// maximal value and the wrapped change is less than half of the counter range,
+// otherwise the counter was reset and no change is returned.
+func (r *metricDeriverConfig) delta(previous, value float64) (float64, bool) {
+	d := value - previous
+	if d >= 0 {
+		return d, true
+	}
+	if r.CounterMax > 0 && previous <= r.CounterMax {
+		wrapped := r.CounterMax - previous + value + 1
+		if wrapped < r.CounterMax/2 {
+			return wrapped, true
+		}
+	}
+	return 0, false
+}
+
+// newDerived creates a derived metric with the tags and meta information of the counter
+func newDerived(m lp.CCMessage, name string, unit string, value float64) lp.CCMessage {
+	tags := make(map[string]string)
+	for k, v := range m.Tags() {
+		tags[k] = v
+	}
+	meta := make(map[string]string)
+	for k, v := range m.Meta() {
+		meta[k] = v
+	}
+	if len(unit) > 0 {
+		meta["unit"] = unit
+	}
+	d, err := lp.NewMessage(name, tags, meta, map[string]interface{}{"value": value}, m.Time())
+	if err != nil {
+		cclog.ComponentError("MetricRouter", "derive_counters:", err.Error())
+		return nil
+	}
+	return d
+}
+
+// Derive returns whether the counter metric should be forwarded and the derived rate and
+// delta metrics. No metrics are derived from the first value of a counter series, after
+// a counter reset and if the time did not advance.
+func (d *metricDeriver) Derive(m lp.CCMessage) (bool, []lp.CCMessage) {
+	if len(d.rules) == 0 {
+		return true, nil
+	}
+	i := d.matcher.match(m)
+	if i < 0 {
+		return true, nil
+	}
+	r := &d.rules[i]
+	v, ok := m.GetField("value")
+	if !ok {
+		return true, nil
+	}
+	value, ok := toFloat64(v)
+	if !ok {
+		return true, nil
+	}
+
+	s, ok := d.series.lookup(m)
+	if !ok {
+		s.state.value = value
+		return !r.DropCounter, nil
+	}
+	seconds := m.Time().Sub(s.seen).Seconds()
+	if seconds <= 0 {
+		// Keep the older value to derive from the next message
+		return !r.DropCounter, nil
+	}
+	previous := s.state.value
+	s.observe(m.Time())
+	s.state.value = value
+	delta, ok := r.delta(previous, value)
+	if !ok {
+		cclog.ComponentDebug("MetricRouter", "derive_counters: counter reset of", seriesKey(m))
+		return !r.DropCounter, nil
+	}
+
+	unit, hasUnit := m.GetMeta("unit")
+	derived := make([]lp.CCMessage, 0, 2)
+	if r.Rate {
+		rateUnit := r.RateUnit
+		if len(rateUnit) == 0 && hasUnit && len(unit) > 0 {
+			rateUnit = unit + "/s"
+		}
+		if n := newDerived(m, m.Name()+r.rateSuffix(), rateUnit, delta/seconds); n != nil {
+			derived = append(derived, n)
+		}
+	}
+	if r.Delta {
+		if n := newDerived(m, m.Name()+r.deltaSuffix(), "", delta); n != nil {
+			derived = append(derived, n)
+		}
+	}
+	return !r.DropCounter, derived
+}
+
+// Tick removes the previous values of counters without messages for their expiry time
+func (d *metricDeriver) Tick(now time.Time) {
+	d.series.expire(now, nil)
+}
+
+// newDeriver creates a new metric deriver with the given rules
+func newDeriver(rules []metricDeriverConfig) MetricDeriver {
+	d := &metricDeriver{
+		rules:   rules,
+		matcher: newRuleMatcher("derive_counters"),
+		series:  make(seriesMap[metricDeriverSeries]),
+	}
+	for _, r := range rules {
+		d.matcher.add(r.Metrics, r.Condition)
+	}
+	return d
+}
@@ -0,0 +1,131 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package metricRouter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/clock"
+)
+
+func TestCheckDerive(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  metricDeriverConfig
+		valid bool
+	}{
+		{"rate", metricDeriverConfig{Metrics: []string{"net_bytes_in"}, Rate: true}, true},
+		{"rate and delta", metricDeriverConfig{Condition: "name == 'net_bytes_in'", Rate: true, Delta: true}, true},
+		{"nothing to derive", metricDeriverConfig{Metrics: []string{"net_bytes_in"}}, false},
+		{"same suffixes", metricDeriverConfig{Rate: true, Delta: true, RateSuffix: "_d", DeltaSuffix: "_d"}, false},
+		{"negative counter_max", metricDeriverConfig{Rate: true, CounterMax: -1}, false},
+		{"invalid condition", metricDeriverConfig{Rate: true, Condition: "name =="}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := checkDerive([]metricDeriverConfig{tt.rule})
+			if valid := len(errs) == 0; valid != tt.valid {
+				t.Errorf("checkDerive() = %v, want valid %v", errs, tt.valid)
+			}
+		})
+	}
+}
+
+func TestDeriveRateAndDelta(t *testing.T) {
+	clk := clock.NewFake(testStart)
+	d := newDeriver([]metricDeriverConfig{
+		{Metrics: []string{"bytes"}, Rate: true, Delta: true, CounterMax: 1000, DropCounter: true},
+	})
+	tests := []struct {
+		advance time.Duration
+		value   float64
+		rate    float64 // -1 = no derived metrics
+		delta   float64
+	}{
+		{0, 100, -1, 0},
+		{10 * time.Second, 300, 20, 200},
+		{0, 400, -1, 0},                     // time did not advance
+		{10 * time.Second, 900, 60, 600},    // derived from the older value
+		{10 * time.Second, 99, 20, 200},     // wrapped at counter_max
+		{10 * time.Second, 50, -1, 0},       // reset, the change would be more than half of the range
+		{20 * time.Second, 250, 10, 200},    // derived from the value after the reset
+		{10 * time.Second, 250.5, 0.05, .5}, // fractional values
+	}
+	for i, tt := range tests {
+		clk.Advance(tt.advance)
+		forward, derived := d.Derive(testMetric(t, "bytes", tt.value, clk.Now()))
+		if forward {
+			t.Errorf("message %d: counter forwarded despite drop_counter", i)
+		}
+		if tt.rate < 0 {
+			if len(derived) != 0 {
+				t.Errorf("message %d: derived %v, want nothing", i, derived)
+			}
+			continue
+		}
+		if len(derived) != 2 {
+			t.Fatalf("message %d: derived %v, want rate and delta", i, derived)
+		}
+		want := map[string]float64{"bytes_rate": tt.rate, "bytes_delta": tt.delta}
+		for _, m := range derived {
+			value, _ := m.GetField("value")
+			if v, ok := value.(float64); !ok || v != want[m.Name()] {
+				t.Errorf("message %d: %s = %v, want %v", i, m.Name(), value, want[m.Name()])
+			}
+			if !m.Time().Equal(clk.Now()) || m.Tags()["hostname"] != "n1" {
+				t.Errorf("message %d: %s has time %v and tags %v, want those of the counter", i, m.Name(), m.Time(), m.Tags())
+			}
+		}
+	}
+}
+
+func TestDeriveUnit(t *testing.T) {
+	d := newDeriver([]metricDeriverConfig{{Condition: "name == 'bytes'", Rate: true}})
+	if forward, derived := d.Derive(testMetric(t, "other", 1, testStart)); !forward || len(derived) != 0 {
+		t.Errorf("metric not matching any rule: forward %v, derived %v", forward, derived)
+	}
+	d.Derive(testMetric(t, "bytes", 1, testStart))
+	forward, derived := d.Derive(testMetric(t, "bytes", 2, testStart.Add(time.Second)))
+	if !forward || len(derived) != 1 {
+		t.Fatalf("forward %v, derived %v, want the counter and its rate", forward, derived)
+	}
+	if unit, _ := derived[0].GetMeta("unit"); unit != "bytes/s" {
+		t.Errorf("unit of the rate %q, want bytes/s", unit)
+	}
+}
+
+func TestDeriveExpiry(t *testing.T) {
+	clk := clock.NewFake(testStart)
+	d := newDeriver([]metricDeriverConfig{{Metrics: []string{"bytes", "once"}, Delta: true}}).(*metricDeriver)
+
+	// A counter read every 5 minutes, the router ticks every 10 seconds
+	d.Derive(testMetric(t, "once", 1, clk.Now()))
+	d.Derive(testMetric(t, "bytes", 1, clk.Now()))
+	clk.Advance(5 * time.Minute)
+	d.Derive(testMetric(t, "bytes", 2, clk.Now()))
+	for clk.Since(testStart) < 55*time.Minute {
+		clk.Advance(10 * time.Second)
+		d.Tick(clk.Now())
+	}
+	if len(d.series) != 2 {
+		t.Fatalf("%d series left after 50 minutes, want the slow counter kept for 10 periods of 5 minutes", len(d.series))
+	}
+
+	// The previous value is removed after 10 periods, a value without period after an hour
+	clk.Advance(time.Second)
+	d.Tick(clk.Now())
+	if _, derived := d.Derive(testMetric(t, "bytes", 3, clk.Now())); len(derived) != 0 {
+		t.Errorf("delta derived from an expired previous value")
+	}
+	clk.Set(testStart.Add(time.Hour + time.Second))
+	d.Tick(clk.Now())
+	if _, ok := d.series[seriesKey(testMetric(t, "once", 1, clk.Now()))]; ok {
+		t.Errorf("previous value without period kept longer than an hour")
+	}
+}
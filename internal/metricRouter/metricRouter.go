@@ -8,23 +8,39 @@
 package metricRouter
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	cclog "github.com/ClusterCockpit/cc-lib/ccLogger"
 
 	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
 	mp "github.com/ClusterCockpit/cc-lib/messageProcessor"
+	jt "github.com/ClusterCockpit/cc-metric-collector/internal/jobTagger"
 	agg "github.com/ClusterCockpit/cc-metric-collector/internal/metricAggregator"
+	bp "github.com/ClusterCockpit/cc-metric-collector/pkg/backPressure"
 	mct "github.com/ClusterCockpit/cc-metric-collector/pkg/multiChanTicker"
 )
 
 const ROUTER_MAX_FORWARD = 50
 
+// Maximal time to wait for the router goroutine to take over a reloaded configuration
+const ROUTER_RELOAD_TIMEOUT = 10 * time.Second
+
+// Names of the router inputs used for the message counters
+const (
+	ROUTER_INPUT_COLLECTORS = "collectors"
+	ROUTER_INPUT_RECEIVERS  = "receivers"
+	ROUTER_INPUT_CACHE      = "cache"
+)
+
 // Metric router tag configuration
 type metricRouterTagConfig struct {
 	Key       string `json:"key"`   // Tag name
@@ -47,25 +63,69 @@ type metricRouterConfig struct {
 	NormalizeUnits    bool                                 `json:"normalize_units"`     // Check unit meta flag and normalize it using cc-units
 	ChangeUnitPrefix  map[string]string                    `json:"change_unit_prefix"`  // Add prefix that should be applied to the metrics
 	// dropMetrics       map[string]bool                      // Internal map for O(1) lookup
-	MessageProcessor json.RawMessage `json:"process_messages,omitempty"`
+	MessageProcessor json.RawMessage            `json:"process_messages,omitempty"`
+	Outputs          []metricRouterOutputConfig `json:"outputs,omitempty"`         // Conditional routing of the messages to the sinks
+	Deduplicate      []metricDeduplicatorConfig `json:"deduplicate,omitempty"`     // Rules for suppressing messages with unchanged values
+	DeriveCounters   []metricDeriverConfig      `json:"derive_counters,omitempty"` // Rules for converting counters to rates and deltas
+	JobTags          json.RawMessage            `json:"job_tags,omitempty"`        // Tagging of metrics with the Slurm jobs using the hardware
 }
 
 // Metric router data structure
 type metricRouter struct {
-	hostname    string              // Hostname used in tags
-	coll_input  chan lp.CCMessage   // Input channel from CollectorManager
-	recv_input  chan lp.CCMessage   // Input channel from ReceiveManager
-	cache_input chan lp.CCMessage   // Input channel from MetricCache
-	outputs     []chan lp.CCMessage // List of all output channels
-	done        chan bool           // channel to finish / stop metric router
-	wg          *sync.WaitGroup     // wait group for all goroutines in cc-metric-collector
-	timestamp   time.Time           // timestamp periodically updated by ticker each interval
-	ticker      mct.MultiChanTicker // periodically ticking once each interval
-	config      metricRouterConfig  // json encoded config for metric router
-	cache       MetricCache         // pointer to MetricCache
-	cachewg     sync.WaitGroup      // wait group for MetricCache
-	maxForward  int                 // number of metrics to forward maximally in one iteration
+	hostname    string                   // Hostname used in tags
+	coll_input  chan lp.CCMessage        // Input channel from CollectorManager
+	recv_input  chan lp.CCMessage        // Input channel from ReceiveManager
+	cache_input chan lp.CCMessage        // Input channel from MetricCache
+	outputs     []chan lp.CCMessage      // List of all output channels
+	senders     []bp.Sender              // Senders applying the back-pressure policy of the output channels
+	sinkOutputs []metricRouterSinkOutput // Output channels to single sinks, selected by the configured outputs
+	sinkIndex   map[string]int           // Index of the sink outputs by sink name
+	warned      map[string]bool          // Outputs whose condition failed to evaluate
+	outChannel  string                   // Name of the output channels for the drop counters
+	outPolicy   string                   // Back-pressure policy of the output channels
+	done        chan bool                // channel to finish / stop metric router
+	stopped     chan bool                // closed when the router goroutine finished
+	wg          *sync.WaitGroup          // wait group for all goroutines in cc-metric-collector
+	timestamp   time.Time                // timestamp periodically updated by ticker each interval
+	ticker      mct.MultiChanTicker      // periodically ticking once each interval
+	config      metricRouterConfig       // json encoded config for metric router
+	cache       MetricCache              // pointer to MetricCache
+	cachewg     sync.WaitGroup           // wait group for MetricCache
+	maxForward  int                      // number of metrics to forward maximally in one iteration
 	mp          mp.MessageProcessor
+	dedup       MetricDeduplicator                    // suppresses messages with unchanged values
+	deriver     MetricDeriver                         // converts counters to rates and deltas
+	jobTagger   jt.JobTagger                          // adds the job ID and user tags, nil if not configured
+	reload      chan metricRouterReload               // channel to hand over a reloaded configuration to the router goroutine
+	stats       map[string]*metricRouterInputCounters // message counters per input
+	flush       chan chan bool                        // channel to request forwarding all pending messages
+}
+
+// Message counters of a router input
+type MetricRouterInputStats struct {
+	Received   uint64 `json:"received"`   // Number of messages received
+	Forwarded  uint64 `json:"forwarded"`  // Number of messages forwarded to the outputs
+	Dropped    uint64 `json:"dropped"`    // Number of messages dropped by the message processor
+	Suppressed uint64 `json:"suppressed"` // Number of messages with unchanged values not forwarded
+	Derived    uint64 `json:"derived"`    // Number of rate and delta messages derived from counters
+}
+
+// Internal message counters of a router input, updated by the router goroutine
+type metricRouterInputCounters struct {
+	received   atomic.Uint64
+	forwarded  atomic.Uint64
+	dropped    atomic.Uint64
+	suppressed atomic.Uint64
+	derived    atomic.Uint64
+}
+
+// Reloaded configuration and message processor applied by the router goroutine
+type metricRouterReload struct {
+	config  metricRouterConfig
+	mp      mp.MessageProcessor
+	dedup   MetricDeduplicator // nil if the deduplication rules are unchanged
+	deriver MetricDeriver      // nil if the counter conversion rules are unchanged
+	applied chan bool          // closed by the router goroutine after applying the configuration
 }
 
 // MetricRouter access functions
@@ -74,7 +134,13 @@ type MetricRouter interface {
 	AddCollectorInput(input chan lp.CCMessage)
 	AddReceiverInput(input chan lp.CCMessage)
 	AddOutput(output chan lp.CCMessage)
+	AddSinkOutput(sink string, output chan lp.CCMessage)
+	SetOutputPolicy(channel string, policy string) error
 	Start()
+	Reload(routerConfig json.RawMessage) error
+	Stats() map[string]MetricRouterInputStats
+	AggregationDuration() time.Duration
+	Flush()
 	Close()
 }
 
@@ -86,8 +152,20 @@ type MetricRouter interface {
 // * configuration (read from config file in variable routerConfigFile)
 func (r *metricRouter) Init(ticker mct.MultiChanTicker, wg *sync.WaitGroup, routerConfig json.RawMessage) error {
 	r.outputs = make([]chan lp.CCMessage, 0)
+	r.senders = make([]bp.Sender, 0)
+	r.sinkOutputs = make([]metricRouterSinkOutput, 0)
+	r.sinkIndex = make(map[string]int)
+	r.warned = make(map[string]bool)
 	r.done = make(chan bool)
+	r.stopped = make(chan bool)
+	r.reload = make(chan metricRouterReload)
+	r.flush = make(chan chan bool)
 	r.cache_input = make(chan lp.CCMessage)
+	r.stats = map[string]*metricRouterInputCounters{
+		ROUTER_INPUT_COLLECTORS: new(metricRouterInputCounters),
+		ROUTER_INPUT_RECEIVERS:  new(metricRouterInputCounters),
+		ROUTER_INPUT_CACHE:      new(metricRouterInputCounters),
+	}
 	r.wg = wg
 	r.ticker = ticker
 	r.config.MaxForward = ROUTER_MAX_FORWARD
@@ -107,6 +185,27 @@ func (r *metricRouter) Init(ticker mct.MultiChanTicker, wg *sync.WaitGroup, rout
 		cclog.ComponentError("MetricRouter", err.Error())
 		return err
 	}
+	if errs := checkOutputs(r.config.Outputs); len(errs) > 0 {
+		cclog.ComponentError("MetricRouter", errs[0].Error())
+		return errs[0]
+	}
+	if errs := checkDeduplicate(r.config.Deduplicate); len(errs) > 0 {
+		cclog.ComponentError("MetricRouter", errs[0].Error())
+		return errs[0]
+	}
+	r.dedup = newDeduplicator(r.config.Deduplicate)
+	if errs := checkDerive(r.config.DeriveCounters); len(errs) > 0 {
+		cclog.ComponentError("MetricRouter", errs[0].Error())
+		return errs[0]
+	}
+	r.deriver = newDeriver(r.config.DeriveCounters)
+	if len(r.config.JobTags) > 0 {
+		r.jobTagger, err = jt.NewWithClock(r.wg, r.ticker.Clock(), r.config.JobTags)
+		if err != nil {
+			cclog.ComponentError("MetricRouter", "job_tags:", err.Error())
+			return err
+		}
+	}
 	r.maxForward = 1
 	if r.config.MaxForward > r.maxForward {
 		r.maxForward = r.config.MaxForward
@@ -121,53 +220,181 @@ func (r *metricRouter) Init(ticker mct.MultiChanTicker, wg *sync.WaitGroup, rout
 			r.cache.AddAggregation(agg.Name, agg.Function, agg.Condition, agg.Tags, agg.Meta)
 		}
 	}
+	r.mp, err = newMessageProcessor(&r.config, r.hostname)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// newMessageProcessor creates a message processor containing the processing rules
+// of the router configuration (including the deprecated options)
+func newMessageProcessor(config *metricRouterConfig, hostname string) (mp.MessageProcessor, error) {
 	p, err := mp.NewMessageProcessor()
 	if err != nil {
-		return fmt.Errorf("initialization of message processor failed: %v", err.Error())
+		return nil, fmt.Errorf("initialization of message processor failed: %v", err.Error())
 	}
-	r.mp = p
 
-	if len(r.config.MessageProcessor) > 0 {
-		err = r.mp.FromConfigJSON(r.config.MessageProcessor)
+	if len(config.MessageProcessor) > 0 {
+		err = p.FromConfigJSON(config.MessageProcessor)
 		if err != nil {
-			return fmt.Errorf("failed parsing JSON for message processor: %v", err.Error())
+			return nil, fmt.Errorf("failed parsing JSON for message processor: %v", err.Error())
 		}
 	}
-	for _, mname := range r.config.DropMetrics {
-		r.mp.AddDropMessagesByName(mname)
+	for _, mname := range config.DropMetrics {
+		p.AddDropMessagesByName(mname)
 	}
-	for _, cond := range r.config.DropMetricsIf {
-		r.mp.AddDropMessagesByCondition(cond)
+	for _, cond := range config.DropMetricsIf {
+		p.AddDropMessagesByCondition(cond)
 	}
-	for _, data := range r.config.AddTags {
+	for _, data := range config.AddTags {
 		cond := data.Condition
 		if cond == "*" {
 			cond = "true"
 		}
-		r.mp.AddAddTagsByCondition(cond, data.Key, data.Value)
+		p.AddAddTagsByCondition(cond, data.Key, data.Value)
 	}
-	for _, data := range r.config.DelTags {
+	for _, data := range config.DelTags {
 		cond := data.Condition
 		if cond == "*" {
 			cond = "true"
 		}
-		r.mp.AddDeleteTagsByCondition(cond, data.Key, data.Value)
+		p.AddDeleteTagsByCondition(cond, data.Key, data.Value)
 	}
-	for oldname, newname := range r.config.RenameMetrics {
-		r.mp.AddRenameMetricByName(oldname, newname)
+	for oldname, newname := range config.RenameMetrics {
+		p.AddRenameMetricByName(oldname, newname)
 	}
-	for metricName, prefix := range r.config.ChangeUnitPrefix {
-		r.mp.AddChangeUnitPrefix(fmt.Sprintf("name == '%s'", metricName), prefix)
+	for metricName, prefix := range config.ChangeUnitPrefix {
+		p.AddChangeUnitPrefix(fmt.Sprintf("name == '%s'", metricName), prefix)
 	}
-	r.mp.SetNormalizeUnits(r.config.NormalizeUnits)
+	p.SetNormalizeUnits(config.NormalizeUnits)
 
-	r.mp.AddAddTagsByCondition("true", r.config.HostnameTagName, r.hostname)
+	p.AddAddTagsByCondition("true", config.HostnameTagName, hostname)
 
-	// r.config.dropMetrics = make(map[string]bool)
-	// for _, mname := range r.config.DropMetrics {
-	// 	r.config.dropMetrics[mname] = true
+	// config.dropMetrics = make(map[string]bool)
+	// for _, mname := range config.DropMetrics {
+	// 	config.dropMetrics[mname] = true
 	// }
-	return nil
+	return p, nil
+}
+
+// Reload applies a new router configuration to the running metric router. The processing
+// rules and interval aggregations are replaced, the metric cache keeps its content.
+// Changes of the cache size and the interval timestamp setting require a restart.
+func (r *metricRouter) Reload(routerConfig json.RawMessage) error {
+	var config metricRouterConfig
+	config.MaxForward = ROUTER_MAX_FORWARD
+	config.HostnameTagName = "hostname"
+	err := json.Unmarshal(routerConfig, &config)
+	if err != nil {
+		cclog.ComponentError("MetricRouter", "Reload:", err.Error())
+		return err
+	}
+	p, err := newMessageProcessor(&config, r.hostname)
+	if err != nil {
+		cclog.ComponentError("MetricRouter", "Reload:", err.Error())
+		return err
+	}
+	if errs := checkOutputs(config.Outputs); len(errs) > 0 {
+		cclog.ComponentError("MetricRouter", "Reload:", errs[0].Error())
+		return errs[0]
+	}
+	if errs := checkDeduplicate(config.Deduplicate); len(errs) > 0 {
+		cclog.ComponentError("MetricRouter", "Reload:", errs[0].Error())
+		return errs[0]
+	}
+	if errs := checkDerive(config.DeriveCounters); len(errs) > 0 {
+		cclog.ComponentError("MetricRouter", "Reload:", errs[0].Error())
+		return errs[0]
+	}
+	if errs := checkAggregations(config.IntervalAgg); len(errs) > 0 {
+		cclog.ComponentError("MetricRouter", "Reload:", errs[0].Error())
+		return errs[0]
+	}
+	if len(r.sinkOutputs) > 0 {
+		for _, s := range outputSinks(config.Outputs) {
+			if _, ok := r.sinkIndex[s]; !ok {
+				err = fmt.Errorf("output to unknown sink '%s', adding sinks requires a restart", s)
+				cclog.ComponentError("MetricRouter", "Reload:", err.Error())
+				return err
+			}
+		}
+	} else if len(config.Outputs) > 0 && len(r.config.Outputs) == 0 {
+		cclog.ComponentError("MetricRouter", "Reload: adding 'outputs' requires a restart")
+		config.Outputs = nil
+	}
+
+	if config.NumCacheIntervals != r.config.NumCacheIntervals {
+		cclog.ComponentError("MetricRouter", "Reload: changing 'num_cache_intervals' requires a restart, keeping", r.config.NumCacheIntervals)
+		config.NumCacheIntervals = r.config.NumCacheIntervals
+	}
+	if config.IntervalStamp && !r.config.IntervalStamp {
+		cclog.ComponentError("MetricRouter", "Reload: enabling 'interval_timestamp' requires a restart")
+		config.IntervalStamp = false
+	}
+	if !bytes.Equal(config.JobTags, r.config.JobTags) {
+		cclog.ComponentError("MetricRouter", "Reload: changing 'job_tags' requires a restart")
+		config.JobTags = r.config.JobTags
+	}
+
+	// Hand over to the router goroutine
+	u := metricRouterReload{
+		config:  config,
+		mp:      p,
+		applied: make(chan bool),
+	}
+	// Keep the state of the series if the deduplication or counter conversion rules are unchanged
+	if !reflect.DeepEqual(config.Deduplicate, r.config.Deduplicate) {
+		u.dedup = newDeduplicator(config.Deduplicate)
+	}
+	if !reflect.DeepEqual(config.DeriveCounters, r.config.DeriveCounters) {
+		u.deriver = newDeriver(config.DeriveCounters)
+	}
+	// The router goroutine may be blocked by a full output channel or already be stopped
+	timer := r.ticker.Clock().NewTimer(ROUTER_RELOAD_TIMEOUT)
+	defer timer.Stop()
+	oldAggs := r.config.IntervalAgg
+	select {
+	case r.reload <- u:
+		<-u.applied
+		// The aggregations are checked, so they are updated only with the configuration
+		if r.config.NumCacheIntervals > 0 {
+			r.updateAggregations(oldAggs, config.IntervalAgg)
+		}
+		return nil
+	case <-r.stopped:
+		err = errors.New("router is stopped")
+	case <-timer.C():
+		err = fmt.Errorf("router did not take over the configuration within %v", ROUTER_RELOAD_TIMEOUT)
+	}
+	cclog.ComponentError("MetricRouter", "Reload:", err.Error())
+	return err
+}
+
+// updateAggregations deletes the removed and changed interval aggregations from the metric
+// cache and adds the added and changed ones
+func (r *metricRouter) updateAggregations(oldConfig, newConfig []agg.MetricAggregatorIntervalConfig) {
+	oldAggs := make(map[string]agg.MetricAggregatorIntervalConfig)
+	for _, a := range oldConfig {
+		oldAggs[a.Name] = a
+	}
+	newAggs := make(map[string]agg.MetricAggregatorIntervalConfig)
+	for _, a := range newConfig {
+		newAggs[a.Name] = a
+	}
+	for name, a := range oldAggs {
+		if n, ok := newAggs[name]; !ok || !reflect.DeepEqual(a, n) {
+			r.cache.DeleteAggregation(name)
+		}
+	}
+	for name, a := range newAggs {
+		if o, ok := oldAggs[name]; !ok || !reflect.DeepEqual(a, o) {
+			err := r.cache.AddAggregation(a.Name, a.Function, a.Condition, a.Tags, a.Meta)
+			if err != nil {
+				cclog.ComponentError("MetricRouter", "Reload: aggregation", name, "failed:", err.Error())
+			}
+		}
+	}
 }
 
 func getParamMap(point lp.CCMessage) map[string]interface{} {
@@ -286,18 +513,61 @@ func (r *metricRouter) DoAddTags(point lp.CCMessage) {
 // 	return true
 // }
 
+// send sends a processed message to all outputs unless it is suppressed by the deduplication
+func (r *metricRouter) send(m lp.CCMessage, counters *metricRouterInputCounters) bool {
+	if !r.dedup.Forward(m) {
+		counters.suppressed.Add(1)
+		return false
+	}
+	for _, s := range r.senders {
+		s.Send(m)
+	}
+	r.route(m)
+	return true
+}
+
+// forward processes a message of an input and forwards it and the rates and deltas derived
+// from it to all outputs. Returns the processed message (even if it was suppressed by the
+// deduplication or replaced by the derived messages) or nil if the message was dropped.
+func (r *metricRouter) forward(p lp.CCMessage, input string) lp.CCMessage {
+	counters := r.stats[input]
+	counters.received.Add(1)
+	// Add the job tags first so that the message processor can use them. Only the
+	// messages of the local collectors are tagged, the receivers relay messages of
+	// other hosts.
+	if r.jobTagger != nil && input == ROUTER_INPUT_COLLECTORS {
+		r.jobTagger.Tag(p)
+	}
+	m, err := r.mp.ProcessMessage(p)
+	if err != nil || m == nil {
+		counters.dropped.Add(1)
+		return nil
+	}
+	keep, derived := r.deriver.Derive(m)
+	if keep && r.send(m, counters) {
+		counters.forwarded.Add(1)
+	}
+	for _, d := range derived {
+		counters.derived.Add(1)
+		r.send(d, counters)
+	}
+	return m
+}
+
 // Start starts the metric router
 func (r *metricRouter) Start() {
-	// start timer if configured
-	r.timestamp = time.Now()
-	timeChan := make(chan time.Time)
-	if r.config.IntervalStamp {
-		r.ticker.AddChannel(timeChan)
+	// start timer for the interval timestamp and the intervals of the deduplication
+	r.timestamp = r.ticker.Clock().Now()
+	timeChan := make(chan mct.Tick)
+	r.ticker.AddTickChannel("router", timeChan)
+	if r.jobTagger != nil {
+		r.jobTagger.Start()
 	}
 
 	// Router manager is done
 	done := func() {
 		close(r.done)
+		close(r.stopped)
 		cclog.ComponentDebug("MetricRouter", "DONE")
 	}
 
@@ -329,21 +599,15 @@ func (r *metricRouter) Start() {
 		if r.config.IntervalStamp {
 			p.SetTime(r.timestamp)
 		}
-		m, err := r.mp.ProcessMessage(p)
-		if err == nil && m != nil {
-			for _, o := range r.outputs {
-				o <- m
-			}
-		}
-		// if !r.dropMetric(p) {
-		// 	for _, o := range r.outputs {
-		// 		o <- point
-		// 	}
-		// }
+		m := r.forward(p, ROUTER_INPUT_COLLECTORS)
 		// even if the metric is dropped, it is stored in the cache for
 		// aggregations
 		if r.config.NumCacheIntervals > 0 {
-			r.cache.Add(m)
+			if m != nil {
+				r.cache.Add(m)
+			} else {
+				r.cache.Add(p)
+			}
 		}
 	}
 
@@ -353,26 +617,13 @@ func (r *metricRouter) Start() {
 		if r.config.IntervalStamp {
 			p.SetTime(r.timestamp)
 		}
-		m, err := r.mp.ProcessMessage(p)
-		if err == nil && m != nil {
-			for _, o := range r.outputs {
-				o <- m
-			}
-		}
-		// if !r.dropMetric(p) {
-		// 	forward(p)
-		// }
+		r.forward(p, ROUTER_INPUT_RECEIVERS)
 	}
 
 	// Forward message received from cache channel
 	cache_forward := func(p lp.CCMessage) {
 		// receive from metric collector
-		m, err := r.mp.ProcessMessage(p)
-		if err == nil && m != nil {
-			for _, o := range r.outputs {
-				o <- m
-			}
-		}
+		r.forward(p, ROUTER_INPUT_CACHE)
 	}
 
 	// Start Metric Cache
@@ -390,10 +641,46 @@ func (r *metricRouter) Start() {
 				done()
 				return
 
-			case timestamp := <-timeChan:
-				r.timestamp = timestamp
+			case tick := <-timeChan:
+				r.timestamp = tick.Time
+				r.dedup.Tick(tick.Time)
+				r.deriver.Tick(tick.Time)
 				cclog.ComponentDebug("MetricRouter", "Update timestamp", r.timestamp.UnixNano())
 
+			case u := <-r.reload:
+				r.config = u.config
+				r.warned = make(map[string]bool)
+				r.mp = u.mp
+				if u.dedup != nil {
+					r.dedup = u.dedup
+				}
+				if u.deriver != nil {
+					r.deriver = u.deriver
+				}
+				r.maxForward = 1
+				if r.config.MaxForward > r.maxForward {
+					r.maxForward = r.config.MaxForward
+				}
+				close(u.applied)
+				cclog.ComponentDebug("MetricRouter", "RELOADED")
+
+			case flushed := <-r.flush:
+				// Forward all messages pending in the input channels
+				for pending := true; pending; {
+					pending = false
+					select {
+					case p := <-r.coll_input:
+						coll_forward(p)
+						pending = true
+					case p := <-r.recv_input:
+						recv_forward(p)
+						pending = true
+					default:
+					}
+				}
+				close(flushed)
+				cclog.ComponentDebug("MetricRouter", "FLUSHED")
+
 			case p := <-r.coll_input:
 				coll_forward(p)
 				for i := 0; len(r.coll_input) > 0 && i < (r.maxForward-1); i++ {
@@ -417,6 +704,39 @@ func (r *metricRouter) Start() {
 	cclog.ComponentDebug("MetricRouter", "STARTED")
 }
 
+// Flush forwards all messages pending in the collector and receiver input channels
+// to the outputs and returns afterwards
+func (r *metricRouter) Flush() {
+	cclog.ComponentDebug("MetricRouter", "FLUSH")
+	flushed := make(chan bool)
+	r.flush <- flushed
+	<-flushed
+}
+
+// Stats returns the message counters of all router inputs
+func (r *metricRouter) Stats() map[string]MetricRouterInputStats {
+	stats := make(map[string]MetricRouterInputStats)
+	for input, c := range r.stats {
+		stats[input] = MetricRouterInputStats{
+			Received:   c.received.Load(),
+			Forwarded:  c.forwarded.Load(),
+			Dropped:    c.dropped.Load(),
+			Suppressed: c.suppressed.Load(),
+			Derived:    c.derived.Load(),
+		}
+	}
+	return stats
+}
+
+// AggregationDuration returns the duration of the last evaluation of the interval
+// aggregations. It is zero if the metric cache is disabled.
+func (r *metricRouter) AggregationDuration() time.Duration {
+	if r.cache == nil {
+		return 0
+	}
+	return r.cache.EvalDuration()
+}
+
 // AddCollectorInput adds a channel between metric collector and metric router
 func (r *metricRouter) AddCollectorInput(input chan lp.CCMessage) {
 	r.coll_input = input
@@ -429,7 +749,39 @@ func (r *metricRouter) AddReceiverInput(input chan lp.CCMessage) {
 
 // AddOutput adds a output channel to the metric router
 func (r *metricRouter) AddOutput(output chan lp.CCMessage) {
+	s, err := bp.NewSender(r.outChannel, output, r.outPolicy)
+	if err != nil {
+		cclog.ComponentError("MetricRouter", err.Error())
+		return
+	}
 	r.outputs = append(r.outputs, output)
+	r.senders = append(r.senders, s)
+}
+
+// SetOutputPolicy sets the back-pressure policy applied if an output channel is full.
+// The dropped messages of all outputs are reported by the name of the channel, those
+// of the sink outputs by the name of the channel and the sink.
+// It has to be called before Start().
+func (r *metricRouter) SetOutputPolicy(channel string, policy string) error {
+	senders := make([]bp.Sender, 0, len(r.outputs))
+	for _, o := range r.outputs {
+		s, err := bp.NewSender(channel, o, policy)
+		if err != nil {
+			return err
+		}
+		senders = append(senders, s)
+	}
+	for i, o := range r.sinkOutputs {
+		s, err := bp.NewSender(sinkChannel(channel, o.sink), o.output, policy)
+		if err != nil {
+			return err
+		}
+		r.sinkOutputs[i].sender = s
+	}
+	r.senders = senders
+	r.outChannel = channel
+	r.outPolicy = policy
+	return nil
 }
 
 // Close finishes / stops the metric router
@@ -439,6 +791,10 @@ func (r *metricRouter) Close() {
 	// wait for close of channel r.done
 	<-r.done
 
+	if r.jobTagger != nil {
+		r.jobTagger.Close()
+	}
+
 	// stop metric cache
 	if r.config.NumCacheIntervals > 0 {
 		cclog.ComponentDebug("MetricRouter", "CACHE CLOSE")
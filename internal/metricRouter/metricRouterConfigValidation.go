@@ -0,0 +1,111 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package metricRouter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	mp "github.com/ClusterCockpit/cc-lib/messageProcessor"
+	jt "github.com/ClusterCockpit/cc-metric-collector/internal/jobTagger"
+	agg "github.com/ClusterCockpit/cc-metric-collector/internal/metricAggregator"
+)
+
+// checkAggregations checks the names of the interval aggregations and compiles their
+// functions and conditions like the metric cache does
+func checkAggregations(aggs []agg.MetricAggregatorIntervalConfig) []error {
+	errs := make([]error, 0)
+	for i, a := range aggs {
+		if len(a.Name) == 0 {
+			errs = append(errs, fmt.Errorf("interval_aggregates[%d].name: empty metric name", i))
+		}
+		if err := agg.CheckAggregation(a.Function, a.Condition); err != nil {
+			errs = append(errs, fmt.Errorf("interval_aggregates[%d]: %v", i, err))
+		}
+	}
+	return errs
+}
+
+// ValidateConfig checks the router configuration without starting the router.
+// Unknown keys are reported and all conditions and aggregation functions are compiled.
+// All errors are returned with the path of the option as context.
+func ValidateConfig(routerConfig json.RawMessage) []error {
+	errs := make([]error, 0)
+	var config metricRouterConfig
+	d := json.NewDecoder(bytes.NewReader(routerConfig))
+	d.DisallowUnknownFields()
+	err := d.Decode(&config)
+	if err != nil {
+		return append(errs, err)
+	}
+
+	checkCondition := func(path, condition string) {
+		if condition == "*" {
+			return
+		}
+		if len(condition) == 0 {
+			errs = append(errs, fmt.Errorf("%s: empty condition", path))
+			return
+		}
+		if err := agg.CheckCondition(condition); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid condition '%s': %v", path, condition, err))
+		}
+	}
+
+	for i, cond := range config.DropMetricsIf {
+		checkCondition(fmt.Sprintf("drop_metrics_if[%d]", i), cond)
+	}
+	for i, t := range config.AddTags {
+		checkCondition(fmt.Sprintf("add_tags[%d].if", i), t.Condition)
+		if len(t.Key) == 0 {
+			errs = append(errs, fmt.Errorf("add_tags[%d].key: empty tag key", i))
+		}
+	}
+	for i, t := range config.DelTags {
+		checkCondition(fmt.Sprintf("delete_tags[%d].if", i), t.Condition)
+		if len(t.Key) == 0 {
+			errs = append(errs, fmt.Errorf("delete_tags[%d].key: empty tag key", i))
+		}
+	}
+	for i, a := range config.IntervalAgg {
+		if len(a.Name) == 0 {
+			errs = append(errs, fmt.Errorf("interval_aggregates[%d].name: empty metric name", i))
+		}
+		checkCondition(fmt.Sprintf("interval_aggregates[%d].if", i), a.Condition)
+		if err := agg.CheckCondition(a.Function); err != nil {
+			errs = append(errs, fmt.Errorf("interval_aggregates[%d].function: invalid function '%s': %v", i, a.Function, err))
+		}
+	}
+	if len(config.IntervalAgg) > 0 && config.NumCacheIntervals <= 0 {
+		errs = append(errs, errors.New("interval_aggregates: requires num_cache_intervals > 0"))
+	}
+	errs = append(errs, checkOutputs(config.Outputs)...)
+	errs = append(errs, checkDeduplicate(config.Deduplicate)...)
+	errs = append(errs, checkDerive(config.DeriveCounters)...)
+	if len(config.JobTags) > 0 {
+		for _, err := range jt.ValidateConfig(config.JobTags) {
+			errs = append(errs, fmt.Errorf("job_tags: %v", err))
+		}
+	}
+	if config.MaxForward < 0 {
+		errs = append(errs, errors.New("max_forward: must be greater than zero"))
+	}
+
+	if len(config.MessageProcessor) > 0 {
+		p, err := mp.NewMessageProcessor()
+		if err != nil {
+			return append(errs, fmt.Errorf("process_messages: %v", err))
+		}
+		if err := p.FromConfigJSON(config.MessageProcessor); err != nil {
+			errs = append(errs, fmt.Errorf("process_messages: %v", err))
+		}
+	}
+	return errs
+}
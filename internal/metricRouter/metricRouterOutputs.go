@@ -0,0 +1,187 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package metricRouter
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	cclog "github.com/ClusterCockpit/cc-lib/ccLogger"
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+	agg "github.com/ClusterCockpit/cc-metric-collector/internal/metricAggregator"
+	bp "github.com/ClusterCockpit/cc-metric-collector/pkg/backPressure"
+)
+
+// Metric router output configuration: all messages matching the condition are sent to the sinks
+type metricRouterOutputConfig struct {
+	Name      string   `json:"name"`         // Name of the output used in log messages
+	Sinks     []string `json:"sinks"`        // Names of the sinks in the sinks configuration
+	Condition string   `json:"if,omitempty"` // Condition for sending a message to the sinks. Empty or '*' matches all messages
+}
+
+// always checks whether the output receives all messages
+func (o *metricRouterOutputConfig) always() bool {
+	return len(o.Condition) == 0 || o.Condition == "*"
+}
+
+// Output channel of the metric router to a single sink
+type metricRouterSinkOutput struct {
+	sink   string            // Name of the sink
+	output chan lp.CCMessage // Channel to the sink
+	sender bp.Sender         // Sender applying the back-pressure policy of the channel
+}
+
+// checkRuleCondition compiles the optional condition of a rule, so invalid conditions
+// are rejected with the configuration instead of never matching
+func checkRuleCondition(path, condition string) error {
+	if len(condition) == 0 || condition == "*" {
+		return nil
+	}
+	if err := agg.CheckCondition(condition); err != nil {
+		return fmt.Errorf("%s: invalid condition '%s': %v", path, condition, err)
+	}
+	return nil
+}
+
+// warnCondition logs an error evaluating the condition of a rule. As the error commonly
+// is a tag or meta information missing in the message, it is logged once per rule.
+func warnCondition(warned map[string]bool, rule, condition string, err error) {
+	if warned[rule] {
+		return
+	}
+	warned[rule] = true
+	cclog.Warn(fmt.Sprintf("[MetricRouter] %s: condition '%s' failed to evaluate and does not match: %v (logged once)", rule, condition, err))
+}
+
+// checkOutputs checks the names, sinks and conditions of the router outputs
+func checkOutputs(outputs []metricRouterOutputConfig) []error {
+	errs := make([]error, 0)
+	names := make(map[string]bool)
+	for i, o := range outputs {
+		if len(o.Name) == 0 {
+			errs = append(errs, fmt.Errorf("outputs[%d].name: empty output name", i))
+		} else if names[o.Name] {
+			errs = append(errs, fmt.Errorf("outputs[%d].name: duplicate output name '%s'", i, o.Name))
+		}
+		names[o.Name] = true
+		if len(o.Sinks) == 0 {
+			errs = append(errs, fmt.Errorf("outputs[%d].sinks: no sinks", i))
+		}
+		for j, s := range o.Sinks {
+			if len(s) == 0 {
+				errs = append(errs, fmt.Errorf("outputs[%d].sinks[%d]: empty sink name", i, j))
+			}
+		}
+		if err := checkRuleCondition(fmt.Sprintf("outputs[%d].if", i), o.Condition); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// outputSinks returns the sorted names of all sinks used by the outputs
+func outputSinks(outputs []metricRouterOutputConfig) []string {
+	set := make(map[string]bool)
+	for _, o := range outputs {
+		for _, s := range o.Sinks {
+			set[s] = true
+		}
+	}
+	sinks := make([]string, 0, len(set))
+	for s := range set {
+		sinks = append(sinks, s)
+	}
+	sort.Strings(sinks)
+	return sinks
+}
+
+// OutputSinks returns the sorted names of all sinks used by the 'outputs' of the router
+// configuration. Without 'outputs', the list is empty and all messages are sent to all sinks.
+func OutputSinks(routerConfig json.RawMessage) ([]string, error) {
+	var config struct {
+		Outputs []metricRouterOutputConfig `json:"outputs"`
+	}
+	err := json.Unmarshal(routerConfig, &config)
+	if err != nil {
+		return nil, err
+	}
+	return outputSinks(config.Outputs), nil
+}
+
+// route sends a processed message to the sink outputs. Without configured outputs, the
+// message is sent to all sinks. Otherwise, it is sent once to each sink of all outputs
+// whose condition matches. A condition failing to evaluate does not match. Messages
+// matching no output are not sent to any sink.
+func (r *metricRouter) route(m lp.CCMessage) {
+	if len(r.sinkOutputs) == 0 {
+		return
+	}
+	if len(r.config.Outputs) == 0 {
+		for _, o := range r.sinkOutputs {
+			o.sender.Send(m)
+		}
+		return
+	}
+
+	var params map[string]interface{}
+	selected := make([]bool, len(r.sinkOutputs))
+	for _, o := range r.config.Outputs {
+		if !o.always() {
+			if params == nil {
+				params = getParamMap(m)
+			}
+			matches, err := agg.EvalBoolCondition(o.Condition, params)
+			if err != nil {
+				warnCondition(r.warned, "output "+o.Name, o.Condition, err)
+				continue
+			}
+			if !matches {
+				continue
+			}
+		}
+		for _, s := range o.Sinks {
+			if i, ok := r.sinkIndex[s]; ok {
+				selected[i] = true
+			}
+		}
+	}
+	for i, o := range r.sinkOutputs {
+		if selected[i] {
+			o.sender.Send(m)
+		}
+	}
+}
+
+// sinkChannel returns the name of the channel to a sink used for the drop counters
+func sinkChannel(channel, sink string) string {
+	if len(channel) == 0 {
+		return ""
+	}
+	return channel + "/" + sink
+}
+
+// AddSinkOutput adds an output channel to a single sink. The messages are sent to the
+// channel according to the 'outputs' of the router configuration.
+func (r *metricRouter) AddSinkOutput(sink string, output chan lp.CCMessage) {
+	if _, ok := r.sinkIndex[sink]; ok {
+		cclog.ComponentError("MetricRouter", "output to sink", sink, "already added")
+		return
+	}
+	s, err := bp.NewSender(sinkChannel(r.outChannel, sink), output, r.outPolicy)
+	if err != nil {
+		cclog.ComponentError("MetricRouter", err.Error())
+		return
+	}
+	r.sinkIndex[sink] = len(r.sinkOutputs)
+	r.sinkOutputs = append(r.sinkOutputs, metricRouterSinkOutput{
+		sink:   sink,
+		output: output,
+		sender: s,
+	})
+}
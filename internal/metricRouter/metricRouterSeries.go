@@ -0,0 +1,171 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package metricRouter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+	agg "github.com/ClusterCockpit/cc-metric-collector/internal/metricAggregator"
+)
+
+// The state of a series is removed if it did not receive a message for SERIES_EXPIRY_PERIODS
+// times its period (the time between its last two messages). The period of a series with a
+// single message is unknown, its state is kept for SERIES_EXPIRY_UNKNOWN_PERIOD.
+const (
+	SERIES_EXPIRY_PERIODS        = 10
+	SERIES_EXPIRY_UNKNOWN_PERIOD = time.Hour
+)
+
+// ruleMatcher selects the first of a list of rules applying to a message by the metric
+// names and the condition of the rules
+type ruleMatcher struct {
+	section    string            // Configuration option of the rules for log messages
+	names      []map[string]bool // Metric names of the rules for O(1) lookup
+	conditions []string          // Conditions of the rules
+	warned     map[string]bool   // Rules whose condition failed to evaluate
+}
+
+// newRuleMatcher creates an empty rule matcher for the rules of a configuration option
+func newRuleMatcher(section string) *ruleMatcher {
+	return &ruleMatcher{
+		section:    section,
+		names:      make([]map[string]bool, 0),
+		conditions: make([]string, 0),
+		warned:     make(map[string]bool),
+	}
+}
+
+// add appends a rule with its metric names and condition
+func (rm *ruleMatcher) add(metrics []string, condition string) {
+	names := make(map[string]bool)
+	for _, name := range metrics {
+		names[name] = true
+	}
+	rm.names = append(rm.names, names)
+	rm.conditions = append(rm.conditions, condition)
+}
+
+// match returns the index of the first rule applying to the message or -1
+func (rm *ruleMatcher) match(m lp.CCMessage) int {
+	var params map[string]interface{}
+	for i, condition := range rm.conditions {
+		if len(rm.names[i]) > 0 && !rm.names[i][m.Name()] {
+			continue
+		}
+		if len(condition) > 0 && condition != "*" {
+			if params == nil {
+				params = getParamMap(m)
+			}
+			matches, err := agg.EvalBoolCondition(condition, params)
+			if err != nil {
+				warnCondition(rm.warned, fmt.Sprintf("%s[%d]", rm.section, i), condition, err)
+				continue
+			}
+			if !matches {
+				continue
+			}
+		}
+		return i
+	}
+	return -1
+}
+
+// series is the state of a series (metric name and tag set). The times are the times of
+// the messages, not of the router.
+type series[T any] struct {
+	seen   time.Time     // Time of the last message
+	period time.Duration // Time between the last two messages (0 = unknown)
+	state  T
+}
+
+// seriesMap holds the state of all series by their key
+type seriesMap[T any] map[string]*series[T]
+
+// seriesKey returns the key of the series of a message: its name and all tags
+func seriesKey(m lp.CCMessage) string {
+	tags := m.Tags()
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(m.Name())
+	for _, k := range keys {
+		b.WriteString(",")
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(tags[k])
+	}
+	return b.String()
+}
+
+// lookup returns the series of a message and whether it existed. A new series is
+// added with the time of the message.
+func (sm seriesMap[T]) lookup(m lp.CCMessage) (*series[T], bool) {
+	key := seriesKey(m)
+	s, ok := sm[key]
+	if !ok {
+		s = &series[T]{seen: m.Time()}
+		sm[key] = s
+	}
+	return s, ok
+}
+
+// observe records the time of a message of the series. Messages not newer than the
+// last one do not change the period.
+func (s *series[T]) observe(t time.Time) {
+	if t.After(s.seen) {
+		s.period = t.Sub(s.seen)
+		s.seen = t
+	}
+}
+
+// expire removes the series without messages for SERIES_EXPIRY_PERIODS times their period
+// or for the minimum returned for their state, whichever is longer
+func (sm seriesMap[T]) expire(now time.Time, minimum func(state *T) time.Duration) {
+	for key, s := range sm {
+		expiry := SERIES_EXPIRY_UNKNOWN_PERIOD
+		if s.period > 0 {
+			expiry = SERIES_EXPIRY_PERIODS * s.period
+		}
+		if minimum != nil {
+			expiry = max(expiry, minimum(&s.state))
+		}
+		if now.Sub(s.seen) > expiry {
+			delete(sm, key)
+		}
+	}
+}
+
+// toFloat64 converts a numeric value
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
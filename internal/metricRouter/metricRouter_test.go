@@ -0,0 +1,147 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package metricRouter
+
+import (
+	"reflect"
+	"testing"
+
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+	mp "github.com/ClusterCockpit/cc-lib/messageProcessor"
+	jt "github.com/ClusterCockpit/cc-metric-collector/internal/jobTagger"
+	agg "github.com/ClusterCockpit/cc-metric-collector/internal/metricAggregator"
+	bp "github.com/ClusterCockpit/cc-metric-collector/pkg/backPressure"
+)
+
+// Message processor forwarding all messages unchanged
+type testMessageProcessor struct {
+	mp.MessageProcessor
+}
+
+func (p *testMessageProcessor) ProcessMessage(m lp.CCMessage) (lp.CCMessage, error) {
+	return m, nil
+}
+
+// Job tagger tagging all messages with job 1
+type testJobTagger struct {
+	jt.JobTagger
+}
+
+func (t *testJobTagger) Tag(m lp.CCMessage) {
+	m.AddTag("jobid", "1")
+}
+
+// newTestRouter creates a router with the message processing of a started router
+// and a single output channel
+func newTestRouter(t *testing.T) (*metricRouter, chan lp.CCMessage) {
+	t.Helper()
+	output := make(chan lp.CCMessage, 10)
+	s, err := bp.NewSender("", output, bp.POLICY_DROP_NEWEST)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &metricRouter{
+		outputs:   []chan lp.CCMessage{output},
+		senders:   []bp.Sender{s},
+		mp:        new(testMessageProcessor),
+		dedup:     newDeduplicator(nil),
+		deriver:   newDeriver(nil),
+		jobTagger: new(testJobTagger),
+		stats: map[string]*metricRouterInputCounters{
+			ROUTER_INPUT_COLLECTORS: new(metricRouterInputCounters),
+			ROUTER_INPUT_RECEIVERS:  new(metricRouterInputCounters),
+			ROUTER_INPUT_CACHE:      new(metricRouterInputCounters),
+		},
+	}
+	return r, output
+}
+
+func TestForwardJobTags(t *testing.T) {
+	r, output := newTestRouter(t)
+	tests := []struct {
+		input  string
+		tagged bool
+	}{
+		{ROUTER_INPUT_COLLECTORS, true},
+		{ROUTER_INPUT_RECEIVERS, false}, // relayed from another host
+		{ROUTER_INPUT_CACHE, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			m, err := lp.NewMetric("cpu_user", map[string]string{"type": "hwthread", "type-id": "0"}, nil, 1.0, testStart)
+			if err != nil || m == nil {
+				t.Fatalf("cannot create metric: %v", err)
+			}
+			r.forward(m, tt.input)
+			if len(output) != 1 {
+				t.Fatalf("%d messages forwarded, want 1", len(output))
+			}
+			if _, tagged := (<-output).GetTag("jobid"); tagged != tt.tagged {
+				t.Errorf("message of input %s tagged %v, want %v", tt.input, tagged, tt.tagged)
+			}
+			if st := r.Stats()[tt.input]; st.Received != 1 || st.Forwarded != 1 {
+				t.Errorf("stats of input %s %+v, want one message received and forwarded", tt.input, st)
+			}
+		})
+	}
+}
+
+func TestCheckAggregations(t *testing.T) {
+	tests := []struct {
+		name  string
+		agg   agg.MetricAggregatorIntervalConfig
+		valid bool
+	}{
+		{"valid", agg.MetricAggregatorIntervalConfig{Name: "cpu_user_sum", Function: "sum(values)", Condition: "metric.Name() == 'cpu_user'"}, true},
+		{"empty name", agg.MetricAggregatorIntervalConfig{Function: "sum(values)", Condition: "true"}, false},
+		{"invalid function", agg.MetricAggregatorIntervalConfig{Name: "cpu_user_sum", Function: "sum(values", Condition: "true"}, false},
+		{"invalid condition", agg.MetricAggregatorIntervalConfig{Name: "cpu_user_sum", Function: "sum(values)", Condition: "name =="}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := checkAggregations([]agg.MetricAggregatorIntervalConfig{tt.agg})
+			if valid := len(errs) == 0; valid != tt.valid {
+				t.Errorf("checkAggregations() = %v, want valid %v", errs, tt.valid)
+			}
+		})
+	}
+}
+
+// Metric cache recording the names of its aggregations
+type testCache struct {
+	MetricCache
+	aggs map[string]string
+}
+
+func (c *testCache) AddAggregation(name, function, condition string, tags, meta map[string]string) error {
+	c.aggs[name] = function
+	return nil
+}
+
+func (c *testCache) DeleteAggregation(name string) error {
+	delete(c.aggs, name)
+	return nil
+}
+
+func TestUpdateAggregations(t *testing.T) {
+	c := &testCache{aggs: map[string]string{"kept": "sum(values)", "changed": "sum(values)", "removed": "sum(values)"}}
+	r := &metricRouter{cache: c}
+	r.updateAggregations([]agg.MetricAggregatorIntervalConfig{
+		{Name: "kept", Function: "sum(values)", Condition: "true"},
+		{Name: "changed", Function: "sum(values)", Condition: "true"},
+		{Name: "removed", Function: "sum(values)", Condition: "true"},
+	}, []agg.MetricAggregatorIntervalConfig{
+		{Name: "kept", Function: "sum(values)", Condition: "true"},
+		{Name: "changed", Function: "avg(values)", Condition: "true"},
+		{Name: "added", Function: "max(values)", Condition: "true"},
+	})
+	want := map[string]string{"kept": "sum(values)", "changed": "avg(values)", "added": "max(values)"}
+	if !reflect.DeepEqual(c.aggs, want) {
+		t.Errorf("aggregations after the update %v, want %v", c.aggs, want)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package sinkSpool
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+	"github.com/ClusterCockpit/cc-lib/sinks"
+)
+
+// Sink type of the flaky sink, only available in the tests
+const FLAKY_SINK_TYPE = "flaky"
+
+func init() {
+	sinks.AvailableSinks[FLAKY_SINK_TYPE] = newFlakySink
+}
+
+// Flaky sink data structure: a local stand-in for a remote sink which fails on demand
+type flakySink struct {
+	name      string
+	lock      sync.Mutex
+	failing   bool
+	failures  int            // Number of failed writes and flushes
+	buffer    []lp.CCMessage // Messages written since the last flush
+	delivered []lp.CCMessage // Messages confirmed by a successful flush
+}
+
+// setFailing lets all writes and flushes fail until it is reset
+func (s *flakySink) setFailing(failing bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failing = failing
+}
+
+// failedCalls returns the number of failed writes and flushes
+func (s *flakySink) failedCalls() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.failures
+}
+
+// names returns the names of the delivered messages in the order of delivery
+func (s *flakySink) names() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	names := make([]string, 0, len(s.delivered))
+	for _, m := range s.delivered {
+		names = append(names, m.Name())
+	}
+	return names
+}
+
+// Write buffers the message until the next flush
+func (s *flakySink) Write(m lp.CCMessage) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.failing {
+		s.failures++
+		return errors.New("flaky sink is failing")
+	}
+	s.buffer = append(s.buffer, m)
+	return nil
+}
+
+// Flush delivers the buffered messages. The buffered messages are lost if the sink fails,
+// like with a remote sink whose connection breaks.
+func (s *flakySink) Flush() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	buffer := s.buffer
+	s.buffer = nil
+	if s.failing {
+		s.failures++
+		return errors.New("flaky sink is failing")
+	}
+	s.delivered = append(s.delivered, buffer...)
+	return nil
+}
+
+// Close flushes the buffered messages
+func (s *flakySink) Close() {
+	s.Flush()
+}
+
+// Name returns the name of the sink
+func (s *flakySink) Name() string {
+	return s.name
+}
+
+// newFlakySink creates a sink for testing the spool which fails on demand
+func newFlakySink(name string, config json.RawMessage) (sinks.Sink, error) {
+	return &flakySink{name: name}, nil
+}
@@ -0,0 +1,677 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package sinkSpool
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cclog "github.com/ClusterCockpit/cc-lib/ccLogger"
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+	"github.com/ClusterCockpit/cc-lib/sinks"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/clock"
+)
+
+// Sink type provided by this package
+const SPOOL_SINK_TYPE = "spool"
+
+// Defaults of the spool sink configuration
+const (
+	SPOOL_DEFAULT_MAX_SIZE_MB    = 1024
+	SPOOL_DEFAULT_MAX_AGE        = 24 * time.Hour
+	SPOOL_DEFAULT_FLUSH_INTERVAL = time.Second
+	SPOOL_DEFAULT_RETRY_INTERVAL = 10 * time.Second
+)
+
+// Number of segments the maximal spool size is split into
+const SPOOL_SEGMENTS = 16
+
+// Minimal size of a spool segment in bytes
+const SPOOL_MIN_SEGMENT_SIZE = 64 * 1024
+
+// Name pattern of the spool segment files
+const SPOOL_SEGMENT_PATTERN = "segment-%020d.jsonl"
+
+func init() {
+	sinks.AvailableSinks[SPOOL_SINK_TYPE] = NewSpoolSink
+}
+
+// Spool sink configuration
+type spoolSinkConfig struct {
+	Type          string          `json:"type"`
+	Path          string          `json:"path"`                     // Directory of the spool, one per sink
+	MaxSizeMB     int             `json:"max_size_mb,omitempty"`    // Maximal size of the spool in MiB
+	MaxAge        string          `json:"max_age,omitempty"`        // Maximal age of spooled messages
+	FlushInterval string          `json:"flush_interval,omitempty"` // Interval of confirming the delivery by flushing the sink
+	RetryInterval string          `json:"retry_interval,omitempty"` // Interval of retrying to send the spooled messages
+	Sink          json.RawMessage `json:"sink"`                     // Configuration of the wrapped sink
+}
+
+// Spooled message as stored in a segment file
+type spoolRecord struct {
+	Name   string                 `json:"name"`
+	Tags   map[string]string      `json:"tags,omitempty"`
+	Meta   map[string]string      `json:"meta,omitempty"`
+	Fields map[string]interface{} `json:"fields"`
+	Kinds  map[string]string      `json:"kinds,omitempty"` // Kinds of the numeric fields: int, uint or float
+	Time   int64                  `json:"time"`            // Unix time in nanoseconds
+}
+
+// Segment file of the spool
+type spoolSegment struct {
+	path     string
+	file     *os.File  // Open for appending while it is the current segment, nil otherwise
+	messages int       // Number of messages in the segment
+	size     int64     // Size of the segment file in bytes
+	last     time.Time // Time the last message was spooled
+}
+
+// Spool sink data structure
+type spoolSink struct {
+	name          string
+	inner         sinks.Sink
+	path          string
+	maxSize       int64
+	segmentSize   int64
+	maxAge        time.Duration
+	flushInterval time.Duration
+	retryInterval time.Duration
+	clock         clock.Clock // Clock for the segment times and the flush and retry tickers
+
+	lock     sync.Mutex      // Lock for the spool state
+	spooling bool            // Messages are spooled until the spool is replayed
+	segments []*spoolSegment // Segments from oldest to newest, the newest may be open
+	sequence int64           // Sequence number of the last segment
+	size     int64           // Total size of the segments in bytes
+	dropped  uint64          // Number of messages dropped during the current outage
+
+	innerLock sync.Mutex     // Lock for the wrapped sink
+	pending   []lp.CCMessage // Messages written to the wrapped sink since the last successful flush
+
+	stats spoolCounters
+	done  chan bool
+	wg    sync.WaitGroup
+}
+
+// Message counters of a spool
+type spoolCounters struct {
+	spooled   atomic.Uint64
+	replayed  atomic.Uint64
+	droppedSz atomic.Uint64
+	droppedAg atomic.Uint64
+	droppedIO atomic.Uint64
+}
+
+// SpoolStats contains the counters and the fill level of the spool of a sink
+type SpoolStats struct {
+	Sink        string
+	Spooled     uint64 // Number of messages written to the spool
+	Replayed    uint64 // Number of messages sent from the spool
+	DroppedSize uint64 // Number of messages dropped because the spool was full
+	DroppedAge  uint64 // Number of messages dropped because they exceeded the maximal age
+	DroppedIO   uint64 // Number of messages dropped because they could not be written to the spool
+	Messages    int    // Number of messages in the spool
+	Bytes       int64  // Size of the spool in bytes
+	Unavailable bool   // The spool is used because the sink failed
+}
+
+var (
+	spoolsLock sync.Mutex
+	spools     = make(map[string]*spoolSink)
+)
+
+// Stats returns the statistics of all spool sinks sorted by sink name
+func Stats() []SpoolStats {
+	spoolsLock.Lock()
+	names := make([]string, 0, len(spools))
+	for name := range spools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]*spoolSink, 0, len(names))
+	for _, name := range names {
+		list = append(list, spools[name])
+	}
+	spoolsLock.Unlock()
+
+	stats := make([]SpoolStats, 0, len(list))
+	for _, s := range list {
+		st := SpoolStats{
+			Sink:        s.name,
+			Spooled:     s.stats.spooled.Load(),
+			Replayed:    s.stats.replayed.Load(),
+			DroppedSize: s.stats.droppedSz.Load(),
+			DroppedAge:  s.stats.droppedAg.Load(),
+			DroppedIO:   s.stats.droppedIO.Load(),
+		}
+		s.lock.Lock()
+		for _, seg := range s.segments {
+			st.Messages += seg.messages
+		}
+		st.Bytes = s.size
+		st.Unavailable = s.spooling
+		s.lock.Unlock()
+		stats = append(stats, st)
+	}
+	return stats
+}
+
+// parseDuration parses an optional duration option
+func parseDuration(option, value string, def time.Duration) (time.Duration, error) {
+	if len(value) == 0 {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", option, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s: must be greater than zero", option)
+	}
+	return d, nil
+}
+
+// toRecord converts a message for storing it in a segment. JSON encodes integer-valued
+// floats like integers, so the kinds of the numeric fields are stored with the record.
+func toRecord(m lp.CCMessage) spoolRecord {
+	fields := m.Fields()
+	kinds := make(map[string]string)
+	for k, v := range fields {
+		switch v.(type) {
+		case int, int8, int16, int32, int64:
+			kinds[k] = "int"
+		case uint, uint8, uint16, uint32, uint64:
+			kinds[k] = "uint"
+		case float32, float64:
+			kinds[k] = "float"
+		}
+	}
+	return spoolRecord{
+		Name:   m.Name(),
+		Tags:   m.Tags(),
+		Meta:   m.Meta(),
+		Fields: fields,
+		Kinds:  kinds,
+		Time:   m.Time().UnixNano(),
+	}
+}
+
+// fromRecord converts a stored message. Numbers are restored as int64, uint64 or float64
+// by their stored kind. Numbers without kind are restored as int64 if possible.
+func fromRecord(r spoolRecord) (lp.CCMessage, error) {
+	for k, v := range r.Fields {
+		n, ok := v.(json.Number)
+		if !ok {
+			continue
+		}
+		switch r.Kinds[k] {
+		case "int":
+			if i, err := n.Int64(); err == nil {
+				r.Fields[k] = i
+				continue
+			}
+		case "uint":
+			if u, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+				r.Fields[k] = u
+				continue
+			}
+		case "float":
+		default:
+			if i, err := n.Int64(); err == nil {
+				r.Fields[k] = i
+				continue
+			}
+		}
+		if f, err := n.Float64(); err == nil {
+			r.Fields[k] = f
+		}
+	}
+	return lp.NewMessage(r.Name, r.Tags, r.Meta, r.Fields, time.Unix(0, r.Time))
+}
+
+// readSegment reads all messages of a segment file
+func readSegment(path string) ([]lp.CCMessage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	messages := make([]lp.CCMessage, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var r spoolRecord
+		d := json.NewDecoder(bytes.NewReader(line))
+		d.UseNumber()
+		if err := d.Decode(&r); err != nil {
+			// Incomplete last line after a crash
+			cclog.ComponentError("SinkSpool", "Skipping invalid record in", path, ":", err.Error())
+			continue
+		}
+		m, err := fromRecord(r)
+		if err != nil || m == nil {
+			continue
+		}
+		messages = append(messages, m)
+	}
+	return messages, scanner.Err()
+}
+
+// countLines returns the number of records of a segment file
+func countLines(path string) int {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	return bytes.Count(raw, []byte("\n"))
+}
+
+// loadSegments reads the segments left in the spool directory, e.g. by a previous run
+func (s *spoolSink) loadSegments() error {
+	files, err := filepath.Glob(filepath.Join(s.path, "segment-*.jsonl"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, path := range files {
+		var seq int64
+		if _, err := fmt.Sscanf(filepath.Base(path), SPOOL_SEGMENT_PATTERN, &seq); err != nil {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		s.segments = append(s.segments, &spoolSegment{
+			path:     path,
+			messages: countLines(path),
+			size:     info.Size(),
+			last:     info.ModTime(),
+		})
+		s.size += info.Size()
+		if seq > s.sequence {
+			s.sequence = seq
+		}
+	}
+	if len(s.segments) > 0 {
+		s.spooling = true
+		cclog.ComponentInfo("SinkSpool", s.name, ": replaying", len(s.segments), "segments of a previous run")
+	}
+	return nil
+}
+
+// closeSegment closes the current segment. Requires s.lock.
+func (s *spoolSink) closeSegment() {
+	if len(s.segments) == 0 {
+		return
+	}
+	seg := s.segments[len(s.segments)-1]
+	if seg.file == nil {
+		return
+	}
+	seg.file.Sync()
+	seg.file.Close()
+	seg.file = nil
+}
+
+// removeSegment removes the oldest segment. Requires s.lock.
+func (s *spoolSink) removeSegment() *spoolSegment {
+	seg := s.segments[0]
+	if seg.file != nil {
+		seg.file.Close()
+	}
+	os.Remove(seg.path)
+	s.segments = s.segments[1:]
+	s.size -= seg.size
+	return seg
+}
+
+// countDropped counts dropped messages. Only the first drop of an outage is logged as
+// error, the number of all dropped messages is logged when the outage ends. Requires s.lock.
+func (s *spoolSink) countDropped(counter *atomic.Uint64, messages uint64, reason string) {
+	if messages == 0 {
+		return
+	}
+	counter.Add(messages)
+	if s.dropped == 0 {
+		cclog.ComponentError("SinkSpool", s.name, ": dropping spooled messages,", reason)
+	}
+	s.dropped += messages
+	cclog.ComponentDebug("SinkSpool", s.name, ": dropped", messages, "spooled messages,", reason)
+}
+
+// removeOldest removes the oldest segment and counts its messages as dropped. Requires s.lock.
+func (s *spoolSink) removeOldest(counter *atomic.Uint64, reason string) {
+	seg := s.removeSegment()
+	s.countDropped(counter, uint64(seg.messages), reason)
+}
+
+// spool appends messages to the current segment and enforces the maximal spool size.
+// Messages which cannot be written are dropped and the last error is returned.
+// Requires s.lock.
+func (s *spoolSink) spool(messages ...lp.CCMessage) error {
+	var spoolErr error
+	for _, m := range messages {
+		line, err := json.Marshal(toRecord(m))
+		if err != nil {
+			spoolErr = fmt.Errorf("cannot encode message: %v", err)
+			s.countDropped(&s.stats.droppedIO, 1, spoolErr.Error())
+			continue
+		}
+		line = append(line, '\n')
+
+		var seg *spoolSegment
+		if n := len(s.segments); n > 0 && s.segments[n-1].file != nil && s.segments[n-1].size < s.segmentSize {
+			seg = s.segments[n-1]
+		} else {
+			s.closeSegment()
+			s.sequence++
+			path := filepath.Join(s.path, fmt.Sprintf(SPOOL_SEGMENT_PATTERN, s.sequence))
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+			if err != nil {
+				spoolErr = fmt.Errorf("cannot create segment: %v", err)
+				s.countDropped(&s.stats.droppedIO, 1, spoolErr.Error())
+				continue
+			}
+			seg = &spoolSegment{path: path, file: f}
+			s.segments = append(s.segments, seg)
+		}
+		if _, err := seg.file.Write(line); err != nil {
+			spoolErr = fmt.Errorf("cannot write segment: %v", err)
+			s.countDropped(&s.stats.droppedIO, 1, spoolErr.Error())
+			continue
+		}
+		seg.messages++
+		seg.size += int64(len(line))
+		seg.last = s.clock.Now()
+		s.size += int64(len(line))
+		s.stats.spooled.Add(1)
+
+		// Drop the oldest segments if the spool is full
+		for s.size > s.maxSize && len(s.segments) > 1 {
+			s.removeOldest(&s.stats.droppedSz, "spool is full")
+		}
+	}
+	return spoolErr
+}
+
+// startSpooling spools the messages not confirmed by a flush of the wrapped sink and
+// all following messages until the spool is replayed. It returns an error if messages
+// could not be spooled.
+func (s *spoolSink) startSpooling(err error, messages []lp.CCMessage) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.spooling {
+		cclog.ComponentError("SinkSpool", s.name, ": sink unavailable, spooling messages:", err.Error())
+		s.spooling = true
+	}
+	return s.spool(messages...)
+}
+
+// Write sends the message to the wrapped sink or spools it while the sink is unavailable.
+// It returns an error if the message or unconfirmed messages could not be spooled.
+func (s *spoolSink) Write(m lp.CCMessage) error {
+	s.lock.Lock()
+	if s.spooling {
+		err := s.spool(m)
+		s.lock.Unlock()
+		return err
+	}
+	s.lock.Unlock()
+
+	s.innerLock.Lock()
+	err := s.inner.Write(m)
+	var unconfirmed []lp.CCMessage
+	if err == nil {
+		s.pending = append(s.pending, m)
+	} else {
+		unconfirmed = append(s.pending, m)
+		s.pending = nil
+	}
+	s.innerLock.Unlock()
+	if err != nil {
+		return s.startSpooling(err, unconfirmed)
+	}
+	return nil
+}
+
+// Flush flushes the wrapped sink. The messages written since the last successful
+// flush are spooled if it fails. It returns an error if they could not be spooled.
+func (s *spoolSink) Flush() error {
+	s.innerLock.Lock()
+	err := s.inner.Flush()
+	unconfirmed := s.pending
+	s.pending = nil
+	s.innerLock.Unlock()
+	if err != nil && len(unconfirmed) > 0 {
+		return s.startSpooling(err, unconfirmed)
+	}
+	return nil
+}
+
+// expire drops the segments containing only messages older than the maximal age
+func (s *spoolSink) expire() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	limit := s.clock.Now().Add(-s.maxAge)
+	for len(s.segments) > 0 && s.segments[0].last.Before(limit) {
+		s.removeOldest(&s.stats.droppedAg, "exceeded max_age")
+	}
+}
+
+// oldestSegment returns the oldest segment for replaying. The current segment is closed
+// if it is the only one. If the spool is empty, spooling ends and nil is returned.
+func (s *spoolSink) oldestSegment() *spoolSegment {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.segments) == 0 {
+		if s.spooling && s.dropped > 0 {
+			cclog.ComponentInfo("SinkSpool", s.name, ": sink available again, spool replayed,", s.dropped, "messages dropped")
+		} else if s.spooling {
+			cclog.ComponentInfo("SinkSpool", s.name, ": sink available again, spool replayed")
+		}
+		s.spooling = false
+		s.dropped = 0
+		return nil
+	}
+	if len(s.segments) == 1 {
+		s.closeSegment()
+	}
+	return s.segments[0]
+}
+
+// replay sends the spooled messages segment by segment in timestamp order to the wrapped
+// sink. A segment is removed after the wrapped sink was flushed successfully, so messages
+// may be sent again if the sink fails during the replay.
+func (s *spoolSink) replay() {
+	for {
+		seg := s.oldestSegment()
+		if seg == nil {
+			return
+		}
+		messages, err := readSegment(seg.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			cclog.ComponentError("SinkSpool", s.name, ": cannot read segment:", err.Error())
+		}
+		sort.SliceStable(messages, func(i, j int) bool {
+			return messages[i].Time().Before(messages[j].Time())
+		})
+
+		limit := s.clock.Now().Add(-s.maxAge)
+		var replayed, expired uint64
+		s.innerLock.Lock()
+		for _, m := range messages {
+			if m.Time().Before(limit) {
+				expired++
+				continue
+			}
+			if err = s.inner.Write(m); err != nil {
+				break
+			}
+			replayed++
+		}
+		if err == nil {
+			err = s.inner.Flush()
+		}
+		s.innerLock.Unlock()
+		if err != nil {
+			cclog.ComponentDebug("SinkSpool", s.name, ": replay failed:", err.Error())
+			return
+		}
+
+		s.lock.Lock()
+		if len(s.segments) > 0 && s.segments[0] == seg {
+			s.removeSegment()
+		}
+		s.countDropped(&s.stats.droppedAg, expired, "exceeded max_age")
+		s.lock.Unlock()
+		s.stats.replayed.Add(replayed)
+	}
+}
+
+// Close stops the spool sink. Spooled messages are kept for the next run.
+func (s *spoolSink) Close() {
+	close(s.done)
+	s.wg.Wait()
+	s.Flush()
+	s.lock.Lock()
+	s.closeSegment()
+	s.lock.Unlock()
+	s.inner.Close()
+	spoolsLock.Lock()
+	delete(spools, s.name)
+	spoolsLock.Unlock()
+}
+
+// Name returns the name of the sink
+func (s *spoolSink) Name() string {
+	return s.name
+}
+
+// start confirms the delivery by flushing the wrapped sink every flush interval and
+// replays the spool every retry interval
+func (s *spoolSink) start() {
+	flush := s.clock.NewTicker(s.flushInterval)
+	retry := s.clock.NewTicker(s.retryInterval)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer flush.Stop()
+		defer retry.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-flush.C():
+				s.lock.Lock()
+				spooling := s.spooling
+				s.lock.Unlock()
+				if !spooling {
+					s.Flush()
+				}
+			case <-retry.C():
+				s.expire()
+				s.replay()
+			}
+		}
+	}()
+}
+
+// NewSpoolSink creates a sink which wraps the configured sink and stores the messages in a
+// bounded spool on local disk while the wrapped sink fails
+func NewSpoolSink(name string, config json.RawMessage) (sinks.Sink, error) {
+	s, err := newSpoolSink(name, config, clock.Real)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// newSpoolSink creates a spool sink using the given clock, e.g. a fake clock in tests
+func newSpoolSink(name string, config json.RawMessage, clk clock.Clock) (*spoolSink, error) {
+	var c spoolSinkConfig
+	d := json.NewDecoder(bytes.NewReader(config))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&c); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if len(c.Path) == 0 {
+		return nil, fmt.Errorf("%s: path: spool directory must be set", name)
+	}
+	if c.MaxSizeMB < 0 {
+		return nil, fmt.Errorf("%s: max_size_mb: must not be negative", name)
+	}
+	var inner struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(c.Sink, &inner); err != nil || len(inner.Type) == 0 {
+		return nil, fmt.Errorf("%s: sink: configuration of the wrapped sink with type must be set", name)
+	}
+	if inner.Type == SPOOL_SINK_TYPE {
+		return nil, fmt.Errorf("%s: sink: cannot wrap a spool sink", name)
+	}
+	newSink, ok := sinks.AvailableSinks[inner.Type]
+	if !ok {
+		return nil, fmt.Errorf("%s: sink: unknown sink type '%s'", name, inner.Type)
+	}
+
+	s := &spoolSink{
+		name:     name,
+		path:     c.Path,
+		clock:    clk,
+		done:     make(chan bool),
+		segments: make([]*spoolSegment, 0),
+	}
+	var err error
+	if s.maxAge, err = parseDuration("max_age", c.MaxAge, SPOOL_DEFAULT_MAX_AGE); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if s.flushInterval, err = parseDuration("flush_interval", c.FlushInterval, SPOOL_DEFAULT_FLUSH_INTERVAL); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if s.retryInterval, err = parseDuration("retry_interval", c.RetryInterval, SPOOL_DEFAULT_RETRY_INTERVAL); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	maxSizeMB := c.MaxSizeMB
+	if maxSizeMB == 0 {
+		maxSizeMB = SPOOL_DEFAULT_MAX_SIZE_MB
+	}
+	s.maxSize = int64(maxSizeMB) * 1024 * 1024
+	s.segmentSize = max(s.maxSize/SPOOL_SEGMENTS, SPOOL_MIN_SEGMENT_SIZE)
+
+	if err := os.MkdirAll(s.path, 0700); err != nil {
+		return nil, fmt.Errorf("%s: path: %v", name, err)
+	}
+	if err := s.loadSegments(); err != nil {
+		return nil, fmt.Errorf("%s: path: %v", name, err)
+	}
+	s.inner, err = newSink(name, c.Sink)
+	if err != nil {
+		return nil, err
+	}
+
+	spoolsLock.Lock()
+	spools[name] = s
+	spoolsLock.Unlock()
+	s.start()
+	return s, nil
+}
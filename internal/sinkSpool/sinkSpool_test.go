@@ -0,0 +1,347 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package sinkSpool
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/clock"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestSpool creates a spool sink wrapping a flaky sink with the given spool directory.
+// It flushes every second and retries every 10 seconds of the fake clock.
+func newTestSpool(t *testing.T, dir string, clk *clock.Fake) (*spoolSink, *flakySink) {
+	t.Helper()
+	config := fmt.Sprintf(`{
+		"type": "spool",
+		"path": %q,
+		"max_age": "1h",
+		"flush_interval": "1s",
+		"retry_interval": "10s",
+		"sink": {"type": "flaky"}
+	}`, dir)
+	s, err := newSpoolSink(t.Name(), json.RawMessage(config), clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, s.inner.(*flakySink)
+}
+
+// testMessage creates a metric or fails the test
+func testMessage(t *testing.T, name string, ts time.Time) lp.CCMessage {
+	t.Helper()
+	m, err := lp.NewMetric(name, map[string]string{"type": "node", "hostname": "n1"}, nil, 1, ts)
+	if err != nil || m == nil {
+		t.Fatalf("cannot create metric %s: %v", name, err)
+	}
+	return m
+}
+
+// write writes messages with the given names and the current time of the fake clock
+func write(t *testing.T, s *spoolSink, clk *clock.Fake, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := s.Write(testMessage(t, name, clk.Now())); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// stats returns the statistics of a spool sink
+func stats(s *spoolSink) SpoolStats {
+	for _, st := range Stats() {
+		if st.Sink == s.name {
+			return st
+		}
+	}
+	return SpoolStats{}
+}
+
+// diskSize returns the size of all segment files in the spool directory
+func diskSize(t *testing.T, dir string) int64 {
+	t.Helper()
+	files, _ := filepath.Glob(filepath.Join(dir, "segment-*.jsonl"))
+	var size int64
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += info.Size()
+	}
+	return size
+}
+
+// waitFor polls a condition, the spool is flushed and replayed in its own goroutine
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// recoverSink lets the flaky sink work again and waits until the spool is replayed
+func recoverSink(t *testing.T, s *spoolSink, f *flakySink, clk *clock.Fake) {
+	t.Helper()
+	f.setFailing(false)
+	clk.Advance(s.retryInterval)
+	waitFor(t, "the replay of the spool", func() bool { return !stats(s).Unavailable })
+}
+
+func TestSpoolOutage(t *testing.T) {
+	dir := t.TempDir()
+	clk := clock.NewFake(testStart)
+	s, f := newTestSpool(t, dir, clk)
+	defer s.Close()
+
+	write(t, s, clk, "m1")
+	s.Flush()
+	write(t, s, clk, "m2")
+	f.setFailing(true)
+
+	// The flush fails, so m2 is not confirmed and spooled with all following messages
+	s.Flush()
+	write(t, s, clk, "m3", "m4")
+	st := stats(s)
+	if !st.Unavailable || st.Messages != 3 || st.Spooled != 3 {
+		t.Errorf("stats during the outage %+v, want 3 spooled messages", st)
+	}
+	if size := diskSize(t, dir); st.Bytes != size || size == 0 {
+		t.Errorf("spool size %d, want the size of the segment files %d", st.Bytes, size)
+	}
+
+	// A failed replay keeps the spool
+	failures := f.failedCalls()
+	clk.Advance(10 * time.Second)
+	waitFor(t, "a failed replay", func() bool { return f.failedCalls() > failures })
+	if st := stats(s); st.Messages != 3 || st.Replayed != 0 {
+		t.Errorf("stats after a failed replay %+v, want the spool unchanged", st)
+	}
+
+	recoverSink(t, s, f, clk)
+	if names := f.names(); !reflect.DeepEqual(names, []string{"m1", "m2", "m3", "m4"}) {
+		t.Errorf("delivered %v, want all messages in order", names)
+	}
+	st = stats(s)
+	if st.Messages != 0 || st.Bytes != 0 || st.Replayed != 3 || diskSize(t, dir) != 0 {
+		t.Errorf("stats after the replay %+v, want an empty spool", st)
+	}
+
+	// Without outage the messages pass through
+	write(t, s, clk, "m5")
+	clk.Advance(time.Second)
+	waitFor(t, "the flush of m5", func() bool { return len(f.names()) == 5 })
+}
+
+func TestSpoolReplayOrder(t *testing.T) {
+	dir := t.TempDir()
+	clk := clock.NewFake(testStart)
+	s, f := newTestSpool(t, dir, clk)
+	defer s.Close()
+
+	f.setFailing(true)
+	for _, m := range []struct {
+		name   string
+		offset time.Duration
+	}{{"t3", 3 * time.Second}, {"t1", time.Second}, {"t2", 2 * time.Second}} {
+		if err := s.Write(testMessage(t, m.name, clk.Now().Add(m.offset))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Messages written after the sink recovered do not overtake the spooled ones
+	f.setFailing(false)
+	if err := s.Write(testMessage(t, "t4", clk.Now().Add(4*time.Second))); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.names()) != 0 {
+		t.Fatalf("message overtook the spooled messages")
+	}
+	recoverSink(t, s, f, clk)
+	if names := f.names(); !reflect.DeepEqual(names, []string{"t1", "t2", "t3", "t4"}) {
+		t.Errorf("replayed %v, want timestamp order", names)
+	}
+}
+
+func TestSpoolSizeLimit(t *testing.T) {
+	dir := t.TempDir()
+	clk := clock.NewFake(testStart)
+	s, f := newTestSpool(t, dir, clk)
+	defer s.Close()
+
+	// One message per segment and room for two and a half messages
+	line, _ := json.Marshal(toRecord(testMessage(t, "m1", clk.Now())))
+	s.lock.Lock()
+	s.segmentSize = 1
+	s.maxSize = int64(len(line)+1)*5/2 + 1
+	s.lock.Unlock()
+
+	f.setFailing(true)
+	write(t, s, clk, "m1", "m2", "m3", "m4", "m5")
+	st := stats(s)
+	if st.Messages != 2 || st.DroppedSize != 3 || st.Spooled != 5 {
+		t.Errorf("stats of the full spool %+v, want the 2 newest messages kept and 3 dropped", st)
+	}
+	if size := diskSize(t, dir); st.Bytes != size || size > s.maxSize {
+		t.Errorf("spool size %d, want the size of the segment files %d within the limit %d", st.Bytes, size, s.maxSize)
+	}
+	recoverSink(t, s, f, clk)
+	if names := f.names(); !reflect.DeepEqual(names, []string{"m4", "m5"}) {
+		t.Errorf("replayed %v, want the newest messages", names)
+	}
+}
+
+func TestSpoolAgeLimit(t *testing.T) {
+	dir := t.TempDir()
+	clk := clock.NewFake(testStart)
+	s, f := newTestSpool(t, dir, clk)
+	defer s.Close()
+	s.lock.Lock()
+	s.segmentSize = 1
+	s.lock.Unlock()
+
+	f.setFailing(true)
+	write(t, s, clk, "old")
+	clk.Advance(30 * time.Minute)
+	write(t, s, clk, "new")
+	// Spooled recently, but with a timestamp older than max_age
+	if err := s.Write(testMessage(t, "ancient", clk.Now().Add(-2*time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+
+	// The segment of the old message is dropped by its spool time
+	clk.Advance(31 * time.Minute)
+	waitFor(t, "the expiry of the old segment", func() bool { return stats(s).DroppedAge == 1 })
+	if st := stats(s); st.Messages != 2 {
+		t.Errorf("stats after the expiry %+v, want 2 messages left", st)
+	}
+
+	// The ancient message is dropped by its timestamp during the replay
+	recoverSink(t, s, f, clk)
+	if names := f.names(); !reflect.DeepEqual(names, []string{"new"}) {
+		t.Errorf("replayed %v, want only the message within max_age", names)
+	}
+	if st := stats(s); st.DroppedAge != 2 || st.Replayed != 1 {
+		t.Errorf("stats after the replay %+v, want 2 messages dropped by age", st)
+	}
+}
+
+func TestSpoolRestart(t *testing.T) {
+	dir := t.TempDir()
+	clk := clock.NewFake(testStart)
+	s, f := newTestSpool(t, dir, clk)
+	f.setFailing(true)
+	write(t, s, clk, "m1", "m2")
+	s.Close()
+
+	// The spool of the previous run is replayed before the new messages
+	s, f = newTestSpool(t, dir, clk)
+	defer s.Close()
+	st := stats(s)
+	if !st.Unavailable || st.Messages != 2 || st.Bytes != diskSize(t, dir) {
+		t.Errorf("stats after the restart %+v, want the 2 messages of the previous run", st)
+	}
+	write(t, s, clk, "m3")
+	recoverSink(t, s, f, clk)
+	if names := f.names(); !reflect.DeepEqual(names, []string{"m1", "m2", "m3"}) {
+		t.Errorf("replayed %v, want the messages of the previous run first", names)
+	}
+}
+
+func TestSpoolConfig(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"missing path", `{"type": "spool", "sink": {"type": "flaky"}}`},
+		{"missing sink", fmt.Sprintf(`{"type": "spool", "path": %q}`, dir)},
+		{"spool in spool", fmt.Sprintf(`{"type": "spool", "path": %q, "sink": {"type": "spool"}}`, dir)},
+		{"unknown sink", fmt.Sprintf(`{"type": "spool", "path": %q, "sink": {"type": "unknown"}}`, dir)},
+		{"invalid max_age", fmt.Sprintf(`{"type": "spool", "path": %q, "max_age": "1", "sink": {"type": "flaky"}}`, dir)},
+		{"unknown option", fmt.Sprintf(`{"type": "spool", "path": %q, "size": 1, "sink": {"type": "flaky"}}`, dir)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSpoolSink(tt.name, json.RawMessage(tt.config))
+			if err == nil {
+				s.Close()
+				t.Errorf("invalid configuration accepted")
+			} else if s != nil {
+				t.Errorf("sink returned with error %v", err)
+			}
+		})
+	}
+}
+
+func TestSpoolFieldKinds(t *testing.T) {
+	fields := map[string]interface{}{
+		"float":   1.0,
+		"int":     int64(-3),
+		"uint":    uint64(1) << 63,
+		"float32": float32(2),
+		"string":  "ok",
+	}
+	m, err := lp.NewMessage("m", map[string]string{"type": "node"}, nil, fields, testStart)
+	if err != nil || m == nil {
+		t.Fatalf("cannot create message: %v", err)
+	}
+	line, err := json.Marshal(toRecord(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r spoolRecord
+	d := json.NewDecoder(bytes.NewReader(line))
+	d.UseNumber()
+	if err := d.Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := fromRecord(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"float": 1.0, "int": int64(-3), "uint": uint64(1) << 63, "float32": 2.0, "string": "ok"}
+	if got := restored.Fields(); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored fields %#v, want %#v", got, want)
+	}
+}
+
+func TestSpoolWriteError(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "spool")
+	clk := clock.NewFake(testStart)
+	s, f := newTestSpool(t, dir, clk)
+	defer s.Close()
+
+	// The spool directory is gone, so the messages of the outage cannot be spooled
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	f.setFailing(true)
+	if err := s.Write(testMessage(t, "m1", clk.Now())); err == nil {
+		t.Errorf("Write() succeeded although the message could not be spooled")
+	}
+	if err := s.Write(testMessage(t, "m2", clk.Now())); err == nil {
+		t.Errorf("Write() succeeded although the message could not be spooled")
+	}
+	if st := stats(s); st.DroppedIO != 2 || st.DroppedSize != 0 || st.Spooled != 0 {
+		t.Errorf("stats %+v, want 2 messages dropped because of the write errors", st)
+	}
+}
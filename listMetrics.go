@@ -0,0 +1,83 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ClusterCockpit/cc-metric-collector/collectors"
+)
+
+// writeMetricCatalogMarkdown writes one table per collector
+func writeMetricCatalogMarkdown(w io.Writer, catalog []collectors.CollectorMetrics) {
+	for _, c := range catalog {
+		fmt.Fprintf(w, "## `%s`\n\n", c.Collector)
+		if !c.Described {
+			fmt.Fprintf(w, "The collector does not describe its metrics. See the collector documentation.\n\n")
+			continue
+		}
+		if len(c.Metrics) == 0 {
+			fmt.Fprintf(w, "The collector emits no metrics with this configuration.\n\n")
+			continue
+		}
+		fmt.Fprintln(w, "| Metric | Unit | Scopes | Kind | Group | Description |")
+		fmt.Fprintln(w, "|--------|------|--------|------|-------|-------------|")
+		for _, m := range c.Metrics {
+			fmt.Fprintf(w, "| `%s` | %s | %s | %s | %s | %s |\n",
+				m.Name, m.Unit, strings.Join(m.Scopes, ", "), m.Kind, m.Group,
+				strings.ReplaceAll(m.Description, "|", "\\|"))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// listMetrics prints the metrics of the configured collectors in the given format
+// ('json' or 'markdown') without initializing any collector. It returns the exit code.
+func listMetrics(configFile, format string) int {
+	err := checkConfigFiles(configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	err = loadConfig(configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	collectConfig := getPackageConfig("collectors")
+	if len(collectConfig) == 0 {
+		fmt.Fprintln(os.Stderr, "Collector configuration must be set")
+		return 1
+	}
+	catalog, err := collectors.MetricCatalog(collectConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	switch format {
+	case "json":
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		err = e.Encode(catalog)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+	case "markdown", "md":
+		writeMetricCatalogMarkdown(os.Stdout, catalog)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown format '%s' for -list-metrics, use 'json' or 'markdown'\n", format)
+		return 1
+	}
+	return 0
+}
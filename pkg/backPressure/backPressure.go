@@ -0,0 +1,202 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package backPressure
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cclog "github.com/ClusterCockpit/cc-lib/ccLogger"
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+)
+
+// Policies applied when a channel is full
+const (
+	POLICY_BLOCK       = "block"       // wait until the reader makes room
+	POLICY_DROP_NEWEST = "drop-newest" // drop the message to send
+	POLICY_DROP_OLDEST = "drop-oldest" // drop the oldest message in the channel to make room
+)
+
+// Default size of the channels between the components
+const DEFAULT_CHANNEL_SIZE = 200
+
+// Minimal time between two warnings about dropped messages of a channel
+const WARNING_INTERVAL = 10 * time.Second
+
+// ChannelConfig is the configuration of a channel between two components
+type ChannelConfig struct {
+	Size   int    `json:"size,omitempty"`   // Capacity of the channel, DEFAULT_CHANNEL_SIZE if unset
+	Policy string `json:"policy,omitempty"` // Policy if the channel is full, POLICY_BLOCK if unset
+}
+
+// Validate checks the size and the policy of the channel configuration
+func (c ChannelConfig) Validate() error {
+	if c.Size < 0 {
+		return fmt.Errorf("size: must not be negative")
+	}
+	return ValidatePolicy(c.Policy)
+}
+
+// ChannelSize returns the configured size or DEFAULT_CHANNEL_SIZE
+func (c ChannelConfig) ChannelSize() int {
+	if c.Size > 0 {
+		return c.Size
+	}
+	return DEFAULT_CHANNEL_SIZE
+}
+
+// ValidatePolicy checks that the policy is known. An empty policy denotes POLICY_BLOCK.
+func ValidatePolicy(policy string) error {
+	switch policy {
+	case "", POLICY_BLOCK, POLICY_DROP_NEWEST, POLICY_DROP_OLDEST:
+		return nil
+	}
+	return fmt.Errorf("unknown policy '%s', use '%s', '%s' or '%s'",
+		policy, POLICY_BLOCK, POLICY_DROP_NEWEST, POLICY_DROP_OLDEST)
+}
+
+// Drop counter of a channel, shared by all senders of the channel
+type dropCounter struct {
+	policy      atomic.Value  // policy of the last sender created for the channel
+	dropped     atomic.Uint64 // number of dropped messages
+	warned      atomic.Uint64 // number of dropped messages at the last warning
+	lastWarning atomic.Int64  // time of the last warning in unix nanoseconds
+}
+
+var (
+	countersLock sync.Mutex
+	counters     = make(map[string]*dropCounter)
+)
+
+// counter returns the drop counter of a channel
+func counter(channel string) *dropCounter {
+	countersLock.Lock()
+	defer countersLock.Unlock()
+	c, ok := counters[channel]
+	if !ok {
+		c = new(dropCounter)
+		counters[channel] = c
+	}
+	return c
+}
+
+// ChannelStats are the dropped messages of a channel
+type ChannelStats struct {
+	Channel string // Name of the channel
+	Policy  string // Policy of the channel
+	Dropped uint64 // Number of dropped messages
+}
+
+// Stats returns the dropped messages of all channels with a sender sorted by channel name
+func Stats() []ChannelStats {
+	countersLock.Lock()
+	defer countersLock.Unlock()
+	stats := make([]ChannelStats, 0, len(counters))
+	for channel, c := range counters {
+		policy, _ := c.policy.Load().(string)
+		stats = append(stats, ChannelStats{Channel: channel, Policy: policy, Dropped: c.dropped.Load()})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Channel < stats[j].Channel })
+	return stats
+}
+
+// Sender data structure
+type sender struct {
+	channel string
+	output  chan lp.CCMessage
+	policy  string
+	counter *dropCounter
+}
+
+// Sender sends messages to a channel applying the policy of the channel
+type Sender interface {
+	Send(msg lp.CCMessage) bool // Send the message, returns false if a message was dropped
+	Policy() string             // Policy applied if the channel is full
+	Dropped() uint64            // Number of messages dropped in the channel
+}
+
+// Send sends the message to the channel. If the channel is full, the message is dropped
+// (POLICY_DROP_NEWEST), the oldest message in the channel is dropped (POLICY_DROP_OLDEST)
+// or Send waits until the reader makes room (POLICY_BLOCK). It returns false if a
+// message was dropped.
+func (s *sender) Send(msg lp.CCMessage) bool {
+	select {
+	case s.output <- msg:
+		return true
+	default:
+	}
+	switch s.policy {
+	case POLICY_DROP_NEWEST:
+		s.drop()
+		return false
+	case POLICY_DROP_OLDEST:
+		select {
+		case <-s.output:
+		default:
+		}
+		s.drop()
+		select {
+		case s.output <- msg:
+		default:
+			// Other senders filled the channel again, drop the new message instead
+		}
+		return false
+	}
+	s.output <- msg
+	return true
+}
+
+// drop counts a dropped message and logs a warning at most once per WARNING_INTERVAL
+func (s *sender) drop() {
+	dropped := s.counter.dropped.Add(1)
+	now := time.Now().UnixNano()
+	last := s.counter.lastWarning.Load()
+	if now-last < int64(WARNING_INTERVAL) || !s.counter.lastWarning.CompareAndSwap(last, now) {
+		return
+	}
+	warned := s.counter.warned.Swap(dropped)
+	cclog.ComponentError("BackPressure", "Channel", s.channel, "is full, dropped", dropped-warned,
+		"messages with policy", s.policy, "since the last warning,", dropped, "in total")
+}
+
+// Policy returns the policy applied if the channel is full
+func (s *sender) Policy() string {
+	return s.policy
+}
+
+// Dropped returns the number of messages dropped in the channel by all its senders
+func (s *sender) Dropped() uint64 {
+	return s.counter.dropped.Load()
+}
+
+// NewSender creates a sender for the named channel with the given policy. All senders
+// of a channel name share the drop counter reported by Stats(). Senders without channel
+// name are not reported.
+func NewSender(channel string, output chan lp.CCMessage, policy string) (Sender, error) {
+	err := ValidatePolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	if len(policy) == 0 {
+		policy = POLICY_BLOCK
+	}
+	s := &sender{
+		channel: channel,
+		output:  output,
+		policy:  policy,
+		counter: new(dropCounter),
+	}
+	if len(channel) > 0 {
+		s.counter = counter(channel)
+	}
+	s.counter.policy.Store(policy)
+	return s, nil
+}
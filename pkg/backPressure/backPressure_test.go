@@ -0,0 +1,155 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package backPressure
+
+import (
+	"testing"
+	"time"
+
+	lp "github.com/ClusterCockpit/cc-lib/ccMessage"
+)
+
+// testMessage creates a metric or fails the test
+func testMessage(t *testing.T, name string) lp.CCMessage {
+	t.Helper()
+	m, err := lp.NewMetric(name, map[string]string{"type": "node"}, nil, 1, time.Now())
+	if err != nil || m == nil {
+		t.Fatalf("cannot create metric %s: %v", name, err)
+	}
+	return m
+}
+
+// names returns the names of the messages in the channel
+func names(output chan lp.CCMessage) []string {
+	list := make([]string, 0)
+	for len(output) > 0 {
+		list = append(list, (<-output).Name())
+	}
+	return list
+}
+
+// stats returns the statistics of a channel. The drop counters of a channel name are
+// shared by the whole process, so the tests compare the counters before and after.
+func stats(channel string) (ChannelStats, bool) {
+	for _, s := range Stats() {
+		if s.Channel == channel {
+			return s, true
+		}
+	}
+	return ChannelStats{}, false
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ChannelConfig
+		size   int
+		valid  bool
+	}{
+		{"defaults", ChannelConfig{}, DEFAULT_CHANNEL_SIZE, true},
+		{"drop-oldest", ChannelConfig{Size: 10, Policy: POLICY_DROP_OLDEST}, 10, true},
+		{"negative size", ChannelConfig{Size: -1}, DEFAULT_CHANNEL_SIZE, false},
+		{"unknown policy", ChannelConfig{Policy: "drop"}, DEFAULT_CHANNEL_SIZE, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if valid := tt.config.Validate() == nil; valid != tt.valid {
+				t.Errorf("Validate() = %v, want valid %v", tt.config.Validate(), tt.valid)
+			}
+			if size := tt.config.ChannelSize(); size != tt.size {
+				t.Errorf("ChannelSize() = %d, want %d", size, tt.size)
+			}
+		})
+	}
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		policy  string
+		sent    []bool
+		names   []string
+		dropped uint64
+	}{
+		{POLICY_DROP_NEWEST, []bool{true, true, false, false}, []string{"m1", "m2"}, 2},
+		{POLICY_DROP_OLDEST, []bool{true, true, false, false}, []string{"m3", "m4"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			channel := "test-" + tt.policy
+			output := make(chan lp.CCMessage, 2)
+			s, err := NewSender(channel, output, tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := s.Dropped()
+			for i, name := range []string{"m1", "m2", "m3", "m4"} {
+				if sent := s.Send(testMessage(t, name)); sent != tt.sent[i] {
+					t.Errorf("Send(%s) = %v, want %v", name, sent, tt.sent[i])
+				}
+			}
+			if n := names(output); len(n) != len(tt.names) || n[0] != tt.names[0] || n[1] != tt.names[1] {
+				t.Errorf("channel contains %v, want %v", n, tt.names)
+			}
+			if dropped := s.Dropped() - before; dropped != tt.dropped || s.Policy() != tt.policy {
+				t.Errorf("sender with policy %s dropped %d messages, want %s and %d", s.Policy(), dropped, tt.policy, tt.dropped)
+			}
+			if st, ok := stats(channel); !ok || st.Dropped-before != tt.dropped || st.Policy != tt.policy {
+				t.Errorf("Stats() of %s = %+v, want %d more dropped messages than %d", channel, st, tt.dropped, before)
+			}
+		})
+	}
+}
+
+func TestSendBlock(t *testing.T) {
+	output := make(chan lp.CCMessage, 1)
+	s, err := NewSender("", output, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Policy() != POLICY_BLOCK {
+		t.Errorf("default policy %s, want %s", s.Policy(), POLICY_BLOCK)
+	}
+	s.Send(testMessage(t, "m1"))
+	sent := make(chan bool)
+	go func() { sent <- s.Send(testMessage(t, "m2")) }()
+	select {
+	case <-sent:
+		t.Fatal("Send() to a full channel returned without blocking")
+	case <-time.After(10 * time.Millisecond):
+	}
+	if m := <-output; m.Name() != "m1" {
+		t.Errorf("received %s, want m1", m.Name())
+	}
+	if !<-sent || s.Dropped() != 0 {
+		t.Errorf("blocked message dropped")
+	}
+	if m := <-output; m.Name() != "m2" {
+		t.Errorf("received %s, want m2", m.Name())
+	}
+}
+
+func TestSharedCounter(t *testing.T) {
+	output := make(chan lp.CCMessage)
+	s1, _ := NewSender("test-shared", output, POLICY_DROP_NEWEST)
+	s2, _ := NewSender("test-shared", output, POLICY_DROP_NEWEST)
+	unnamed, _ := NewSender("", output, POLICY_DROP_NEWEST)
+	before := s1.Dropped()
+	s1.Send(testMessage(t, "m1"))
+	s2.Send(testMessage(t, "m2"))
+	unnamed.Send(testMessage(t, "m3"))
+	if s1.Dropped()-before != 2 || s2.Dropped()-before != 2 || unnamed.Dropped() != 1 {
+		t.Errorf("dropped %d, %d and %d messages, want 2 shared by the channel and 1 of the unnamed sender",
+			s1.Dropped()-before, s2.Dropped()-before, unnamed.Dropped())
+	}
+	if _, ok := stats(""); ok {
+		t.Errorf("sender without channel name reported by Stats()")
+	}
+	if _, err := NewSender("test-invalid", output, "drop"); err == nil {
+		t.Errorf("sender with unknown policy created")
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"strings"
 
 	cclogger "github.com/ClusterCockpit/cc-lib/ccLogger"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/hostfs"
 	"golang.org/x/exp/slices"
 )
 
@@ -112,11 +113,18 @@ func fileToList(path string) []int {
 
 // init initializes the cache structure
 func init() {
+	Reload()
+}
+
+// Reload reads the topology again from the sysfs directory set with hostfs.SetRoots().
+// It must be called before any other component uses the topology.
+func Reload() {
+	sysfsCPUBase := hostfs.Path(SYSFS_CPUBASE)
 
 	getHWThreads :=
 		func() []int {
-			globPath := filepath.Join(SYSFS_CPUBASE, "cpu[0-9]*")
-			regexPath := filepath.Join(SYSFS_CPUBASE, "cpu([[:digit:]]+)")
+			globPath := filepath.Join(sysfsCPUBase, "cpu[0-9]*")
+			regexPath := regexp.QuoteMeta(sysfsCPUBase) + "/cpu([[:digit:]]+)"
 			regex := regexp.MustCompile(regexPath)
 
 			// File globbing for hardware threads
@@ -153,7 +161,7 @@ func init() {
 	getNumaDomain :=
 		func(basePath string) int {
 			globPath := filepath.Join(basePath, "node*")
-			regexPath := filepath.Join(basePath, "node([[:digit:]]+)")
+			regexPath := regexp.QuoteMeta(basePath) + "/node([[:digit:]]+)"
 			regex := regexp.MustCompile(regexPath)
 
 			// File globbing for NUMA node
@@ -194,7 +202,7 @@ func init() {
 	cache.CpuData = make([]HwthreadEntry, len(cache.HwthreadList))
 	for i, c := range cache.HwthreadList {
 		// Set cpuBase directory for topology lookup
-		cpuBase := filepath.Join(SYSFS_CPUBASE, fmt.Sprintf("cpu%d", c))
+		cpuBase := filepath.Join(sysfsCPUBase, fmt.Sprintf("cpu%d", c))
 		topoBase := filepath.Join(cpuBase, "topology")
 
 		// Lookup Core ID
@@ -0,0 +1,209 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock provides the current time, timers and tickers
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer sends the current time on its channel once after the duration elapsed
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker sends the current time on its channel after each elapsed duration
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the clock using the time of the operating system
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                  { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration { return time.Since(t) }
+func (realClock) NewTimer(d time.Duration) Timer  { return &realTimer{time.NewTimer(d)} }
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{time.NewTicker(d)}
+}
+
+type realTimer struct{ t *time.Timer }
+
+func (r *realTimer) C() <-chan time.Time        { return r.t.C }
+func (r *realTimer) Stop() bool                 { return r.t.Stop() }
+func (r *realTimer) Reset(d time.Duration) bool { return r.t.Reset(d) }
+
+type realTicker struct{ t *time.Ticker }
+
+func (r *realTicker) C() <-chan time.Time { return r.t.C }
+func (r *realTicker) Stop()               { r.t.Stop() }
+
+// Fake is a clock whose time only changes with Set() and Advance(). Timers and tickers
+// fire while the time is advanced, in the order of their deadlines. Like the timers of
+// the time package, their channels buffer one value and further values are dropped
+// if the receiver is too slow.
+type Fake struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// Timer or ticker of the fake clock
+type fakeWaiter struct {
+	clock    *Fake
+	c        chan time.Time
+	deadline time.Time
+	period   time.Duration // zero for timers
+	active   bool
+}
+
+// NewFake creates a fake clock starting at the given time
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start}
+}
+
+// Now returns the current time of the fake clock
+func (f *Fake) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+// Since returns the time elapsed since t on the fake clock
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// NewTimer creates a timer firing when the fake clock advanced by d
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	w := &fakeWaiter{clock: f, c: make(chan time.Time, 1), deadline: f.now.Add(d), active: true}
+	f.waiters = append(f.waiters, w)
+	return w
+}
+
+// NewTicker creates a ticker firing each time the fake clock advanced by d
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	w := &fakeWaiter{clock: f, c: make(chan time.Time, 1), deadline: f.now.Add(d), period: d, active: true}
+	f.waiters = append(f.waiters, w)
+	return &fakeTicker{w}
+}
+
+// Advance moves the fake clock forward by d and fires all timers and tickers
+// whose deadline is reached
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the fake clock to the given time and fires all timers and tickers
+// whose deadline is reached. While firing, the clock is set to the deadline.
+func (f *Fake) Set(t time.Time) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for {
+		active := make([]*fakeWaiter, 0, len(f.waiters))
+		for _, w := range f.waiters {
+			if w.active {
+				active = append(active, w)
+			}
+		}
+		f.waiters = active
+		sort.SliceStable(active, func(i, j int) bool { return active[i].deadline.Before(active[j].deadline) })
+		if len(active) == 0 || active[0].deadline.After(t) {
+			break
+		}
+		w := active[0]
+		f.now = w.deadline
+		select {
+		case w.c <- w.deadline:
+		default:
+		}
+		if w.period > 0 {
+			w.deadline = w.deadline.Add(w.period)
+		} else {
+			w.active = false
+		}
+	}
+	if t.After(f.now) {
+		f.now = t
+	}
+}
+
+// Waiters returns the number of active timers and tickers. Tests can use it to wait until
+// a component created its timer before advancing the clock.
+func (f *Fake) Waiters() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	n := 0
+	for _, w := range f.waiters {
+		if w.active {
+			n++
+		}
+	}
+	return n
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+// Stop deactivates the timer or ticker. It returns whether it was active.
+func (w *fakeWaiter) Stop() bool {
+	w.clock.lock.Lock()
+	defer w.clock.lock.Unlock()
+	active := w.active
+	w.active = false
+	return active
+}
+
+// Reset sets the deadline of a timer to d after the current time of the fake clock.
+// It returns whether the timer was active.
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	w.clock.lock.Lock()
+	defer w.clock.lock.Unlock()
+	active := w.active
+	w.deadline = w.clock.now.Add(d)
+	w.active = true
+	for _, o := range w.clock.waiters {
+		if o == w {
+			return active
+		}
+	}
+	w.clock.waiters = append(w.clock.waiters, w)
+	return active
+}
+
+// Ticker of the fake clock
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+// Stop deactivates the ticker
+func (t *fakeTicker) Stop() {
+	t.fakeWaiter.Stop()
+}
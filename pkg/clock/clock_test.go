@@ -0,0 +1,125 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// received returns the value waiting on a channel of a timer or ticker
+func received(c <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-c:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFakeNowAndSince(t *testing.T) {
+	f := NewFake(start)
+	if !f.Now().Equal(start) {
+		t.Fatalf("Now() = %v, want %v", f.Now(), start)
+	}
+	f.Advance(90 * time.Second)
+	if d := f.Since(start); d != 90*time.Second {
+		t.Errorf("Since() = %v, want 90s", d)
+	}
+	f.Set(start)
+	if !f.Now().Equal(start.Add(90 * time.Second)) {
+		t.Errorf("Set() to an earlier time moved the clock backwards to %v", f.Now())
+	}
+}
+
+func TestFakeTimer(t *testing.T) {
+	f := NewFake(start)
+	timer := f.NewTimer(10 * time.Second)
+	f.Advance(9 * time.Second)
+	if _, ok := received(timer.C()); ok {
+		t.Fatal("timer fired before its deadline")
+	}
+	f.Advance(5 * time.Second)
+	ts, ok := received(timer.C())
+	if !ok {
+		t.Fatal("timer did not fire at its deadline")
+	}
+	if want := start.Add(10 * time.Second); !ts.Equal(want) {
+		t.Errorf("timer fired with %v, want the deadline %v", ts, want)
+	}
+	if f.Waiters() != 0 {
+		t.Errorf("fired timer is still active")
+	}
+	if timer.Reset(time.Second) {
+		t.Errorf("Reset() of a fired timer reported an active timer")
+	}
+	if !timer.Stop() {
+		t.Errorf("Stop() after Reset() reported an inactive timer")
+	}
+	f.Advance(time.Minute)
+	if _, ok := received(timer.C()); ok {
+		t.Errorf("stopped timer fired")
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(start)
+	ticker := f.NewTicker(10 * time.Second)
+	for i := 1; i <= 3; i++ {
+		f.Advance(10 * time.Second)
+		ts, ok := received(ticker.C())
+		if !ok {
+			t.Fatalf("tick %d missing", i)
+		}
+		if want := start.Add(time.Duration(i) * 10 * time.Second); !ts.Equal(want) {
+			t.Errorf("tick %d at %v, want %v", i, ts, want)
+		}
+	}
+
+	// The channel buffers one tick, the others are dropped like with time.Ticker
+	f.Advance(30 * time.Second)
+	ts, ok := received(ticker.C())
+	if !ok || !ts.Equal(start.Add(40*time.Second)) {
+		t.Errorf("after a slow receiver got %v (%v), want the first pending tick %v", ts, ok, start.Add(40*time.Second))
+	}
+	if _, ok := received(ticker.C()); ok {
+		t.Errorf("more than one tick buffered")
+	}
+
+	ticker.Stop()
+	f.Advance(time.Minute)
+	if _, ok := received(ticker.C()); ok {
+		t.Errorf("stopped ticker ticked")
+	}
+}
+
+func TestFakeOrder(t *testing.T) {
+	f := NewFake(start)
+	late := f.NewTimer(20 * time.Second)
+	early := f.NewTimer(10 * time.Second)
+	f.Advance(time.Minute)
+	e, _ := received(early.C())
+	l, _ := received(late.C())
+	if !e.Before(l) {
+		t.Errorf("timers fired out of order: early %v, late %v", e, l)
+	}
+	if !f.Now().Equal(start.Add(time.Minute)) {
+		t.Errorf("Now() = %v after Advance(), want %v", f.Now(), start.Add(time.Minute))
+	}
+}
+
+func TestRealTimer(t *testing.T) {
+	timer := Real.NewTimer(time.Millisecond)
+	select {
+	case <-timer.C():
+	case <-time.After(10 * time.Second):
+		t.Fatal("real timer did not fire")
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package hostfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Default mount points of procfs and sysfs
+const (
+	DEFAULT_PROCFS_ROOT = "/proc"
+	DEFAULT_SYSFS_ROOT  = "/sys"
+)
+
+// Roots holds the directories procfs and sysfs are read from. Empty values
+// fall back to the global setting.
+type Roots struct {
+	Procfs string `json:"procfs_root,omitempty"` // Directory of procfs (default '/proc')
+	Sysfs  string `json:"sysfs_root,omitempty"`  // Directory of sysfs (default '/sys')
+}
+
+var (
+	globalLock  sync.RWMutex
+	globalRoots = Roots{Procfs: DEFAULT_PROCFS_ROOT, Sysfs: DEFAULT_SYSFS_ROOT}
+)
+
+// SetRoots sets the global procfs and sysfs directories. Empty values reset
+// the directory to its default.
+func SetRoots(r Roots) {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	globalRoots = Roots{Procfs: DEFAULT_PROCFS_ROOT, Sysfs: DEFAULT_SYSFS_ROOT}
+	if len(r.Procfs) > 0 {
+		globalRoots.Procfs = filepath.Clean(r.Procfs)
+	}
+	if len(r.Sysfs) > 0 {
+		globalRoots.Sysfs = filepath.Clean(r.Sysfs)
+	}
+}
+
+// GetRoots returns the global procfs and sysfs directories
+func GetRoots() Roots {
+	globalLock.RLock()
+	defer globalLock.RUnlock()
+	return globalRoots
+}
+
+// Path rebases an absolute path below /proc or /sys to the global directories,
+// e.g. '/proc/stat' becomes '/host/proc/stat' with procfs root '/host/proc'.
+// All other paths are returned unchanged.
+func Path(path string) string {
+	return Roots{}.Path(path)
+}
+
+// Path rebases an absolute path below /proc or /sys to the directories of r.
+// Directories not set in r are taken from the global setting.
+func (r Roots) Path(path string) string {
+	g := GetRoots()
+	if len(r.Procfs) == 0 {
+		r.Procfs = g.Procfs
+	}
+	if len(r.Sysfs) == 0 {
+		r.Sysfs = g.Sysfs
+	}
+	if rest, ok := cutRoot(path, DEFAULT_PROCFS_ROOT); ok {
+		return filepath.Join(r.Procfs, rest)
+	}
+	if rest, ok := cutRoot(path, DEFAULT_SYSFS_ROOT); ok {
+		return filepath.Join(r.Sysfs, rest)
+	}
+	return path
+}
+
+// Original reverts Path(): a path below the directories of r (or the global directories)
+// is returned as path below /proc or /sys. All other paths are returned unchanged.
+func (r Roots) Original(path string) string {
+	g := GetRoots()
+	if len(r.Procfs) == 0 {
+		r.Procfs = g.Procfs
+	}
+	if len(r.Sysfs) == 0 {
+		r.Sysfs = g.Sysfs
+	}
+	if rest, ok := cutRoot(path, r.Procfs); ok {
+		return filepath.Join(DEFAULT_PROCFS_ROOT, rest)
+	}
+	if rest, ok := cutRoot(path, r.Sysfs); ok {
+		return filepath.Join(DEFAULT_SYSFS_ROOT, rest)
+	}
+	return path
+}
+
+// cutRoot returns the path relative to root if path is root or below root
+func cutRoot(path, root string) (string, bool) {
+	if path == root {
+		return "", true
+	}
+	if rest, ok := strings.CutPrefix(path, root+"/"); ok {
+		return rest, true
+	}
+	return "", false
+}
+
+// Validate checks that the configured directories exist
+func (r Roots) Validate() []error {
+	errs := make([]error, 0)
+	check := func(key, dir string) {
+		if len(dir) == 0 {
+			return
+		}
+		if !filepath.IsAbs(dir) {
+			errs = append(errs, fmt.Errorf("%s: must be an absolute path: %s", key, dir))
+			return
+		}
+		info, err := os.Stat(dir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", key, err))
+		} else if !info.IsDir() {
+			errs = append(errs, fmt.Errorf("%s: not a directory: %s", key, dir))
+		}
+	}
+	check("procfs_root", r.Procfs)
+	check("sysfs_root", r.Sysfs)
+	return errs
+}
@@ -0,0 +1,88 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package hostfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	SetRoots(Roots{Procfs: "/host/proc/", Sysfs: "/host/sys"})
+	defer SetRoots(Roots{})
+
+	tests := []struct {
+		roots    Roots
+		path     string
+		want     string
+		original string
+	}{
+		{Roots{}, "/proc/stat", "/host/proc/stat", "/proc/stat"},
+		{Roots{}, "/proc", "/host/proc", "/proc"},
+		{Roots{}, "/sys/class/net", "/host/sys/class/net", "/sys/class/net"},
+		{Roots{}, "/procfs/stat", "/procfs/stat", "/procfs/stat"},
+		{Roots{}, "/etc/hostname", "/etc/hostname", "/etc/hostname"},
+		{Roots{}, "proc/stat", "proc/stat", "proc/stat"},
+		{Roots{Sysfs: "/tmp/sys"}, "/sys/devices", "/tmp/sys/devices", "/sys/devices"},
+		{Roots{Sysfs: "/tmp/sys"}, "/proc/meminfo", "/host/proc/meminfo", "/proc/meminfo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p := tt.roots.Path(tt.path)
+			if p != tt.want {
+				t.Errorf("Path(%s) = %s, want %s", tt.path, p, tt.want)
+			}
+			if o := tt.roots.Original(p); o != tt.original {
+				t.Errorf("Original(%s) = %s, want %s", p, o, tt.original)
+			}
+		})
+	}
+	if p := Path("/proc/stat"); p != "/host/proc/stat" {
+		t.Errorf("Path() with the global roots = %s, want /host/proc/stat", p)
+	}
+}
+
+func TestSetRoots(t *testing.T) {
+	SetRoots(Roots{Procfs: "/host/proc"})
+	SetRoots(Roots{Sysfs: "/host/sys"})
+	defer SetRoots(Roots{})
+	if r := GetRoots(); r.Procfs != DEFAULT_PROCFS_ROOT || r.Sysfs != "/host/sys" {
+		t.Errorf("GetRoots() = %+v, want the default procfs root", r)
+	}
+	SetRoots(Roots{})
+	if r := GetRoots(); r.Procfs != DEFAULT_PROCFS_ROOT || r.Sysfs != DEFAULT_SYSFS_ROOT {
+		t.Errorf("GetRoots() = %+v, want the defaults", r)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		roots Roots
+		errs  int
+	}{
+		{"defaults", Roots{}, 0},
+		{"directories", Roots{Procfs: dir, Sysfs: dir}, 0},
+		{"relative path", Roots{Procfs: "proc"}, 1},
+		{"missing directory", Roots{Sysfs: filepath.Join(dir, "missing")}, 1},
+		{"file", Roots{Procfs: file, Sysfs: file}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := tt.roots.Validate(); len(errs) != tt.errs {
+				t.Errorf("Validate() = %v, want %d errors", errs, tt.errs)
+			}
+		})
+	}
+}
@@ -8,64 +8,283 @@
 package multiChanTicker
 
 import (
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	cclog "github.com/ClusterCockpit/cc-lib/ccLogger"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/clock"
 )
 
+// Tick is sent to the channels added with AddTickChannel()
+type Tick struct {
+	Time   time.Time // timestamp of the tick
+	Seq    uint64    // sequence number of the tick, starting at 1
+	Missed uint64    // number of ticks replaced by this one because the receiver was busy
+}
+
+// Delivery statistics of a receiver of the ticks
+type TickReceiverStats struct {
+	Name      string `json:"name"`      // Name of the receiver
+	Delivered uint64 `json:"delivered"` // Number of ticks delivered to the receiver
+	Missed    uint64 `json:"missed"`    // Number of ticks the receiver missed because it was busy
+}
+
+// Receiver of the ticks. Each receiver has a mailbox holding the next tick and a goroutine
+// delivering it, so a slow receiver does not delay the ticks of the other receivers.
+type tickReceiver struct {
+	name      string
+	timeChan  chan time.Time // receiver added with AddChannel()
+	tickChan  chan Tick      // receiver added with AddTickChannel()
+	mailbox   chan Tick      // next tick to deliver
+	delivered atomic.Uint64
+	missed    atomic.Uint64
+}
+
 type multiChanTicker struct {
-	ticker   *time.Ticker
-	channels []chan time.Time
-	done     chan bool
+	clock     clock.Clock // clock providing the time and the ticker
+	ticker    clock.Ticker
+	duration  time.Duration
+	aligned   bool          // align the ticks to multiples of the duration since the Unix epoch
+	offset    time.Duration // delay of the aligned ticks after the boundary
+	lock      sync.Mutex    // lock for the list of receivers
+	receivers []*tickReceiver
+	seq       atomic.Uint64 // sequence number of the last tick
+	done      chan bool
+	stop      chan bool // closed by Close() to stop the delivery goroutines
 }
 
 type MultiChanTicker interface {
 	Init(duration time.Duration)
 	AddChannel(chan time.Time)
+	AddTickChannel(name string, channel chan Tick)
+	Interval() time.Duration
+	Tick(ts time.Time)
+	Stats() []TickReceiverStats
+	Clock() clock.Clock
 	Close()
 }
 
+// Init initializes the ticker. With a duration of zero, the ticker does not tick
+// by itself and ticks have to be triggered with Tick().
 func (t *multiChanTicker) Init(duration time.Duration) {
-	t.ticker = time.NewTicker(duration)
 	t.done = make(chan bool)
-	go func() {
-		done := func() {
-			close(t.done)
-			cclog.ComponentDebug("MultiChanTicker", "DONE")
+	t.stop = make(chan bool)
+	t.duration = duration
+	if t.clock == nil {
+		t.clock = clock.Real
+	}
+	if duration <= 0 {
+		return
+	}
+	if t.aligned {
+		t.offset = t.offset % duration
+		if t.offset < 0 {
+			t.offset += duration
 		}
+		go t.runAligned()
+		return
+	}
+	t.ticker = t.clock.NewTicker(duration)
+	go func() {
 		for {
 			select {
 			case <-t.done:
-				done()
+				t.finish()
 				return
-			case ts := <-t.ticker.C:
+			case ts := <-t.ticker.C():
 				cclog.ComponentDebug("MultiChanTicker", "Tick", ts)
-				for _, c := range t.channels {
-					select {
-					case <-t.done:
-						done()
-						return
-					case c <- ts:
-					}
-				}
+				t.post(ts)
 			}
 		}
 	}()
 }
 
+// runAligned ticks at the boundaries of the duration plus the offset. The timestamp of
+// each tick is the boundary, so ticks of all hosts with the same duration carry the
+// same timestamps regardless of their offset.
+func (t *multiChanTicker) runAligned() {
+	for {
+		now := t.clock.Now()
+		boundary := nextBoundary(now.Add(-t.offset), t.duration)
+		timer := t.clock.NewTimer(boundary.Add(t.offset).Sub(now))
+		select {
+		case <-t.done:
+			timer.Stop()
+			t.finish()
+			return
+		case <-timer.C():
+			cclog.ComponentDebug("MultiChanTicker", "Aligned tick", boundary)
+			t.post(boundary)
+		}
+	}
+}
+
+// nextBoundary returns the first multiple of the duration since the Unix epoch after ts
+func nextBoundary(ts time.Time, duration time.Duration) time.Time {
+	d := int64(duration)
+	return time.Unix(0, (ts.UnixNano()/d+1)*d)
+}
+
+// post puts the tick into the mailboxes of all receivers without blocking. If a receiver
+// did not take the previous tick yet, it is replaced by the new tick and counted as missed.
+func (t *multiChanTicker) post(ts time.Time) {
+	tick := Tick{Time: ts, Seq: t.seq.Add(1)}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, r := range t.receivers {
+		next := tick
+		select {
+		case old := <-r.mailbox:
+			next.Missed = old.Missed + 1
+			r.missed.Add(1)
+			cclog.ComponentDebug("MultiChanTicker", "Receiver", r.name, "missed tick", old.Seq)
+		default:
+		}
+		// Only this goroutine writes to the mailbox, so it is empty now
+		r.mailbox <- next
+	}
+}
+
+// deliver sends the ticks from the mailbox to the receiver until the ticker is closed
+func (t *multiChanTicker) deliver(r *tickReceiver) {
+	for {
+		select {
+		case <-t.stop:
+			return
+		case tick := <-r.mailbox:
+			if !t.send(r, tick) {
+				return
+			}
+		}
+	}
+}
+
+// send sends a tick to a receiver. It returns false if the ticker was closed meanwhile.
+func (t *multiChanTicker) send(r *tickReceiver, tick Tick) bool {
+	if r.tickChan != nil {
+		select {
+		case <-t.stop:
+			return false
+		case r.tickChan <- tick:
+		}
+	} else {
+		select {
+		case <-t.stop:
+			return false
+		case r.timeChan <- tick.Time:
+		}
+	}
+	r.delivered.Add(1)
+	return true
+}
+
+// finish signals Close() that the ticker goroutine stopped
+func (t *multiChanTicker) finish() {
+	close(t.done)
+	cclog.ComponentDebug("MultiChanTicker", "DONE")
+}
+
+// addReceiver registers a receiver and starts its delivery goroutine
+func (t *multiChanTicker) addReceiver(r *tickReceiver) {
+	r.mailbox = make(chan Tick, 1)
+	t.lock.Lock()
+	t.receivers = append(t.receivers, r)
+	t.lock.Unlock()
+	go t.deliver(r)
+}
+
+// AddChannel adds a channel receiving the timestamps of the ticks
 func (t *multiChanTicker) AddChannel(channel chan time.Time) {
-	t.channels = append(t.channels, channel)
+	t.lock.Lock()
+	name := fmt.Sprintf("channel%d", len(t.receivers))
+	t.lock.Unlock()
+	t.addReceiver(&tickReceiver{name: name, timeChan: channel})
+}
+
+// AddTickChannel adds a named channel receiving the ticks with sequence number
+// and number of missed ticks
+func (t *multiChanTicker) AddTickChannel(name string, channel chan Tick) {
+	t.addReceiver(&tickReceiver{name: name, tickChan: channel})
+}
+
+// Interval returns the duration between two ticks or zero if ticks are triggered manually
+func (t *multiChanTicker) Interval() time.Duration {
+	if t.duration <= 0 {
+		return 0
+	}
+	return t.duration
+}
+
+// Tick sends the given timestamp immediately to all channels and returns
+// after all receivers received it
+func (t *multiChanTicker) Tick(ts time.Time) {
+	cclog.ComponentDebug("MultiChanTicker", "Manual tick", ts)
+	tick := Tick{Time: ts, Seq: t.seq.Add(1)}
+	t.lock.Lock()
+	receivers := append([]*tickReceiver(nil), t.receivers...)
+	t.lock.Unlock()
+	for _, r := range receivers {
+		t.send(r, tick)
+	}
+}
+
+// Clock returns the clock of the ticker. Components receiving the ticks should use it
+// instead of the time package, so they can be tested with a fake clock.
+func (t *multiChanTicker) Clock() clock.Clock {
+	return t.clock
+}
+
+// Stats returns the delivery statistics of all receivers
+func (t *multiChanTicker) Stats() []TickReceiverStats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	stats := make([]TickReceiverStats, 0, len(t.receivers))
+	for _, r := range t.receivers {
+		stats = append(stats, TickReceiverStats{
+			Name:      r.name,
+			Delivered: r.delivered.Load(),
+			Missed:    r.missed.Load(),
+		})
+	}
+	return stats
 }
 
 func (t *multiChanTicker) Close() {
 	cclog.ComponentDebug("MultiChanTicker", "CLOSE")
-	t.done <- true
-	// wait for close of channel t.done
-	<-t.done
+	if t.duration > 0 {
+		if t.ticker != nil {
+			t.ticker.Stop()
+		}
+		t.done <- true
+		// wait for close of channel t.done
+		<-t.done
+	}
+	close(t.stop)
 }
 
 func NewTicker(duration time.Duration) MultiChanTicker {
-	t := &multiChanTicker{}
+	return NewTickerWithClock(clock.Real, duration)
+}
+
+// NewTickerWithClock creates a ticker using the given clock, e.g. a fake clock in tests
+func NewTickerWithClock(clk clock.Clock, duration time.Duration) MultiChanTicker {
+	t := &multiChanTicker{clock: clk}
+	t.Init(duration)
+	return t
+}
+
+// NewAlignedTicker creates a ticker that ticks at the multiples of the duration since the
+// Unix epoch (like every full 10 seconds) delayed by the offset. The ticks carry the
+// timestamp of the boundary, not the delayed time.
+func NewAlignedTicker(duration, offset time.Duration) MultiChanTicker {
+	return NewAlignedTickerWithClock(clock.Real, duration, offset)
+}
+
+// NewAlignedTickerWithClock creates an aligned ticker using the given clock
+func NewAlignedTickerWithClock(clk clock.Clock, duration, offset time.Duration) MultiChanTicker {
+	t := &multiChanTicker{clock: clk, aligned: true, offset: offset}
 	t.Init(duration)
 	return t
 }
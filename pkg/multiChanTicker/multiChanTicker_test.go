@@ -0,0 +1,154 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package multiChanTicker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/clock"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 3, 0, time.UTC)
+
+// waitFor polls a condition, the ticker delivers the ticks in goroutines
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// receive returns the next tick of a channel
+func receive(t *testing.T, c chan Tick) Tick {
+	t.Helper()
+	select {
+	case tick := <-c:
+		return tick
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for a tick")
+	}
+	return Tick{}
+}
+
+// stats returns the delivery statistics of a receiver
+func stats(ticker MultiChanTicker, name string) TickReceiverStats {
+	for _, s := range ticker.Stats() {
+		if s.Name == name {
+			return s
+		}
+	}
+	return TickReceiverStats{}
+}
+
+func TestDeliveredTicks(t *testing.T) {
+	clk := clock.NewFake(start)
+	ticker := NewTickerWithClock(clk, 10*time.Second)
+	defer ticker.Close()
+	if ticker.Clock() != clk {
+		t.Fatal("Clock() does not return the clock of the ticker")
+	}
+	a := make(chan Tick)
+	b := make(chan time.Time)
+	ticker.AddTickChannel("a", a)
+	ticker.AddChannel(b)
+
+	for i := uint64(1); i <= 3; i++ {
+		clk.Advance(10 * time.Second)
+		want := start.Add(time.Duration(i) * 10 * time.Second)
+		tick := receive(t, a)
+		if tick.Seq != i || tick.Missed != 0 || !tick.Time.Equal(want) {
+			t.Errorf("tick %d = %+v, want time %v", i, tick, want)
+		}
+		select {
+		case ts := <-b:
+			if !ts.Equal(want) {
+				t.Errorf("channel got %v, want %v", ts, want)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("timeout waiting for the time of a tick")
+		}
+	}
+	waitFor(t, "delivery statistics", func() bool { return stats(ticker, "a").Delivered == 3 })
+	if s := stats(ticker, "a"); s.Missed != 0 {
+		t.Errorf("receiver a missed %d ticks", s.Missed)
+	}
+}
+
+func TestMissedTicks(t *testing.T) {
+	clk := clock.NewFake(start)
+	ticker := NewTickerWithClock(clk, 10*time.Second)
+	defer ticker.Close()
+	slow := make(chan Tick)
+	fast := make(chan Tick, 10)
+	ticker.AddTickChannel("slow", slow)
+	ticker.AddTickChannel("fast", fast)
+
+	// The slow receiver does not take the first tick, so it blocks the delivery goroutine
+	// with it. The following ticks replace each other in the mailbox.
+	clk.Advance(10 * time.Second)
+	receive(t, fast)
+	mailbox := ticker.(*multiChanTicker).receivers[0].mailbox
+	waitFor(t, "the delivery of the first tick", func() bool { return len(mailbox) == 0 })
+	for i := 0; i < 3; i++ {
+		clk.Advance(10 * time.Second)
+		receive(t, fast)
+	}
+	first := receive(t, slow)
+	if first.Seq != 1 || first.Missed != 0 {
+		t.Errorf("first tick of the slow receiver = %+v, want seq 1", first)
+	}
+	next := receive(t, slow)
+	if next.Seq != 4 || next.Missed != 2 {
+		t.Errorf("next tick of the slow receiver = %+v, want seq 4 replacing 2 ticks", next)
+	}
+	waitFor(t, "delivery statistics", func() bool { return stats(ticker, "slow").Delivered == 2 })
+	if s := stats(ticker, "slow"); s.Missed != 2 {
+		t.Errorf("slow receiver missed %d ticks, want 2", s.Missed)
+	}
+	if s := stats(ticker, "fast"); s.Delivered != 4 || s.Missed != 0 {
+		t.Errorf("fast receiver stats %+v, want 4 delivered and none missed", s)
+	}
+}
+
+func TestAlignedTicks(t *testing.T) {
+	clk := clock.NewFake(start)
+	ticker := NewAlignedTickerWithClock(clk, 10*time.Second, 2*time.Second)
+	defer ticker.Close()
+	c := make(chan Tick)
+	ticker.AddTickChannel("aligned", c)
+
+	// The ticker creates its timer for the next boundary in a goroutine
+	waitFor(t, "the timer of the aligned ticker", func() bool { return clk.Waiters() == 1 })
+	clk.Advance(9 * time.Second)
+	tick := receive(t, c)
+	if want := start.Add(7 * time.Second); !tick.Time.Equal(want) {
+		t.Errorf("aligned tick at %v, want the boundary %v", tick.Time, want)
+	}
+	if !clk.Now().Equal(start.Add(9 * time.Second)) {
+		t.Errorf("aligned tick fired at %v, want the boundary plus the offset", clk.Now())
+	}
+}
+
+func TestManualTick(t *testing.T) {
+	ticker := NewTickerWithClock(clock.NewFake(start), 0)
+	defer ticker.Close()
+	if ticker.Interval() != 0 {
+		t.Errorf("Interval() = %v for a manually triggered ticker", ticker.Interval())
+	}
+	c := make(chan Tick, 1)
+	ticker.AddTickChannel("manual", c)
+	ticker.Tick(start)
+	if tick := receive(t, c); tick.Seq != 1 || !tick.Time.Equal(start) {
+		t.Errorf("manual tick = %+v, want seq 1 at %v", tick, start)
+	}
+}
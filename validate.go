@@ -0,0 +1,193 @@
+// Copyright (C) NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved. This file is part of cc-lib.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// additional authors:
+// Holger Obermaier (NHR@KIT)
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ClusterCockpit/cc-metric-collector/collectors"
+	cs "github.com/ClusterCockpit/cc-metric-collector/internal/controlServer"
+	mr "github.com/ClusterCockpit/cc-metric-collector/internal/metricRouter"
+	"github.com/ClusterCockpit/cc-metric-collector/pkg/hostfs"
+)
+
+// configFileName returns the name of the file containing the configuration of a component.
+// Components configured inline are reported with the main configuration file.
+func configFileName(configFile, key string) string {
+	raw, err := os.ReadFile(configFile)
+	if err != nil {
+		return configFile
+	}
+	var keys map[string]json.RawMessage
+	if json.Unmarshal(raw, &keys) != nil {
+		return configFile
+	}
+	var filename string
+	if value, ok := keys[key+"-file"]; ok && json.Unmarshal(value, &filename) == nil {
+		return filename
+	}
+	return fmt.Sprintf("%s: %s", configFile, key)
+}
+
+// validateMainConfig checks the global options
+func validateMainConfig(mainConfig json.RawMessage) []error {
+	errs := make([]error, 0)
+	var config CentralConfigFile
+	d := json.NewDecoder(bytes.NewReader(mainConfig))
+	d.DisallowUnknownFields()
+	err := d.Decode(&config)
+	if err != nil {
+		return append(errs, err)
+	}
+	interval, err := time.ParseDuration(config.Interval)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("interval: %v", err))
+	} else if interval <= 0 {
+		errs = append(errs, errors.New("interval: must be greater than zero"))
+	}
+	duration, err := time.ParseDuration(config.Duration)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("duration: %v", err))
+	} else if duration <= 0 {
+		errs = append(errs, errors.New("duration: must be greater than zero"))
+	}
+	if len(errs) == 0 && duration > interval {
+		errs = append(errs, errors.New("interval: must be greater than duration"))
+	}
+	roots := hostfs.Roots{Procfs: config.ProcfsRoot, Sysfs: config.SysfsRoot}
+	errs = append(errs, roots.Validate()...)
+	errs = append(errs, validateChannels(config.Channels)...)
+	if len(config.Splay) > 0 {
+		if !config.AlignTicks {
+			errs = append(errs, errors.New("splay: requires align_ticks"))
+		} else if interval > 0 {
+			if _, err := tickSplay(config.Splay, interval); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+// validateTypedConfig checks that each entry of a sinks or receivers configuration
+// has a type. The type specific options are checked when the component is created.
+func validateTypedConfig(rawConfig json.RawMessage) []error {
+	errs := make([]error, 0)
+	var config map[string]struct {
+		Type string `json:"type"`
+	}
+	err := json.Unmarshal(rawConfig, &config)
+	if err != nil {
+		return append(errs, err)
+	}
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if len(config[name].Type) == 0 {
+			errs = append(errs, fmt.Errorf("%s: missing type", name))
+		}
+	}
+	return errs
+}
+
+// validateOutputSinks checks that the sinks used by the router outputs are configured
+func validateOutputSinks(routerConfig, sinkConfig json.RawMessage) []error {
+	errs := make([]error, 0)
+	used, err := mr.OutputSinks(routerConfig)
+	if err != nil {
+		// Reported by the router validation
+		return errs
+	}
+	var sinks map[string]json.RawMessage
+	if json.Unmarshal(sinkConfig, &sinks) != nil {
+		return errs
+	}
+	for _, s := range used {
+		if _, ok := sinks[s]; !ok {
+			errs = append(errs, fmt.Errorf("outputs: unknown sink '%s'", s))
+		}
+	}
+	return errs
+}
+
+// checkConfiguration reads and checks all configuration files without starting any
+// component. All errors are returned with the file and the path of the option as context.
+func checkConfiguration(configFile string) []error {
+	err := checkConfigFiles(configFile)
+	if err != nil {
+		return []error{err}
+	}
+	err = loadConfig(configFile)
+	if err != nil {
+		return []error{err}
+	}
+
+	errs := make([]error, 0)
+	report := func(key string, componentErrs []error) {
+		filename := configFileName(configFile, key)
+		for _, err := range componentErrs {
+			errs = append(errs, fmt.Errorf("%s: %v", filename, err))
+		}
+	}
+	required := func(key string) json.RawMessage {
+		c := getPackageConfig(key)
+		if len(c) == 0 {
+			report(key, []error{errors.New("configuration must be set")})
+		}
+		return c
+	}
+
+	if c := required("main"); len(c) > 0 {
+		report("main", validateMainConfig(c))
+	}
+	if c := required("collectors"); len(c) > 0 {
+		report("collectors", collectors.ValidateConfig(c))
+	}
+	routerConf := required("router")
+	if len(routerConf) > 0 {
+		report("router", mr.ValidateConfig(routerConf))
+	}
+	if c := required("sinks"); len(c) > 0 {
+		report("sinks", validateTypedConfig(c))
+		if len(routerConf) > 0 {
+			report("router", validateOutputSinks(routerConf, c))
+		}
+	}
+	if c := getPackageConfig("receivers"); len(c) > 0 {
+		report("receivers", validateTypedConfig(c))
+	}
+	if c := getPackageConfig("control"); len(c) > 0 {
+		report("control", cs.ValidateConfig(c))
+	}
+	return errs
+}
+
+// validateConfiguration checks all configuration files without starting any component.
+// All errors are printed with the file and the path of the option as context.
+// It returns the exit code: 0 if the configuration is valid, 1 otherwise.
+func validateConfiguration(configFile string) int {
+	errs := checkConfiguration(configFile)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err.Error())
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "Configuration %s has %d error(s)\n", configFile, len(errs))
+		return 1
+	}
+	fmt.Printf("Configuration %s is valid\n", configFile)
+	return 0
+}